@@ -5,20 +5,258 @@ USE travel;
 CREATE TABLE IF NOT EXISTS items (
     id INT AUTO_INCREMENT PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
-    price DECIMAL(10,2) NOT NULL
+    description TEXT,
+    price DECIMAL(10,2) NOT NULL,
+    FULLTEXT INDEX ft_items (name, description) WITH PARSER ngram
+);
+
+CREATE TABLE IF NOT EXISTS destinations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    country VARCHAR(255),
+    description TEXT,
+    FULLTEXT INDEX ft_destinations (name, country, description) WITH PARSER ngram
 );
 
 CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(255) NOT NULL UNIQUE,
-    password VARCHAR(255) NOT NULL
+    email VARCHAR(255) UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL DEFAULT 'user',
+    email_verified_at TIMESTAMP NULL,
+    deactivated_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP NULL,
+    disabled_at TIMESTAMP NULL,
+    disabled_reason VARCHAR(255),
+    totp_secret VARCHAR(64),
+    totp_enabled_at TIMESTAMP NULL,
+    totp_last_step BIGINT NOT NULL DEFAULT 0,
+    daily_token_quota BIGINT NULL,
+    monthly_token_quota BIGINT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_profiles (
+    user_id INT PRIMARY KEY,
+    display_name VARCHAR(100),
+    home_city VARCHAR(100),
+    home_airport VARCHAR(3),
+    currency VARCHAR(3),
+    language VARCHAR(16),
+    dietary_needs TEXT,
+    accessibility_needs TEXT,
+    travel_style VARCHAR(32),
+    budget_min DOUBLE NULL,
+    budget_max DOUBLE NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_user_identities_subject (provider, subject),
+    INDEX idx_user_identities_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_recovery_codes_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_user_tokens_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    user_id INT NOT NULL,
+    scopes VARCHAR(512) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_api_keys_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    method VARCHAR(64),
+    ip VARCHAR(64),
+    user_agent VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    INDEX idx_sessions_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    persona VARCHAR(64) NOT NULL,
+    version INT NOT NULL,
+    description VARCHAR(255),
+    body TEXT NOT NULL,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_prompt_templates_version (persona, version)
 );
 
 CREATE TABLE IF NOT EXISTS conversation_history (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
-    sender ENUM('user', 'bot') NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    sender VARCHAR(255) NOT NULL,
     message TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    persona VARCHAR(64),
+    prompt_version INT NULL,
+    model VARCHAR(128),
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    turn_id VARCHAR(32),
+    seq INT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'complete',
+    error VARCHAR(255),
+    parent_id INT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    INDEX idx_conversation_history_user_id (user_id),
+    INDEX idx_conversation_history_turn_id (turn_id),
+    INDEX idx_conversation_history_parent_id (parent_id),
+    UNIQUE INDEX idx_conversation_history_user_seq (user_id, seq),
+    FULLTEXT INDEX ft_conversation_history (message) WITH PARSER ngram,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS message_feedback (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating VARCHAR(8) NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_message_feedback_message_id (message_id),
+    INDEX idx_message_feedback_user_id (user_id),
+    FOREIGN KEY (message_id) REFERENCES conversation_history(id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS moderation_flags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,
+    client_ip VARCHAR(45),
+    request_id VARCHAR(64),
+    message_id INT NULL,
+    direction VARCHAR(8) NOT NULL,
+    check_name VARCHAR(32) NOT NULL,
+    category VARCHAR(64) NOT NULL,
+    action VARCHAR(8) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_moderation_flags_user_id (user_id),
+    INDEX idx_moderation_flags_message_id (message_id),
+    INDEX idx_moderation_flags_created_at (created_at),
+    FOREIGN KEY (message_id) REFERENCES conversation_history(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,
+    client_ip VARCHAR(45),
+    message_id INT NULL,
+    model VARCHAR(64),
+    calls INT NOT NULL DEFAULT 1,
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    cost DOUBLE NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ai_usage_user_created (user_id, created_at),
+    INDEX idx_ai_usage_client_created (client_ip, created_at),
+    INDEX idx_ai_usage_message_id (message_id),
+    INDEX idx_ai_usage_created_at (created_at),
+    FOREIGN KEY (message_id) REFERENCES conversation_history(id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tool_invocations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    message_id INT NULL,
+    round INT NOT NULL,
+    tool VARCHAR(64) NOT NULL,
+    arguments TEXT,
+    result TEXT,
+    error VARCHAR(255),
+    duration_ms BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tool_invocations_user_id (user_id),
+    INDEX idx_tool_invocations_message_id (message_id)
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    source VARCHAR(512),
+    format VARCHAR(16) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    chunks INT NOT NULL DEFAULT 0,
+    embedding_model VARCHAR(128),
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_documents_checksum (checksum)
+);
+
+CREATE TABLE IF NOT EXISTS document_chunks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    document_id INT NOT NULL,
+    position INT NOT NULL,
+    content TEXT NOT NULL,
+    model VARCHAR(128),
+    embedding BLOB,
+    INDEX idx_document_chunks_document_id (document_id),
+    INDEX idx_document_chunks_model (model),
+    FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    actor_id INT,
+    actor VARCHAR(255),
+    action VARCHAR(32) NOT NULL,
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id VARCHAR(64) NOT NULL,
+    changes TEXT,
+    request_id VARCHAR(64),
+    ip VARCHAR(64),
+    INDEX idx_audit_log_created_at (created_at),
+    INDEX idx_audit_log_actor (actor),
+    INDEX idx_audit_resource (resource_type, resource_id)
+);
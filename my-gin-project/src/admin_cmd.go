@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"my-gin-project/src/controllers"
+	"my-gin-project/src/models"
+)
+
+// runBootstrapAdmin exécute la sous-commande bootstrap-admin, qui nomme le premier administrateur,
+// et renvoie le code de sortie : 0 si le compte a été promu, 1 s'il a été refusé, 2 si la configuration est invalide.
+func runBootstrapAdmin(args []string) int {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	username := fs.String("user", "", "compte existant, avec une adresse email vérifiée, à nommer administrateur (obligatoire)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *username == "" {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := models.InitDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 2
+	}
+	user, err := controllers.BootstrapAdmin(db, *username)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot promote", *username+":", err)
+		return 1
+	}
+	fmt.Printf("%s (id %d) is now an admin\n", user.Username, user.ID)
+	return 0
+}
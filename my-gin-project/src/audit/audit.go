@@ -0,0 +1,138 @@
+// Package audit enregistre les modifications de données dans la table audit_log.
+//
+// Les entrées doivent être écrites avec la transaction qui porte la modification,
+// afin que le journal et les données restent cohérents.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Meta décrit l'auteur et le contexte de la requête à l'origine d'une modification
+type Meta struct {
+	ActorID   uint
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+// Change est la valeur d'un champ avant et après modification
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Event est une modification à enregistrer
+type Event struct {
+	Action       string
+	ResourceType string
+	ResourceID   interface{}
+	// Before et After sont les états de la ressource (nil pour une création ou une suppression)
+	Before interface{}
+	After  interface{}
+}
+
+const redacted = "[redacted]"
+
+// Record écrit une entrée d'audit dans la transaction tx
+func Record(tx *gorm.DB, meta Meta, event Event) error {
+	return RecordMany(tx, meta, []Event{event})
+}
+
+// RecordMany écrit plusieurs entrées d'audit en une seule insertion
+func RecordMany(tx *gorm.DB, meta Meta, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	logs := make([]models.AuditLog, 0, len(events))
+	for _, e := range events {
+		changes, err := Diff(e.Before, e.After)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		logs = append(logs, models.AuditLog{
+			ActorID:      meta.ActorID,
+			Actor:        meta.Actor,
+			Action:       e.Action,
+			ResourceType: e.ResourceType,
+			ResourceID:   fmt.Sprint(e.ResourceID),
+			Changes:      data,
+			RequestID:    meta.RequestID,
+			IP:           meta.IP,
+		})
+	}
+	return tx.CreateInBatches(&logs, 100).Error
+}
+
+// Diff compare les représentations JSON de before et after et renvoie les champs modifiés.
+// Les champs sensibles (mots de passe, secrets) sont masqués.
+func Diff(before, after interface{}) (map[string]Change, error) {
+	b, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			changes[k] = Change{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: av}
+		}
+	}
+	for k, c := range changes {
+		if sensitive(k) {
+			if c.Before != nil {
+				c.Before = redacted
+			}
+			if c.After != nil {
+				c.After = redacted
+			}
+			changes[k] = c
+		}
+	}
+	return changes, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return out, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func sensitive(field string) bool {
+	f := strings.ToLower(field)
+	for _, s := range []string{"password", "secret", "token", "hash"} {
+		if strings.Contains(f, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Package config lit la configuration de l'application depuis les variables d'environnement.
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// String renvoie la variable d'environnement key, ou def si elle n'est pas définie
+func String(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Int renvoie la variable d'environnement key convertie en entier, ou def si elle est absente ou invalide
+func Int(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// Float renvoie la variable d'environnement key convertie en nombre, ou def si elle est absente ou invalide
+func Float(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// Bool renvoie la variable d'environnement key convertie en booléen, ou def si elle est absente ou invalide
+func Bool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// Duration renvoie la variable d'environnement key (ex: "30s", "5m"), ou def si elle est absente ou invalide
+func Duration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
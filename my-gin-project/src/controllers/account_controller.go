@@ -0,0 +1,551 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/mailer"
+	"my-gin-project/src/models"
+	"my-gin-project/src/password"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+type TokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"thomas@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// PasswordConfirmation confirme une action sensible. Un compte sans mot de passe, créé par un fournisseur
+// externe, n'en envoie pas : il confirme en se reconnectant auprès du fournisseur juste avant l'action.
+type PasswordConfirmation struct {
+	Password string `json:"password"`
+}
+
+func (c *Controller) mailer() mailer.Mailer {
+	if c.Mailer != nil {
+		return c.Mailer
+	}
+	return mailer.NewLogMailer(os.Stdout)
+}
+
+var (
+	defaultPasswordHasher = password.DefaultHasher()
+	defaultPasswordPolicy = password.DefaultPolicy()
+)
+
+func (c *Controller) passwordHasher() *password.Hasher {
+	if c.PasswordHasher != nil {
+		return c.PasswordHasher
+	}
+	return defaultPasswordHasher
+}
+
+func (c *Controller) passwordPolicy() *password.Policy {
+	if c.PasswordPolicy != nil {
+		return c.PasswordPolicy
+	}
+	return defaultPasswordPolicy
+}
+
+// checkPassword vérifie le mot de passe de user. Si le hash utilise un algorithme ou un coût
+// dépassé, il est recalculé avec la configuration courante, de façon transparente.
+func (c *Controller) checkPassword(user *models.User, plain string) bool {
+	ok, rehash, err := c.passwordHasher().Verify(user.Password, plain)
+	if err != nil {
+		fmt.Println("[ERROR] Vérification du mot de passe:", err)
+		return false
+	}
+	if ok && rehash {
+		hash, err := c.passwordHasher().Hash(plain)
+		if err == nil {
+			err = models.DB.Model(user).UpdateColumn("password", hash).Error
+		}
+		if err != nil {
+			fmt.Println("[ERROR] Mise à jour du hash du mot de passe:", err)
+		} else {
+			user.Password = hash
+		}
+	}
+	return ok
+}
+
+// normalizeEmail met l'adresse en minuscules ; une adresse vide devient nil
+func normalizeEmail(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	e := strings.ToLower(strings.TrimSpace(*email))
+	if e == "" {
+		return nil
+	}
+	return &e
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken crée un jeton à usage unique et renvoie sa valeur en clair, qui n'est pas conservée
+func issueToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(b)
+	err := tx.Create(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(plain),
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error
+	return plain, err
+}
+
+// consumeToken valide un jeton et le marque comme utilisé ; un jeton ne peut servir qu'une fois
+func consumeToken(tx *gorm.DB, plain, purpose string) (models.UserToken, error) {
+	var token models.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(plain), purpose).First(&token).Error; err != nil {
+		return token, errInvalidToken
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return token, errInvalidToken
+	}
+	// La condition sur used_at protège contre deux utilisations concurrentes
+	res := tx.Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", time.Now())
+	if res.Error != nil {
+		return token, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return token, errInvalidToken
+	}
+	return token, nil
+}
+
+func appURL(path string) string {
+	return strings.TrimRight(config.String("APP_URL", "http://localhost:8080"), "/") + path
+}
+
+// sendVerificationEmail envoie le lien de vérification de l'adresse de user
+func (c *Controller) sendVerificationEmail(user models.User) error {
+	if user.Email == nil {
+		return nil
+	}
+	token, err := issueToken(models.DB, user.ID, models.TokenEmailVerification, config.Duration("EMAIL_VERIFICATION_TTL", 48*time.Hour))
+	if err != nil {
+		return err
+	}
+	return c.mailer().Send(mailer.Message{
+		To:      *user.Email,
+		Subject: "Confirmez votre adresse email",
+		Body: fmt.Sprintf("Bonjour %s,\n\nConfirmez votre adresse email en ouvrant ce lien :\n%s\n\nCode de vérification : %s\n",
+			user.Username, appURL("/email/verify?token="+token), token),
+	})
+}
+
+// POST /email/verify - confirmer une adresse email
+// @Summary Verify email address
+// @Description Confirm the email address of an account with the token sent by email
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param token body TokenRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /email/verify [post]
+func (c *Controller) VerifyEmail(ctx *gin.Context) {
+	var req TokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeToken(tx, req.Token, models.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return errInvalidToken
+		}
+		before := user
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "user", ResourceID: user.ID, Before: before, After: user,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": errInvalidToken.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// POST /me/email/verification - renvoyer l'email de vérification
+// @Summary Resend verification email
+// @Description Send a new verification link to the email address of the current user
+// @Tags account
+// @Produce json
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/email/verification [post]
+func (c *Controller) ResendVerificationEmail(ctx *gin.Context) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Email == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No email address"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+	if err := c.sendVerificationEmail(user); err != nil {
+		fmt.Println("[ERROR] Envoi de l'email de vérification:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// POST /password/forgot - demander la réinitialisation du mot de passe
+// @Summary Forgot password
+// @Description Send a single-use password reset link to the given email address, if it has been verified.
+// @Description The response is the same whether or not the address is known.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Email address"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /password/forgot [post]
+func (c *Controller) ForgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	email := normalizeEmail(&req.Email)
+	// Seule une adresse vérifiée reçoit le lien : une adresse saisie à l'inscription sans preuve ne donne pas accès au compte
+	err := models.DB.Where("email = ? AND email_verified_at IS NOT NULL AND deactivated_at IS NULL", *email).First(&user).Error
+	if err == nil {
+		if err := c.sendPasswordResetEmail(user); err != nil {
+			fmt.Println("[ERROR] Envoi de l'email de réinitialisation:", err)
+		}
+	}
+
+	// Même réponse que l'adresse soit connue ou non
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "If this address is registered, a reset link has been sent"})
+}
+
+// sendPasswordResetEmail envoie à user un lien de réinitialisation de son mot de passe
+func (c *Controller) sendPasswordResetEmail(user models.User) error {
+	token, err := issueToken(models.DB, user.ID, models.TokenPasswordReset, config.Duration("PASSWORD_RESET_TTL", time.Hour))
+	if err != nil {
+		return err
+	}
+	return c.mailer().Send(mailer.Message{
+		To:      *user.Email,
+		Subject: "Réinitialisation de votre mot de passe",
+		Body: fmt.Sprintf("Bonjour %s,\n\nPour choisir un nouveau mot de passe, ouvrez ce lien :\n%s\n\nCode de réinitialisation : %s\n\nSi vous n'êtes pas à l'origine de cette demande, ignorez cet email.\n",
+			user.Username, appURL("/password/reset?token="+token), token),
+	})
+}
+
+// POST /password/reset - choisir un nouveau mot de passe
+// @Summary Reset password
+// @Description Set a new password with a single-use reset token. Every session of the account is revoked.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /password/reset [post]
+func (c *Controller) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeToken(tx, req.Token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return errInvalidToken
+		}
+		if err := c.setPassword(tx, ctx, &user, req.Password); err != nil {
+			return err
+		}
+		// Le mot de passe a pu être compromis : toutes les sessions ouvertes sont fermées
+		if _, err := revokeSessions(tx, ctx, user.ID, ""); err != nil {
+			return err
+		}
+		// Les autres liens de réinitialisation en attente deviennent inutilisables
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenPasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidToken) || password.IsPolicyError(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if c.LoginLockout != nil {
+		c.LoginLockout.Succeed(user.Username)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// setPassword vérifie la politique, hache et enregistre le nouveau mot de passe de user, avec son entrée d'audit
+func (c *Controller) setPassword(tx *gorm.DB, ctx *gin.Context, user *models.User, plain string) error {
+	if err := c.passwordPolicy().Validate(plain, user.Username); err != nil {
+		return err
+	}
+	hash, err := c.passwordHasher().Hash(plain)
+	if err != nil {
+		return err
+	}
+	before := *user
+	user.Password = hash
+	return saveUser(tx, ctx, &before, user)
+}
+
+// PUT /me/password - changer son mot de passe
+// @Summary Change password
+// @Description Change the password of the current user; the current password is required. The other sessions of the account are revoked.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body ChangePasswordRequest true "Current and new passwords"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/password [put]
+func (c *Controller) ChangePassword(ctx *gin.Context) {
+	var req ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if !c.checkPassword(&user, req.OldPassword) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := c.setPassword(tx, ctx, &user, req.NewPassword); err != nil {
+			return err
+		}
+		// Les autres sessions sont fermées ; celle qui a changé le mot de passe reste ouverte
+		_, err := revokeSessions(tx, ctx, user.ID, ctx.GetString(ContextSessionID))
+		return err
+	})
+	if password.IsPolicyError(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// POST /me/deactivate - désactiver son compte
+// @Summary Deactivate account
+// @Description Deactivate the current account; it can no longer log in. The password is required;
+// @Description an account without password (created by a login provider) must have signed in again within the last 5 minutes instead.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body PasswordConfirmation false "Current password, omitted for an account without password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/deactivate [post]
+func (c *Controller) DeactivateAccount(ctx *gin.Context) {
+	user, ok := c.confirmedUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		now := time.Now()
+		user.DeactivatedAt = &now
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "user", ResourceID: user.ID, Before: before, After: user,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// DELETE /me - supprimer son compte
+// @Summary Delete account
+// @Description Permanently delete the current account and its conversation history. The password is required;
+// @Description an account without password (created by a login provider) must have signed in again within the last 5 minutes instead.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body PasswordConfirmation false "Current password, omitted for an account without password"
+// @Success 204 {object} nil
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me [delete]
+func (c *Controller) DeleteAccount(ctx *gin.Context) {
+	user, ok := c.confirmedUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.ConversationHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.ToolInvocation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MessageFeedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.ModerationFlag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AIUsage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionDelete, ResourceType: "user", ResourceID: user.ID, Before: user,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// confirmedUser charge l'utilisateur courant après vérification du mot de passe de la requête.
+// En cas d'échec, la réponse est déjà écrite.
+// Un compte sans mot de passe doit à la place présenter une session ouverte depuis moins de REAUTH_MAX_AGE.
+func (c *Controller) confirmedUser(ctx *gin.Context) (models.User, bool) {
+	var req PasswordConfirmation
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return models.User{}, false
+	}
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if user.Password == "" {
+		if !recentLogin(ctx, user) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Recent login required: sign in again with your provider to confirm"})
+			return user, false
+		}
+		return user, true
+	}
+	if req.Password == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return user, false
+	}
+	if !c.checkPassword(&user, req.Password) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return user, false
+	}
+	return user, true
+}
+
+// recentLogin indique si la session de la requête a été ouverte depuis moins de REAUTH_MAX_AGE (5 minutes
+// par défaut) : elle prouve alors que l'utilisateur vient de s'authentifier
+func recentLogin(ctx *gin.Context, user models.User) bool {
+	var session models.Session
+	err := models.DB.Where("id = ? AND user_id = ?", ctx.GetString(ContextSessionID), user.ID).First(&session).Error
+	return err == nil && time.Since(session.CreatedAt) <= config.Duration("REAUTH_MAX_AGE", 5*time.Minute)
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/mailer"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var codeRe = regexp.MustCompile(`Code de (?:vérification|réinitialisation) : (\S+)`)
+
+// lastCode renvoie le dernier jeton envoyé par email
+func lastCode(t *testing.T, mails *bytes.Buffer) string {
+	t.Helper()
+	matches := codeRe.FindAllStringSubmatch(mails.String(), -1)
+	if len(matches) == 0 {
+		t.Fatalf("No token found in emails: %s", mails.String())
+	}
+	return matches[len(matches)-1][1]
+}
+
+func setupAccountRouter(mails *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{Mailer: mailer.NewLogMailer(mails)}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	r.POST("/email/verify", ctrl.VerifyEmail)
+	r.POST("/password/forgot", ctrl.ForgotPassword)
+	r.POST("/password/reset", ctrl.ResetPassword)
+	auth := r.Group("/", AuthMiddleware())
+	auth.PUT("/me/password", ctrl.ChangePassword)
+	auth.POST("/me/deactivate", ctrl.DeactivateAccount)
+	auth.DELETE("/me", ctrl.DeleteAccount)
+	return r
+}
+
+func sendJSON(router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestEmailVerification(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+
+	resp := sendJSON(router, "POST", "/register", "", map[string]string{"username": "alice", "password": "password", "email": "Alice@Example.com"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	code := lastCode(t, &mails)
+
+	if resp := sendJSON(router, "POST", "/email/verify", "", map[string]string{"token": "nope"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown token, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/email/verify", "", map[string]string{"token": code}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// Usage unique
+	if resp := sendJSON(router, "POST", "/email/verify", "", map[string]string{"token": code}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when reusing a token, got %d", resp.Code)
+	}
+
+	var user models.User
+	models.DB.Where("username = ?", "alice").First(&user)
+	if user.Email == nil || *user.Email != "alice@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+	sendJSON(router, "POST", "/register", "", map[string]string{"username": "alice", "password": "password", "email": "alice@example.com"})
+	token := loginToken(t, router, "alice", "password")
+	mails.Reset()
+
+	// Adresse non vérifiée : même réponse, aucun email
+	if resp := sendJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "alice@example.com"}); resp.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", resp.Code)
+	}
+	if mails.Len() != 0 {
+		t.Errorf("Expected no email to an unverified address, got %s", mails.String())
+	}
+	models.DB.Model(&models.User{}).Where("username = ?", "alice").Update("email_verified_at", time.Now())
+
+	// Adresse inconnue : même réponse, aucun email
+	if resp := sendJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "bob@example.com"}); resp.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", resp.Code)
+	}
+	if mails.Len() != 0 {
+		t.Errorf("Expected no email, got %s", mails.String())
+	}
+
+	sendJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "ALICE@example.com"})
+	first := lastCode(t, &mails)
+	sendJSON(router, "POST", "/password/forgot", "", map[string]string{"email": "alice@example.com"})
+	second := lastCode(t, &mails)
+
+	if resp := sendJSON(router, "POST", "/password/reset", "", map[string]string{"token": second, "password": "n3w-password"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// Les autres liens en attente sont invalidés
+	if resp := sendJSON(router, "POST", "/password/reset", "", map[string]string{"token": first, "password": "another-passphrase"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a superseded token, got %d", resp.Code)
+	}
+	// Les sessions ouvertes avec l'ancien mot de passe sont révoquées
+	if resp := sendJSON(router, "PUT", "/me/password", token, map[string]string{"old_password": "n3w-password", "new_password": "n3w-passphrase"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the previous session to be revoked, got %d", resp.Code)
+	}
+
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be rejected, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "n3w-password"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected login with the new password, got %d", resp.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+	token := loginToken(t, router, "alice", "password")
+	other := loginToken(t, router, "alice", "password")
+
+	if resp := sendJSON(router, "PUT", "/me/password", token, map[string]string{"old_password": "wrong", "new_password": "n3w-passphrase"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong password, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", "/me/password", token, map[string]string{"old_password": "password", "new_password": "n3w"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a password below the policy, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", "/me/password", token, map[string]string{"old_password": "password", "new_password": "n3w-passphrase"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "n3w-passphrase"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected login with the new password, got %d", resp.Code)
+	}
+
+	// La session qui a changé le mot de passe reste ouverte, les autres sont révoquées
+	if resp := sendJSON(router, "PUT", "/me/password", other, map[string]string{"old_password": "n3w-passphrase", "new_password": "an0ther-passphrase"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the other session to be revoked, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", "/me/password", token, map[string]string{"old_password": "n3w-passphrase", "new_password": "an0ther-passphrase"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected the current session to stay open, got %d", resp.Code)
+	}
+}
+
+func TestAccountLifecycle(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+	token := loginToken(t, router, "alice", "password")
+
+	if resp := sendJSON(router, "POST", "/me/deactivate", token, map[string]string{"password": "password"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a deactivated account, got %d", resp.Code)
+	}
+
+	token = loginToken(t, router, "bob", "password")
+	var bob models.User
+	models.DB.Where("username = ?", "bob").First(&bob)
+	models.DB.Create(&models.ConversationHistory{UserID: bob.ID, Sender: "bob", Message: "Bonjour"})
+
+	if resp := sendJSON(router, "DELETE", "/me", token, map[string]string{"password": "wrong"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong password, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "DELETE", "/me", token, map[string]string{"password": "password"}); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var users, history int64
+	models.DB.Model(&models.User{}).Where("username = ?", "bob").Count(&users)
+	models.DB.Model(&models.ConversationHistory{}).Where("user_id = ?", bob.ID).Count(&history)
+	if users != 0 || history != 0 {
+		t.Errorf("Expected user and history to be deleted, got %d users and %d messages", users, history)
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+
+	for _, pw := range []string{"", "short", "xxalice-2024"} {
+		resp := sendJSON(router, "POST", "/register", "", map[string]string{"username": "alice", "password": pw})
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", pw, resp.Code)
+		}
+	}
+}
+
+func TestLoginRehashesOutdatedHash(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAccountRouter(&mails)
+
+	// Compte créé avant le passage à argon2id
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	models.DB.Create(&models.User{Username: "alice", Password: string(legacy), Role: models.RoleUser})
+
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.Code)
+	}
+	var user models.User
+	models.DB.Where("username = ?", "alice").First(&user)
+	if !strings.HasPrefix(user.Password, "$argon2id$") {
+		t.Fatalf("Expected the hash to be upgraded to argon2id, got %q", user.Password)
+	}
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected login with the upgraded hash, got %d", resp.Code)
+	}
+}
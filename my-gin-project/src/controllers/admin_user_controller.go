@@ -0,0 +1,569 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+	"my-gin-project/src/password"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Statuts des comptes dans l'administration des utilisateurs
+const (
+	UserStatusActive      = "active"
+	UserStatusDisabled    = "disabled"
+	UserStatusDeactivated = "deactivated"
+)
+
+// AdminUser est la vue d'un compte pour les administrateurs, sans mot de passe ni secret
+type AdminUser struct {
+	ID              uint       `json:"id" example:"12"`
+	Username        string     `json:"username" example:"thomas"`
+	Email           *string    `json:"email" example:"thomas@example.com"`
+	Role            string     `json:"role" example:"user"`
+	Status          string     `json:"status" example:"active"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TwoFactor       bool       `json:"two_factor"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastLoginAt     *time.Time `json:"last_login_at"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	DisabledReason  string     `json:"disabled_reason,omitempty"`
+	DeactivatedAt   *time.Time `json:"deactivated_at"`
+	// Quotas de tokens de l'assistant IA propres au compte (null : quotas du rôle, 0 : pas de limite)
+	DailyTokenQuota   *int64 `json:"daily_token_quota" example:"50000"`
+	MonthlyTokenQuota *int64 `json:"monthly_token_quota" example:"1000000"`
+}
+
+// AdminUserDetail complète AdminUser avec les comptes liés et les accès en cours
+type AdminUserDetail struct {
+	AdminUser
+	// Providers liste les fournisseurs OpenID Connect liés au compte
+	Providers      []string `json:"providers"`
+	ActiveSessions int64    `json:"active_sessions"`
+	ActiveAPIKeys  int64    `json:"active_api_keys"`
+}
+
+type AdminUserList struct {
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Users    []AdminUser `json:"users"`
+}
+
+type DisableUserRequest struct {
+	Reason string `json:"reason" example:"Fraude à la réservation"`
+}
+
+type AdminPasswordResetRequest struct {
+	// Nouveau mot de passe ; si absent, un lien de réinitialisation est envoyé à l'utilisateur
+	Password string `json:"password"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role" binding:"required" example:"admin"`
+}
+
+func newAdminUser(user models.User) AdminUser {
+	status := UserStatusActive
+	switch {
+	case user.DisabledAt != nil:
+		status = UserStatusDisabled
+	case user.DeactivatedAt != nil:
+		status = UserStatusDeactivated
+	}
+	return AdminUser{
+		ID:                user.ID,
+		Username:          user.Username,
+		Email:             user.Email,
+		Role:              user.Role,
+		Status:            status,
+		EmailVerifiedAt:   user.EmailVerifiedAt,
+		TwoFactor:         user.TOTPEnabledAt != nil,
+		CreatedAt:         user.CreatedAt,
+		LastLoginAt:       user.LastLoginAt,
+		DisabledAt:        user.DisabledAt,
+		DisabledReason:    user.DisabledReason,
+		DeactivatedAt:     user.DeactivatedAt,
+		DailyTokenQuota:   user.DailyTokenQuota,
+		MonthlyTokenQuota: user.MonthlyTokenQuota,
+	}
+}
+
+// targetUser charge l'utilisateur désigné par le paramètre :id. En cas d'échec, la réponse est déjà écrite.
+func targetUser(ctx *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return user, false
+	}
+	if err := models.DB.First(&user, id).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// notSelf refuse qu'un administrateur applique l'action à son propre compte, pour ne pas s'enfermer dehors
+func notSelf(ctx *gin.Context, user models.User) bool {
+	if user.ID == ctx.GetUint(ContextUserID) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Not allowed on your own account"})
+		return false
+	}
+	return true
+}
+
+// revokeSessions révoque les sessions actives de l'utilisateur userID, sauf la session keep (vide : toutes),
+// avec leur entrée d'audit
+func revokeSessions(tx *gorm.DB, ctx *gin.Context, userID uint, keep string) (int, error) {
+	var sessions []models.Session
+	if err := tx.Where("user_id = ? AND id <> ? AND revoked_at IS NULL AND expires_at > ?", userID, keep, time.Now()).Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	ids := make([]string, len(sessions))
+	events := make([]audit.Event, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+		before := session
+		session.RevokedAt = &now
+		events[i] = audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "session", ResourceID: session.ID, Before: before, After: session,
+		}
+	}
+	if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+		return 0, err
+	}
+	return len(sessions), audit.RecordMany(tx, auditMeta(ctx), events)
+}
+
+// GET /admin/users - lister les utilisateurs
+// @Summary List users
+// @Description Search users by username or email, filtered by role and status (admin only)
+// @Tags admin
+// @Produce json
+// @Param q query string false "Username or email contains"
+// @Param role query string false "user or admin"
+// @Param status query string false "active, disabled or deactivated"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Users per page (max 200)"
+// @Success 200 {object} AdminUserList
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users [get]
+func (c *Controller) GetUsers(ctx *gin.Context) {
+	query := models.DB.Model(&models.User{})
+	if q := strings.TrimSpace(ctx.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(username) LIKE ? OR email LIKE ?", like, like)
+	}
+	if role := ctx.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch ctx.Query("status") {
+	case "":
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL AND deactivated_at IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	case UserStatusDeactivated:
+		query = query.Where("disabled_at IS NULL AND deactivated_at IS NOT NULL")
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	page, size := pagination(ctx)
+	resp := AdminUserList{Page: page, PageSize: size, Users: []AdminUser{}}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	var users []models.User
+	if err := query.Order("id").Limit(size).Offset((page - 1) * size).Find(&users).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, newAdminUser(user))
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// GET /admin/users/:id - consulter un utilisateur
+// @Summary Get a user
+// @Description Profile of a user with linked providers, active sessions and API keys (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} AdminUserDetail
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id} [get]
+func (c *Controller) GetUser(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	detail := AdminUserDetail{AdminUser: newAdminUser(user), Providers: []string{}}
+	err := models.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Order("provider").Pluck("provider", &detail.Providers).Error
+	if err == nil {
+		err = models.DB.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, now).Count(&detail.ActiveSessions).Error
+	}
+	if err == nil {
+		err = models.DB.Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", user.ID, now).Count(&detail.ActiveAPIKeys).Error
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// GET /admin/users/:id/sessions - lister les sessions d'un utilisateur
+// @Summary List user sessions
+// @Description Sessions opened by a user (one per login), most recent first (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Param include_inactive query bool false "Include revoked and expired sessions"
+// @Success 200 {array} models.Session
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/sessions [get]
+func (c *Controller) GetUserSessions(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	query := models.DB.Where("user_id = ?", user.ID).Order("created_at desc")
+	if ctx.Query("include_inactive") != "true" {
+		query = query.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+	sessions := []models.Session{}
+	if err := query.Find(&sessions).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// DELETE /admin/users/:id/sessions - déconnecter un utilisateur
+// @Summary Revoke user sessions
+// @Description Revoke every active session of a user; their tokens are refused immediately (admin only)
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204 {object} nil
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/sessions [delete]
+func (c *Controller) RevokeUserSessions(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := revokeSessions(tx, ctx, user.ID, "")
+		return err
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GET /admin/users/:id/activity - activité d'un utilisateur
+// @Summary Get user activity
+// @Description Audit log entries written by the user or about the user's account, most recent first (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Entries per page (max 200)"
+// @Success 200 {object} AuditResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/activity [get]
+func (c *Controller) GetUserActivity(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	query := models.DB.Model(&models.AuditLog{}).
+		Where("actor_id = ? OR (resource_type = ? AND resource_id = ?)", user.ID, "user", fmt.Sprint(user.ID))
+
+	page, size := pagination(ctx)
+	resp := AuditResponse{Page: page, PageSize: size, Entries: []models.AuditLog{}}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	err := query.Order("created_at desc, id desc").Limit(size).Offset((page - 1) * size).Find(&resp.Entries).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// POST /admin/users/:id/disable - suspendre un compte
+// @Summary Disable a user
+// @Description Suspend an account: its sessions are revoked and its tokens and API keys are refused immediately (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body DisableUserRequest false "Reason"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/disable [post]
+func (c *Controller) DisableUser(ctx *gin.Context) {
+	var req DisableUserRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	user, ok := targetUser(ctx)
+	if !ok || !notSelf(ctx, user) {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if user.DisabledAt == nil {
+			before := user
+			now := time.Now()
+			user.DisabledAt = &now
+			user.DisabledReason = truncate(strings.TrimSpace(req.Reason), 255)
+			if err := saveUser(tx, ctx, &before, &user); err != nil {
+				return err
+			}
+		}
+		_, err := revokeSessions(tx, ctx, user.ID, "")
+		return err
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+		return
+	}
+	ctx.JSON(http.StatusOK, newAdminUser(user))
+}
+
+// POST /admin/users/:id/enable - réactiver un compte
+// @Summary Enable a user
+// @Description Lift the suspension of an account, or reactivate an account deactivated by its owner (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/enable [post]
+func (c *Controller) EnableUser(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	if user.DisabledAt == nil && user.DeactivatedAt == nil {
+		ctx.JSON(http.StatusOK, newAdminUser(user))
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		user.DisabledAt, user.DisabledReason, user.DeactivatedAt = nil, "", nil
+		return saveUser(tx, ctx, &before, &user)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+		return
+	}
+	ctx.JSON(http.StatusOK, newAdminUser(user))
+}
+
+// POST /admin/users/:id/password-reset - réinitialiser le mot de passe d'un utilisateur
+// @Summary Reset a user's password
+// @Description Set a new password, or without password send a reset link to the user's email address.
+// @Description In both cases the user's sessions are revoked (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body AdminPasswordResetRequest false "New password"
+// @Success 200 {object} map[string]string
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/password-reset [post]
+func (c *Controller) AdminResetPassword(ctx *gin.Context) {
+	var req AdminPasswordResetRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	if req.Password == "" && user.Email == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User has no email address, a password is required"})
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Password != "" {
+			if err := c.setPassword(tx, ctx, &user, req.Password); err != nil {
+				return err
+			}
+		}
+		_, err := revokeSessions(tx, ctx, user.ID, "")
+		return err
+	})
+	if password.IsPolicyError(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if req.Password != "" {
+		if c.LoginLockout != nil {
+			c.LoginLockout.Succeed(user.Username)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+		return
+	}
+	if err := c.sendPasswordResetEmail(user); err != nil {
+		reportError(ctx, "Envoi de l'email de réinitialisation", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Reset link sent"})
+}
+
+// PUT /admin/users/:id/role - changer le rôle d'un utilisateur
+// @Summary Assign a role
+// @Description Change the role of a user; administrators cannot change their own role (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body RoleRequest true "Role"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/role [put]
+func (c *Controller) SetUserRole(ctx *gin.Context) {
+	var req RoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !slices.Contains(models.Roles, req.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role " + req.Role})
+		return
+	}
+	user, ok := targetUser(ctx)
+	if !ok || !notSelf(ctx, user) {
+		return
+	}
+	if user.Role == req.Role {
+		ctx.JSON(http.StatusOK, newAdminUser(user))
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		user.Role = req.Role
+		return saveUser(tx, ctx, &before, &user)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	ctx.JSON(http.StatusOK, newAdminUser(user))
+}
+
+// BootstrapAdmin donne le rôle admin au compte username quand la base n'a encore aucun administrateur.
+// Le compte doit exister, être actif et avoir une adresse email vérifiée : un nom d'utilisateur seul ne
+// prouve rien, puisque n'importe qui peut s'inscrire sous ce nom. Les administrateurs suivants sont
+// nommés par PUT /admin/users/:id/role, qui est audité et qu'une rétrogradation ne peut pas contourner.
+func BootstrapAdmin(db *gorm.DB, username string) (models.User, error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins > 0 {
+			return errors.New("an admin account already exists: use PUT /admin/users/:id/role")
+		}
+		if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+			return fmt.Errorf("user %q not found: %w", username, err)
+		}
+		if reason := accountBlocked(user); reason != "" {
+			return errors.New(reason)
+		}
+		if user.EmailVerifiedAt == nil {
+			return fmt.Errorf("user %q has not verified an email address", username)
+		}
+		before := user
+		user.Role = models.RoleAdmin
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Meta{Actor: "bootstrap-admin"}, audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "user", ResourceID: user.ID, Before: before, After: user,
+		})
+	})
+	return user, err
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/mailer"
+	"my-gin-project/src/models"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAdminUserRouter(mails *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{Mailer: mailer.NewLogMailer(mails)}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	auth := r.Group("/", AuthMiddleware())
+	auth.GET("/items", ctrl.GetItems)
+	users := auth.Group("/admin/users", RequireRole(models.RoleAdmin), RequireUserSession())
+	users.GET("", ctrl.GetUsers)
+	users.GET("/:id", ctrl.GetUser)
+	users.GET("/:id/sessions", ctrl.GetUserSessions)
+	users.DELETE("/:id/sessions", ctrl.RevokeUserSessions)
+	users.GET("/:id/activity", ctrl.GetUserActivity)
+	users.POST("/:id/disable", ctrl.DisableUser)
+	users.POST("/:id/enable", ctrl.EnableUser)
+	users.POST("/:id/password-reset", ctrl.AdminResetPassword)
+	users.PUT("/:id/role", ctrl.SetUserRole)
+	return r
+}
+
+// adminAndUser crée un administrateur et l'utilisateur alice, et renvoie leurs tokens et l'ID d'alice
+func adminAndUser(t *testing.T, router *gin.Engine) (string, string, string) {
+	t.Helper()
+	adminToken := loginToken(t, router, "admin", "password")
+	models.DB.Model(&models.User{}).Where("username = ?", "admin").Update("role", models.RoleAdmin)
+	userToken := loginToken(t, router, "alice", "password")
+	var alice models.User
+	models.DB.Where("username = ?", "alice").First(&alice)
+	return adminToken, userToken, strconv.Itoa(int(alice.ID))
+}
+
+func TestAdminListUsers(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAdminUserRouter(&mails)
+	adminToken, userToken, _ := adminAndUser(t, router)
+	sendJSON(router, "POST", "/register", "", map[string]string{"username": "bob", "password": "password", "email": "bob@example.com"})
+
+	if resp := sendJSON(router, "GET", "/admin/users", userToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", resp.Code)
+	}
+
+	resp := sendJSON(router, "GET", "/admin/users?q=BOB", adminToken, nil)
+	var list AdminUserList
+	json.Unmarshal(resp.Body.Bytes(), &list)
+	if resp.Code != http.StatusOK || list.Total != 1 || list.Users[0].Username != "bob" {
+		t.Fatalf("Unexpected search result: %d %s", resp.Code, resp.Body.String())
+	}
+	if bytes.Contains(resp.Body.Bytes(), []byte("password")) {
+		t.Errorf("Expected no password in the response: %s", resp.Body.String())
+	}
+
+	resp = sendJSON(router, "GET", "/admin/users?role=user&page_size=1&page=2", adminToken, nil)
+	json.Unmarshal(resp.Body.Bytes(), &list)
+	if list.Total != 2 || len(list.Users) != 1 || list.Users[0].Username != "bob" {
+		t.Errorf("Unexpected page: %s", resp.Body.String())
+	}
+	if resp := sendJSON(router, "GET", "/admin/users?status=banned", adminToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", resp.Code)
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAdminUserRouter(&mails)
+	adminToken, userToken, id := adminAndUser(t, router)
+
+	resp := sendJSON(router, "GET", "/admin/users/"+id, adminToken, nil)
+	var detail AdminUserDetail
+	json.Unmarshal(resp.Body.Bytes(), &detail)
+	if resp.Code != http.StatusOK || detail.ActiveSessions != 1 || detail.LastLoginAt == nil {
+		t.Fatalf("Unexpected user: %d %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := sendJSON(router, "POST", "/admin/users/"+id+"/disable", adminToken, map[string]string{"reason": "spam"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// Le token déjà délivré est refusé immédiatement
+	if resp := sendJSON(router, "GET", "/items", userToken, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a disabled account, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 on login, got %d", resp.Code)
+	}
+	var sessions []models.Session
+	json.Unmarshal(sendJSON(router, "GET", "/admin/users/"+id+"/sessions?include_inactive=true", adminToken, nil).Body.Bytes(), &sessions)
+	if len(sessions) != 1 || sessions[0].RevokedAt == nil || sessions[0].Method != "password" {
+		t.Errorf("Expected the session to be revoked, got %+v", sessions)
+	}
+
+	if resp := sendJSON(router, "POST", "/admin/users/"+id+"/enable", adminToken, nil); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.Code)
+	}
+	// La session révoquée le reste, une nouvelle connexion est nécessaire
+	if resp := sendJSON(router, "GET", "/items", userToken, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a revoked session, got %d", resp.Code)
+	}
+	userToken = loginToken(t, router, "alice", "password")
+	if resp := sendJSON(router, "GET", "/items", userToken, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected 200 after enabling, got %d", resp.Code)
+	}
+
+	var admin models.User
+	models.DB.Where("username = ?", "admin").First(&admin)
+	if resp := sendJSON(router, "POST", "/admin/users/"+strconv.Itoa(int(admin.ID))+"/disable", adminToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when disabling oneself, got %d", resp.Code)
+	}
+
+	resp = sendJSON(router, "GET", "/admin/users/"+id+"/activity", adminToken, nil)
+	var activity AuditResponse
+	json.Unmarshal(resp.Body.Bytes(), &activity)
+	if activity.Total < 2 {
+		t.Errorf("Expected the disable and enable entries, got %s", resp.Body.String())
+	}
+}
+
+func TestAdminResetPasswordAndRole(t *testing.T) {
+	setupTestDB()
+	var mails bytes.Buffer
+	router := setupAdminUserRouter(&mails)
+	adminToken, userToken, id := adminAndUser(t, router)
+
+	// Sans email, un mot de passe est nécessaire
+	if resp := sendJSON(router, "POST", "/admin/users/"+id+"/password-reset", adminToken, nil); resp.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without email, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/admin/users/"+id+"/password-reset", adminToken, map[string]string{"password": "short"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a weak password, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/admin/users/"+id+"/password-reset", adminToken, map[string]string{"password": "temporary-passphrase"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "GET", "/items", userToken, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected sessions to be revoked, got %d", resp.Code)
+	}
+	userToken = loginToken(t, router, "alice", "temporary-passphrase")
+
+	if resp := sendJSON(router, "PUT", "/admin/users/"+id+"/role", adminToken, map[string]string{"role": "root"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown role, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", "/admin/users/"+id+"/role", adminToken, map[string]string{"role": models.RoleAdmin}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "GET", "/admin/users", userToken, nil); resp.Code != http.StatusOK {
+		t.Errorf("Expected the promoted user to reach admin routes, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "GET", "/admin/users/999", adminToken, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.Code)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	setupTestDB()
+	verified := time.Now()
+	aliceEmail, bobEmail := "alice@example.com", "bob@example.com"
+	models.DB.Create(&models.User{Username: "mallory", Password: "x"})
+	models.DB.Create(&models.User{Username: "bob", Password: "x", Email: &bobEmail})
+	models.DB.Create(&models.User{Username: "alice", Password: "x", Email: &aliceEmail, EmailVerifiedAt: &verified})
+
+	for _, name := range []string{"nobody", "mallory", "bob"} {
+		if _, err := BootstrapAdmin(models.DB, name); err == nil {
+			t.Errorf("Expected %s not to be promoted", name)
+		}
+	}
+	alice, err := BootstrapAdmin(models.DB, "alice")
+	if err != nil || alice.Role != models.RoleAdmin {
+		t.Fatalf("Expected alice to be promoted, got %q (%v)", alice.Role, err)
+	}
+	var logs int64
+	models.DB.Model(&models.AuditLog{}).Where("resource_type = ? AND resource_id = ?", "user", strconv.Itoa(int(alice.ID))).Count(&logs)
+	if logs != 1 {
+		t.Errorf("Expected the promotion to be audited, got %d entries", logs)
+	}
+
+	// Une fois un administrateur nommé, la commande ne promeut plus personne
+	models.DB.Model(&models.User{}).Where("username = ?", "bob").Update("email_verified_at", verified)
+	if _, err := BootstrapAdmin(models.DB, "bob"); err == nil {
+		t.Error("Expected no promotion once an admin exists")
+	}
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APIKeyHeader est l'en-tête portant la clé d'API
+const APIKeyHeader = "X-API-Key"
+
+// Les clés ont la forme trv_<12 caractères hexadécimaux>_<secret> ; les 16 premiers caractères forment le préfixe
+const apiKeyPrefix = "trv_"
+
+// Fréquence maximale de mise à jour de last_used_at, pour ne pas écrire en base à chaque requête
+const apiKeyTouchInterval = time.Minute
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required" example:"Partenaire Voyages SA"`
+	// Utilisateur au nom duquel la clé agit (l'administrateur qui crée la clé par défaut)
+	UserID    uint       `json:"user_id" example:"12"`
+	Scopes    []string   `json:"scopes" binding:"required" example:"items:read"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2026-12-31T23:59:59Z"`
+}
+
+type APIKeyCreated struct {
+	models.APIKey
+	// Key n'est renvoyée qu'à la création
+	Key string `json:"key" example:"trv_0a1b2c3d4e5f_9yq3..."`
+}
+
+// generateAPIKey renvoie une nouvelle clé en clair et son préfixe
+func generateAPIKey() (string, string, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// authenticateAPIKey authentifie la requête par sa clé d'API et renseigne l'identité et les portées
+func authenticateAPIKey(ctx *gin.Context, plain string) {
+	prefix, _, _ := strings.Cut(strings.TrimPrefix(plain, apiKeyPrefix), "_")
+	var key models.APIKey
+	err := models.DB.Where("prefix = ?", apiKeyPrefix+prefix).Limit(1).Find(&key).Error
+	now := time.Now()
+	if err != nil || key.ID == 0 || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashToken(plain))) != 1 || !key.Active(now) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	var user models.User
+	if err := models.DB.First(&user, key.UserID).Error; err != nil || accountBlocked(user) != "" {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		models.DB.Model(&key).UpdateColumn("last_used_at", now)
+	}
+
+	ctx.Set(ContextUsername, user.Username)
+	ctx.Set(ContextUserID, user.ID)
+	ctx.Set(ContextAPIKeyID, key.ID)
+	ctx.Set(ContextScopes, strings.Fields(key.Scopes))
+	ctx.Next()
+}
+
+// GET /admin/api-keys - lister les clés d'API
+// @Summary List API keys
+// @Description List API keys, without their secret (admin only)
+// @Tags admin
+// @Produce json
+// @Param user_id query int false "Only the keys acting as this user"
+// @Param include_revoked query bool false "Include revoked keys"
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/api-keys [get]
+func (c *Controller) GetAPIKeys(ctx *gin.Context) {
+	query := models.DB.Order("id")
+	if userID := ctx.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if ctx.Query("include_revoked") != "true" {
+		query = query.Where("revoked_at IS NULL")
+	}
+	keys := []models.APIKey{}
+	if err := query.Find(&keys).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// POST /admin/api-keys - créer une clé d'API
+// @Summary Create an API key
+// @Description Create an API key acting as a user, limited to the given scopes (admin only).
+// @Description The key is only returned in this response; send it in the X-API-Key header.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Key name, user, scopes and expiry"
+// @Success 201 {object} APIKeyCreated
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/api-keys [post]
+func (c *Controller) CreateAPIKey(ctx *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope " + scope})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "expires_at is in the past"})
+		return
+	}
+
+	admin, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if req.UserID == 0 {
+		req.UserID = admin.ID
+	}
+	var owner models.User
+	if err := models.DB.First(&owner, req.UserID).Error; err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		return
+	}
+
+	plain, prefix, err := generateAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(plain),
+		UserID:    owner.ID,
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: admin.ID,
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&key).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "api_key", ResourceID: key.ID, After: key,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, APIKeyCreated{APIKey: key, Key: plain})
+}
+
+// DELETE /admin/api-keys/:id - révoquer une clé d'API
+// @Summary Revoke an API key
+// @Description Revoke an API key; it is refused immediately (admin only)
+// @Tags admin
+// @Param id path int true "API key ID"
+// @Success 204 {object} nil
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/api-keys/{id} [delete]
+func (c *Controller) RevokeAPIKey(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var key models.APIKey
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&key, id).Error; err != nil {
+			return err
+		}
+		if key.RevokedAt != nil {
+			return nil
+		}
+		before := key
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := tx.Save(&key).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "api_key", ResourceID: key.ID, Before: before, After: key,
+		})
+	})
+	if err == gorm.ErrRecordNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"encoding/json"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAPIKeyRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	auth := r.Group("/", AuthMiddleware())
+	auth.GET("/items", RequireScope(models.ScopeItemsRead), ctrl.GetItems)
+	auth.POST("/items", RequireScope(models.ScopeItemsWrite), ctrl.CreateItem)
+	auth.PUT("/me/password", RequireUserSession(), ctrl.ChangePassword)
+	admin := auth.Group("/admin/api-keys", RequireRole(models.RoleAdmin), RequireUserSession())
+	admin.POST("", ctrl.CreateAPIKey)
+	admin.DELETE("/:id", ctrl.RevokeAPIKey)
+	return r
+}
+
+func withAPIKey(router *gin.Engine, method, path, key, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(APIKeyHeader, key)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestAPIKeys(t *testing.T) {
+	setupTestDB()
+	router := setupAPIKeyRouter()
+	token := loginToken(t, router, "admin", "password")
+	models.DB.Model(&models.User{}).Where("username = ?", "admin").Update("role", models.RoleAdmin)
+
+	if resp := sendJSON(router, "POST", "/admin/api-keys", token, map[string]interface{}{"name": "partner", "scopes": []string{"items:delete"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown scope, got %d", resp.Code)
+	}
+	resp := sendJSON(router, "POST", "/admin/api-keys", token, map[string]interface{}{"name": "partner", "scopes": []string{"items:read"}})
+	var created APIKeyCreated
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	if resp.Code != http.StatusCreated || !strings.HasPrefix(created.Key, created.Prefix+"_") || len(created.Prefix) != 16 {
+		t.Fatalf("Unexpected key: %d %s", resp.Code, resp.Body.String())
+	}
+	var stored models.APIKey
+	models.DB.First(&stored, created.ID)
+	if stored.KeyHash == "" || strings.Contains(stored.KeyHash, created.Key) {
+		t.Errorf("Expected only the hash of the key to be stored")
+	}
+
+	if resp := withAPIKey(router, "GET", "/items", created.Key, ""); resp.Code != http.StatusOK {
+		t.Errorf("Expected 200 with items:read, got %d", resp.Code)
+	}
+	if resp := withAPIKey(router, "POST", "/items", created.Key, `{"name": "Gite", "price": 60}`); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without items:write, got %d", resp.Code)
+	}
+	if resp := withAPIKey(router, "PUT", "/me/password", created.Key, `{"old_password": "password", "new_password": "x"}`); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for account routes, got %d", resp.Code)
+	}
+	if resp := withAPIKey(router, "GET", "/items", created.Key+"x", ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong secret, got %d", resp.Code)
+	}
+	models.DB.First(&stored, created.ID)
+	if stored.LastUsedAt == nil {
+		t.Errorf("Expected last_used_at to be set")
+	}
+
+	if resp := sendJSON(router, "DELETE", "/admin/api-keys/"+strconv.Itoa(int(created.ID)), token, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.Code)
+	}
+	if resp := withAPIKey(router, "GET", "/items", created.Key, ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a revoked key, got %d", resp.Code)
+	}
+
+	// Clé expirée
+	resp = sendJSON(router, "POST", "/admin/api-keys", token, map[string]interface{}{
+		"name": "short", "scopes": []string{"items:read"}, "expires_at": time.Now().Add(time.Hour),
+	})
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	models.DB.Model(&models.APIKey{}).Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if resp := withAPIKey(router, "GET", "/items", created.Key, ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an expired key, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditResponse struct {
+	Total    int64             `json:"total"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+	Entries  []models.AuditLog `json:"entries"`
+}
+
+// pagination lit page et page_size (50 par défaut, 200 au maximum)
+func pagination(ctx *gin.Context) (int, int) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(ctx.DefaultQuery("page_size", "50"))
+	if err != nil || size < 1 {
+		size = 50
+	}
+	return page, min(size, 200)
+}
+
+// GET /audit - consulter le journal d'audit
+// @Summary List audit log entries
+// @Description Every data change with its author, request and before/after diff, most recent first (admin only)
+// @Tags admin
+// @Produce json
+// @Param actor query string false "Username of the author"
+// @Param resource_type query string false "Resource type (item, destination, user...)"
+// @Param resource_id query string false "Resource ID"
+// @Param action query string false "create, update or delete"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Entries per page (max 200)"
+// @Success 200 {object} AuditResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /audit [get]
+func (c *Controller) GetAuditLog(ctx *gin.Context) {
+	query := models.DB.Model(&models.AuditLog{})
+	for param, column := range map[string]string{
+		"actor":         "actor",
+		"resource_type": "resource_type",
+		"resource_id":   "resource_id",
+		"action":        "action",
+	} {
+		if v := ctx.Query(param); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	for param, cond := range map[string]string{"from": "created_at >= ?", "to": "created_at <= ?"} {
+		if v := ctx.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			query = query.Where(cond, t)
+		}
+	}
+
+	page, size := pagination(ctx)
+	resp := AuditResponse{Page: page, PageSize: size, Entries: []models.AuditLog{}}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	err := query.Order("created_at desc, id desc").Limit(size).Offset((page - 1) * size).Find(&resp.Entries).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginToken enregistre un utilisateur et renvoie son token JWT
+func loginToken(t *testing.T, router *gin.Engine, username, password string) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	for _, path := range []string{"/register", "/login"} {
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if path == "/login" {
+			var out map[string]string
+			json.Unmarshal(resp.Body.Bytes(), &out)
+			return out["token"]
+		}
+	}
+	return ""
+}
+
+func setupAuditRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{}
+	r.Use(RequestID())
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	auth := r.Group("/", AuthMiddleware())
+	auth.POST("/items", ctrl.CreateItem)
+	auth.PUT("/items/:id", ctrl.UpdateItem)
+	auth.DELETE("/items/:id", ctrl.DeleteItem)
+	auth.GET("/audit", RequireRole(models.RoleAdmin), ctrl.GetAuditLog)
+	return r
+}
+
+func TestAuditTrail(t *testing.T) {
+	setupTestDB()
+	router := setupAuditRouter()
+	token := loginToken(t, router, "alice", "password")
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Request-ID", "req-42")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	send("POST", "/items", `{"name": "Gite", "price": 60}`)
+	send("PUT", "/items/1", `{"name": "Gite", "price": 75}`)
+	send("DELETE", "/items/1", "")
+
+	var logs []models.AuditLog
+	models.DB.Where("resource_type = ?", "item").Order("id").Find(&logs)
+	if len(logs) != 3 {
+		t.Fatalf("Expected 3 item audit entries, got %d", len(logs))
+	}
+	update := logs[1]
+	if update.Actor != "alice" || update.ActorID == 0 || update.Action != models.AuditActionUpdate || update.RequestID != "req-42" {
+		t.Errorf("Unexpected audit entry: %+v", update)
+	}
+	var changes map[string]map[string]interface{}
+	json.Unmarshal(update.Changes, &changes)
+	if len(changes) != 1 || changes["price"]["before"] != 60.0 || changes["price"]["after"] != 75.0 {
+		t.Errorf("Unexpected diff: %s", update.Changes)
+	}
+
+	// Le mot de passe n'apparaît jamais dans le journal
+	var register models.AuditLog
+	models.DB.Where("resource_type = ?", "user").First(&register)
+	if bytes.Contains(register.Changes, []byte("$2a$")) {
+		t.Errorf("Password hash leaked in audit log: %s", register.Changes)
+	}
+
+	// GET /audit est réservé aux admins
+	resp := send("GET", "/audit?resource_type=item", "")
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", resp.Code)
+	}
+	models.DB.Model(&models.User{}).Where("username = ?", "alice").Update("role", models.RoleAdmin)
+
+	resp = send("GET", "/audit?resource_type=item&actor=alice&action=delete", "")
+	var out AuditResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Total != 1 || out.Entries[0].ResourceID != "1" {
+		t.Errorf("Unexpected audit response (%d): %s", resp.Code, resp.Body.String())
+	}
+}
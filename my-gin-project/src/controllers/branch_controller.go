@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RegenerateRequest struct {
+	// Persona de l'assistant (celle de la réponse précédente par défaut)
+	Persona string `json:"persona" example:"travel"`
+}
+
+type EditMessageRequest struct {
+	Text string `json:"text" binding:"required" example:"Trouve moi la meilleure destination en Europe accessible en train depuis Lyon"`
+	// Persona de l'assistant (AI_DEFAULT_PERSONA par défaut)
+	Persona string `json:"persona" example:"travel"`
+}
+
+// HistoryBranch est la branche active de la conversation, dans l'ordre chronologique
+type HistoryBranch struct {
+	Messages []HistoryMessage `json:"messages"`
+}
+
+// activeLeaf renvoie le dernier message de la branche active (ID 0 si la conversation est vide)
+func activeLeaf(db *gorm.DB, userID uint) (models.ConversationHistory, error) {
+	var leaf models.ConversationHistory
+	err := db.Where("user_id = ? AND active = ?", userID, true).Order("seq desc").Limit(1).Find(&leaf).Error
+	return leaf, err
+}
+
+// treeNode est un message réduit à sa place dans l'arbre de la conversation
+type treeNode struct {
+	ID       uint
+	ParentID *uint
+	Seq      int
+}
+
+// activateBranch fait de la branche passant par id la branche active de l'utilisateur : ses ancêtres,
+// et sous id les réponses les plus récentes jusqu'à une feuille. Les autres messages sont désactivés.
+func activateBranch(tx *gorm.DB, userID, id uint) error {
+	var nodes []treeNode
+	if err := tx.Model(&models.ConversationHistory{}).Select("id, parent_id, seq").
+		Where("user_id = ?", userID).Find(&nodes).Error; err != nil {
+		return err
+	}
+	byID := map[uint]treeNode{}
+	latestChild := map[uint]treeNode{}
+	for _, n := range nodes {
+		byID[n.ID] = n
+		if n.ParentID != nil {
+			if c, ok := latestChild[*n.ParentID]; !ok || n.Seq > c.Seq {
+				latestChild[*n.ParentID] = n
+			}
+		}
+	}
+	if _, ok := byID[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	path := []uint{}
+	for c, ok := latestChild[id]; ok; c, ok = latestChild[c.ID] {
+		path = append(path, c.ID)
+	}
+	for cur := &id; cur != nil; cur = byID[*cur].ParentID {
+		path = append(path, *cur)
+	}
+
+	if err := tx.Model(&models.ConversationHistory{}).Where("user_id = ? AND active = ? AND id NOT IN ?", userID, true, path).
+		Update("active", false).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.ConversationHistory{}).Where("id IN ?", path).Update("active", true).Error
+}
+
+// ancestors renvoie les messages qui précèdent id dans sa branche, du premier au plus récent
+// (aucun si id est nil)
+func ancestors(db *gorm.DB, userID uint, id *uint) ([]models.ConversationHistory, error) {
+	var nodes []treeNode
+	if err := db.Model(&models.ConversationHistory{}).Select("id, parent_id, seq").
+		Where("user_id = ?", userID).Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	parents := map[uint]*uint{}
+	for _, n := range nodes {
+		parents[n.ID] = n.ParentID
+	}
+	ids := []uint{}
+	for ; id != nil; id = parents[*id] {
+		ids = append(ids, *id)
+	}
+	var rows []models.ConversationHistory
+	if len(ids) == 0 {
+		return rows, nil
+	}
+	err := db.Where("id IN ?", ids).Order("seq").Find(&rows).Error
+	return rows, err
+}
+
+// completed ne garde que les messages des échanges réussis, seuls envoyés au modèle
+func completed(rows []models.ConversationHistory) []models.ConversationHistory {
+	out := []models.ConversationHistory{}
+	for _, row := range rows {
+		if row.Status == models.MessageStatusComplete {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// ownMessage charge le message :id de l'utilisateur connecté. En cas d'échec, la réponse est déjà écrite.
+func ownMessage(ctx *gin.Context) (models.ConversationHistory, bool) {
+	var row models.ConversationHistory
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return row, false
+	}
+	if err := models.DB.Where("id = ? AND user_id = ?", id, ctx.GetUint(ContextUserID)).First(&row).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return row, false
+	}
+	return row, true
+}
+
+// POST /conversations/regenerate - régénérer la dernière réponse
+// @Summary Regenerate the last reply
+// @Description Ask the AI assistant for a new version of the last reply of the active branch. Previous versions are kept as inactive siblings and can be reactivated.
+// @Description If the last question failed, it gets its first reply.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param request body RegenerateRequest false "Persona"
+// @Success 200 {object} AIResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Header 429 {integer} Retry-After "Seconds before the quota is reset"
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/regenerate [post]
+func (ctrl *Controller) RegenerateReply(c *gin.Context) {
+	var req RegenerateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	db := ctrl.DB
+	userID, username := c.GetUint(ContextUserID), c.GetString(ContextUsername)
+	if !ctrl.withinQuota(c, db, userID) {
+		return
+	}
+
+	// La dernière réponse, ou la dernière question si elle est restée sans réponse
+	question, err := activeLeaf(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+	if question.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No reply to regenerate"})
+		return
+	}
+	if question.Role == models.MessageRoleAssistant {
+		if req.Persona == "" {
+			req.Persona = question.Persona
+		}
+		if question.ParentID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No reply to regenerate"})
+			return
+		}
+		parentID := *question.ParentID
+		question = models.ConversationHistory{}
+		if err := db.First(&question, parentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No reply to regenerate"})
+			return
+		}
+	}
+
+	history, err := ancestors(db, userID, question.ParentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+	tmpl, ok := ctrl.activeTemplate(c, db, req.Persona)
+	if !ok {
+		return
+	}
+	system, ok := renderSystemPrompt(c, tmpl, profilePromptData(db, userID, username))
+	if !ok {
+		return
+	}
+	gen, err := ctrl.answer(c, db, callerFrom(c, userID, username), system, completed(history), question.Message)
+	if err != nil {
+		// La version précédente reste la réponse active ; les tokens consommés sont décomptés
+		fmt.Println("[ERROR] Erreur lors de la régénération:", err)
+		if err := saveUsage(db, gen.usage, userID, nil); err != nil {
+			fmt.Println("[ERROR] Impossible d'enregistrer la consommation:", err)
+		}
+		respondLLMError(c, err)
+		return
+	}
+
+	reply := gen.reply(userID, tmpl)
+	if err := saveTurn(db, turn{rows: []*models.ConversationHistory{&reply}, invocations: gen.invocations, question: &question, flags: gen.flags, usage: gen.usage}); err != nil {
+		fmt.Println("[ERROR] Impossible de sauvegarder la réponse régénérée:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de sauvegarder la conversation"})
+		return
+	}
+	c.JSON(http.StatusOK, AIResponse{Bot: reply.Message, Sources: newSources(gen.hits), MessageID: reply.ID})
+}
+
+// POST /conversations/history/:id/edit - modifier une question
+// @Summary Edit a message
+// @Description Replace one of the current user's past questions and regenerate the reply from that point.
+// @Description The new question starts a branch next to the original one, which is kept and can be reactivated; the new branch becomes active.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path int true "Message ID"
+// @Param request body EditMessageRequest true "New question"
+// @Success 200 {object} AIResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Header 429 {integer} Retry-After "Seconds before the quota is reset"
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/{id}/edit [post]
+func (ctrl *Controller) EditMessage(c *gin.Context) {
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	original, ok := ownMessage(c)
+	if !ok {
+		return
+	}
+	if original.Role != models.MessageRoleUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only questions can be edited"})
+		return
+	}
+	db := ctrl.DB
+	userID, username := c.GetUint(ContextUserID), c.GetString(ContextUsername)
+	if !ctrl.withinQuota(c, db, userID) {
+		return
+	}
+
+	history, err := ancestors(db, userID, original.ParentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+	tmpl, ok := ctrl.activeTemplate(c, db, req.Persona)
+	if !ok {
+		return
+	}
+	system, ok := renderSystemPrompt(c, tmpl, profilePromptData(db, userID, username))
+	if !ok {
+		return
+	}
+	gen, err := ctrl.answer(c, db, callerFrom(c, userID, username), system, completed(history), req.Text)
+	question := models.ConversationHistory{
+		UserID:  userID,
+		Role:    models.MessageRoleUser,
+		Sender:  username,
+		Message: gen.input,
+		Status:  models.MessageStatusComplete,
+	}
+	branch := turn{rows: []*models.ConversationHistory{&question}, invocations: gen.invocations, branch: true, parent: original.ParentID, flags: gen.flags, usage: gen.usage}
+	if err != nil {
+		fmt.Println("[ERROR] Erreur lors de l'appel IA:", err)
+		// La nouvelle branche est conservée avec la question en échec, qui pourra être régénérée
+		question.Status, question.Error = failureStatus(err), truncate(err.Error(), 255)
+		if err := saveTurn(db, branch); err != nil {
+			fmt.Println("[ERROR] Impossible de sauvegarder l'échange en échec:", err)
+		}
+		respondLLMError(c, err)
+		return
+	}
+
+	reply := gen.reply(userID, tmpl)
+	branch.rows = append(branch.rows, &reply)
+	if err := saveTurn(db, branch); err != nil {
+		fmt.Println("[ERROR] Impossible de sauvegarder l'échange:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de sauvegarder la conversation"})
+		return
+	}
+	c.JSON(http.StatusOK, AIResponse{Bot: reply.Message, Sources: newSources(gen.hits), MessageID: reply.ID})
+}
+
+// POST /conversations/history/:id/activate - choisir la branche active
+// @Summary Activate a branch
+// @Description Make the branch going through this message the active one: the conversation continues from its most recent reply and only its messages are sent to the model
+// @Tags conversations
+// @Produce json
+// @Param id path int true "Message ID"
+// @Success 200 {object} HistoryBranch
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/{id}/activate [post]
+func (ctrl *Controller) ActivateBranch(c *gin.Context) {
+	row, ok := ownMessage(c)
+	if !ok {
+		return
+	}
+	var rows []models.ConversationHistory
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := activateBranch(tx, row.UserID, row.ID); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND active = ?", row.UserID, true).Order("seq").Find(&rows).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate branch"})
+		return
+	}
+	resp := HistoryBranch{Messages: []HistoryMessage{}}
+	for _, r := range rows {
+		resp.Messages = append(resp.Messages, newHistoryMessage(r))
+	}
+	c.JSON(http.StatusOK, resp)
+}
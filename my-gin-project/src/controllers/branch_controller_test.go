@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// activeMessages renvoie le texte des messages de la branche active de userID
+func activeMessages(userID uint) string {
+	var rows []models.ConversationHistory
+	models.DB.Where("user_id = ? AND active = ?", userID, true).Order("seq").Find(&rows)
+	texts := []string{}
+	for _, row := range rows {
+		texts = append(texts, row.Message)
+	}
+	return strings.Join(texts, ",")
+}
+
+// prompt renvoie le contenu des messages envoyés au modèle, sans le prompt système
+func prompt(req llm.Request) string {
+	texts := []string{}
+	for _, m := range req.Messages[1:] {
+		texts = append(texts, m.Content)
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestRegenerateReply(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{replies: []string{"A1", "A2", "A2 bis", "A3"}}
+	router := setupHistoryRouter(model)
+	token := loginToken(t, router, "alice", "password")
+	if resp := sendJSON(router, "POST", "/conversations/regenerate", token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an empty conversation, got %d", resp.Code)
+	}
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q1"})
+	var first AIResponse
+	json.Unmarshal(sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q2"}).Body.Bytes(), &first)
+
+	resp := sendJSON(router, "POST", "/conversations/regenerate", token, nil)
+	var out AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Bot != "A2 bis" || out.MessageID == 0 {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if got := prompt(model.requests[2]); got != "Q1,A1,Q2" {
+		t.Errorf("Expected the previous reply to be left out of the prompt, got %s", got)
+	}
+
+	// La version précédente est conservée, sœur de la nouvelle
+	var previous, regenerated models.ConversationHistory
+	models.DB.First(&previous, first.MessageID)
+	models.DB.First(&regenerated, out.MessageID)
+	if previous.Active || !regenerated.Active || *previous.ParentID != *regenerated.ParentID || previous.TurnID != regenerated.TurnID {
+		t.Errorf("Unexpected versions: %+v %+v", previous, regenerated)
+	}
+	userID := previous.UserID
+	if got := activeMessages(userID); got != "Q1,A1,Q2,A2 bis" {
+		t.Errorf("Unexpected active branch: %s", got)
+	}
+
+	// Revenir à la première version : la conversation continue à partir d'elle
+	resp = sendJSON(router, "POST", "/conversations/history/"+strconv.Itoa(int(previous.ID))+"/activate", token, nil)
+	var branch HistoryBranch
+	json.Unmarshal(resp.Body.Bytes(), &branch)
+	if resp.Code != http.StatusOK || len(branch.Messages) != 4 || branch.Messages[3].Message != "A2" {
+		t.Fatalf("Unexpected branch: %d %s", resp.Code, resp.Body.String())
+	}
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q3"})
+	if got := prompt(model.requests[3]); got != "Q1,A1,Q2,A2,Q3" {
+		t.Errorf("Expected the reactivated version in the prompt, got %s", got)
+	}
+	if got := activeMessages(userID); got != "Q1,A1,Q2,A2,Q3,A3" {
+		t.Errorf("Unexpected active branch: %s", got)
+	}
+}
+
+func TestRegenerateFailedQuestion(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{err: &llm.Error{Kind: llm.ErrTimeout, Err: errors.New("no first token")}}
+	router := setupHistoryRouter(model)
+	token := loginToken(t, router, "alice", "password")
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q1"})
+	if resp := sendJSON(router, "POST", "/conversations/regenerate", token, nil); resp.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504, got %d", resp.Code)
+	}
+
+	model.err, model.replies = nil, []string{"A1"}
+	if resp := sendJSON(router, "POST", "/conversations/regenerate", token, nil); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var rows []models.ConversationHistory
+	models.DB.Order("seq").Find(&rows)
+	if len(rows) != 2 || rows[0].Status != models.MessageStatusComplete || rows[0].Error != "" || *rows[1].ParentID != rows[0].ID {
+		t.Errorf("Expected the question to get its reply: %+v", rows)
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{replies: []string{"A1", "A2", "A1 bis"}}
+	router := setupHistoryRouter(model)
+	token := loginToken(t, router, "alice", "password")
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q1"})
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Q2"})
+	var q1, q2, a1 models.ConversationHistory
+	models.DB.Where("message = ?", "Q1").First(&q1)
+	models.DB.Where("message = ?", "Q2").First(&q2)
+	models.DB.Where("message = ?", "A1").First(&a1)
+
+	if resp := sendJSON(router, "POST", "/conversations/history/"+strconv.Itoa(int(a1.ID))+"/edit", token, map[string]string{"text": "x"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when editing a reply, got %d", resp.Code)
+	}
+	other := loginToken(t, router, "bob", "password")
+	if resp := sendJSON(router, "POST", "/conversations/history/"+strconv.Itoa(int(q1.ID))+"/edit", other, map[string]string{"text": "x"}); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's message, got %d", resp.Code)
+	}
+
+	resp := sendJSON(router, "POST", "/conversations/history/"+strconv.Itoa(int(q1.ID))+"/edit", token, map[string]string{"text": "Q1 bis"})
+	var out AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Bot != "A1 bis" {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if got := prompt(model.requests[len(model.requests)-1]); got != "Q1 bis" {
+		t.Errorf("Expected the messages after the edited one to be left out, got %s", got)
+	}
+	if got := activeMessages(q1.UserID); got != "Q1 bis,A1 bis" {
+		t.Errorf("Unexpected active branch: %s", got)
+	}
+
+	// L'historique liste toutes les branches ; active=true seulement la branche suivie
+	var list HistoryList
+	json.Unmarshal(sendJSON(router, "GET", "/conversations/history", token, nil).Body.Bytes(), &list)
+	if list.Total != 6 {
+		t.Errorf("Expected both branches in the history, got %d messages", list.Total)
+	}
+	list = HistoryList{}
+	json.Unmarshal(sendJSON(router, "GET", "/conversations/history?active=true", token, nil).Body.Bytes(), &list)
+	if list.Total != 2 || list.Messages[1].ParentID != nil {
+		t.Errorf("Expected the new root question and its reply, got %+v", list)
+	}
+
+	// La branche d'origine peut être reprise
+	sendJSON(router, "POST", "/conversations/history/"+strconv.Itoa(int(q2.ID))+"/activate", token, nil)
+	if got := activeMessages(q1.UserID); got != "Q1,A1,Q2,A2" {
+		t.Errorf("Unexpected active branch: %s", got)
+	}
+}
@@ -1,13 +1,23 @@
 package controllers
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"slices"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+	"my-gin-project/src/prompts"
+	"my-gin-project/src/rag"
+	"my-gin-project/src/ratelimit"
 
 	"gorm.io/gorm"
 
@@ -21,35 +31,86 @@ type User struct {
 	Password string
 }
 
-type ConversationHistory struct {
-	ID        uint `gorm:"primaryKey"`
-	UserID    uint
-	Sender    string // "user" ou "bot"
-	Message   string
-	CreatedAt time.Time
-}
-
-func (ConversationHistory) TableName() string {
-	return "conversation_history"
-}
-
 type AIMessage struct {
+	// User est le nom affiché d'un appelant anonyme ; il ne désigne aucun compte (ni profil, ni historique, ni quota)
 	User string `json:"user" example:"Thomas"`
 	Text string `json:"text" example:"Trouve moi la meilleure destination en europe accessible en train"`
+	// Persona de l'assistant (AI_DEFAULT_PERSONA par défaut)
+	Persona string `json:"persona" example:"travel"`
 }
 
 type AIResponse struct {
 	Bot string `json:"bot" example:"Trouve moi une destination"`
+	// Sources sont les extraits de nos guides transmis au modèle, cités [1], [2]... dans la réponse
+	Sources []Source `json:"sources,omitempty"`
+	// MessageID est l'identifiant de la réponse enregistrée, à utiliser pour les branches
+	MessageID uint `json:"message_id,omitempty" example:"42"`
+}
+
+// defaultLLM est partagé pour que le disjoncteur voie tous les appels
+var defaultLLM = sync.OnceValue(func() llm.Client { return llm.FromEnv() })
+
+// llm renvoie le client du modèle de langage (Ollama configuré par l'environnement si nil)
+func (ctrl *Controller) llm() llm.Client {
+	if ctrl.LLM != nil {
+		return ctrl.LLM
+	}
+	return defaultLLM()
 }
 
-type OllamaStreamResp struct {
-	Model     string `json:"model"`
-	CreatedAt string `json:"created_at"`
-	Response  string `json:"response"`
-	Done      bool   `json:"done"`
+// respondLLMError répond à un échec du modèle par une erreur explicite plutôt qu'une réponse vide,
+// ou à une question refusée par la modération par la liste des contrôles en cause
+func respondLLMError(c *gin.Context, err error) {
+	var blocked *moderation.BlockedError
+	switch {
+	case errors.As(err, &blocked):
+		reasons := []string{}
+		for _, f := range blocked.Findings {
+			if f.Action == moderation.ActionBlock && !slices.Contains(reasons, f.Check) {
+				reasons = append(reasons, f.Check)
+			}
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Message refusé par la modération", "reasons": reasons})
+	case errors.Is(err, context.Canceled):
+		// Le client est parti : personne ne lira la réponse
+		fmt.Println("[INFO] Requête IA annulée par le client")
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+	case errors.Is(err, llm.ErrTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Le modèle IA n'a pas répondu à temps"})
+	case errors.Is(err, llm.ErrUnavailable):
+		// Le client peut réessayer quand le disjoncteur laissera passer un nouvel appel
+		var llmErr *llm.Error
+		if errors.As(err, &llmErr) && llmErr.RetryAfter > 0 {
+			ratelimit.SetRetryAfter(c, llmErr.RetryAfter)
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Le modèle IA est momentanément indisponible"})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Réponse invalide du modèle IA"})
+	}
 }
 
 // ChatAI : envoie le message à Ollama en local via Docker avec contexte
+// @Summary      Chat avec modèle IA local
+// @Description  Envoie un message au modèle IA exécuté dans Docker (Ollama).
+// @Description  Authentification facultative : avec un token ou une clé d'API, le message est envoyé au nom de l'appelant et l'assistant peut consulter le catalogue et le profil par des outils
+// @Description  Seul un appelant authentifié a un prompt personnalisé et un historique : un appel anonyme n'est pas enregistré
+// @Description  Les tokens consommés sont décomptés des quotas journalier et mensuel de l'utilisateur, ou de ceux de l'adresse IP pour un appel anonyme : au-delà, la requête est refusée (429) jusqu'à la fin de la période
+// @Tags         Chatbot
+// @Accept       json
+// @Produce      json
+// @Param        message  body      AIMessage  true  "Message de l'utilisateur"
+// @Success      200      {object}  AIResponse
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Failure      403      {object}  map[string]string
+// @Failure      429      {object}  map[string]string
+// @Header       429      {integer} Retry-After "Seconds before the quota is reset"
+// @Failure      500      {object}  map[string]string
+// @Failure      502      {object}  map[string]string
+// @Failure      503      {object}  map[string]string
+// @Failure      504      {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Router       /chat-ai [post]
 func (ctrl *Controller) ChatAI(c *gin.Context) {
 	var msg AIMessage
 	if err := c.ShouldBindJSON(&msg); err != nil {
@@ -59,118 +120,404 @@ func (ctrl *Controller) ChatAI(c *gin.Context) {
 	}
 
 	db := ctrl.DB
-	fmt.Println("[INFO] Nouveau message reçu de:", msg.User, "Texte:", msg.Text)
+	// Un appelant authentifié parle en son nom, quel que soit le champ user
+	if username := c.GetString(ContextUsername); username != "" {
+		msg.User = username
+	}
+	// Le texte n'est pas journalisé : il peut contenir des données personnelles, masquées seulement par la modération
+	fmt.Println("[INFO] Nouveau message reçu de:", msg.User, "Longueur:", utf8.RuneCountInString(msg.Text))
 	if db == nil {
 		fmt.Println("[ERROR] ctrl.DB est nil !")
 		return
 	}
 
-	// 1️⃣ Récupérer ou créer l'utilisateur
-	var user User
-	err := db.Where("username = ?", msg.User).First(&user).Error
+	// Prompt système de la persona choisie
+	tmpl, ok := ctrl.activeTemplate(c, db, msg.Persona)
+	if !ok {
+		return
+	}
+
+	// 1️⃣ Identifier l'appelant : seul un appelant authentifié a un profil et un historique. Le champ
+	// user d'un appel anonyme n'est qu'un nom affiché : aucun compte n'est lu ni créé à partir de lui.
+	var user models.User
+	owner := false
+	if userID := c.GetUint(ContextUserID); userID != 0 {
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		if reason := accountBlocked(user); reason != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+		owner = true
+	}
+
+	// Quotas de tokens de l'utilisateur, ou de l'adresse IP pour un appel anonyme, vérifiés avant tout appel au modèle
+	if owner && !ctrl.withinQuota(c, db, user.ID) || !owner && !ctrl.withinClientQuota(c, db) {
+		return
+	}
+
+	// 2️⃣ Récupérer l'historique de la branche active
+	// Les échanges en échec n'ont pas de réponse : ils ne sont pas renvoyés au modèle
+	var history []models.ConversationHistory
+	if owner {
+		db.Where("user_id = ? AND status = ? AND active = ?", user.ID, models.MessageStatusComplete, true).Order("seq").Find(&history)
+		fmt.Println("[INFO] Nombre de messages historiques récupérés:", len(history))
+	}
 
+	// 3️⃣ Construire le prompt, précédé du prompt système (persona et préférences du profil)
+	data := prompts.AnonymousData(time.Now())
+	if owner {
+		data = profilePromptData(db, user.ID, user.Username)
+	}
+	system, ok := renderSystemPrompt(c, tmpl, data)
+	if !ok {
+		return
+	}
+
+	// 4️⃣ Appel au modèle IA, qui peut consulter le catalogue et le profil par des outils
+	gen, err := ctrl.answer(c, db, callerFrom(c, user.ID, msg.User), system, history, msg.Text)
+	question := models.ConversationHistory{
+		UserID:  user.ID,
+		Role:    models.MessageRoleUser,
+		Sender:  msg.User,
+		Message: gen.input,
+		Status:  models.MessageStatusComplete,
+	}
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			fmt.Println("[INFO] Utilisateur inconnu, création de l'utilisateur:", msg.User)
-			user = User{
-				Username: msg.User,
-				Password: "",
-			}
-			if err := db.Create(&user).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de créer l'utilisateur"})
-				fmt.Println("[ERROR] Impossible de créer l'utilisateur:", err)
-				return
+		fmt.Println("[ERROR] Erreur lors de l'appel IA:", err)
+		// La question est conservée avec la cause de l'échec, sans réponse
+		question.Status, question.Error = failureStatus(err), truncate(err.Error(), 255)
+		if !owner {
+			if err := saveClientTurn(db, c, gen); err != nil {
+				fmt.Println("[ERROR] Impossible d'enregistrer la consommation:", err)
 			}
-			fmt.Println("[INFO] Utilisateur créé avec succès, UserID:", user.ID)
+		} else if err := saveTurn(db, turn{rows: []*models.ConversationHistory{&question}, invocations: gen.invocations, flags: gen.flags, usage: gen.usage}); err != nil {
+			fmt.Println("[ERROR] Impossible de sauvegarder l'échange en échec:", err)
 		}
-	} else {
-		fmt.Println("[INFO] Utilisateur existant trouvé:", user.Username)
+		respondLLMError(c, err)
+		return
 	}
 
-	// 2️⃣ Récupérer l'historique
-	var history []ConversationHistory
-	db.Where("user_id = ?", user.ID).Order("created_at asc").Find(&history)
-	fmt.Println("[INFO] Nombre de messages historiques récupérés:", len(history))
+	botResponse := gen.resp.Message.Content
+	fmt.Println("[INFO] Réponse IA générée, longueur:", utf8.RuneCountInString(botResponse))
 
-	// 3️⃣ Construire le prompt
-	var fullPrompt strings.Builder
-	for _, h := range history {
-		fullPrompt.WriteString(fmt.Sprintf("%s: %s\n", h.Sender, h.Message))
+	// Un échange anonyme n'est pas conservé ; seules sa consommation et les détections de la modération le sont
+	if !owner {
+		if err := saveClientTurn(db, c, gen); err != nil {
+			fmt.Println("[ERROR] Impossible d'enregistrer la consommation et les détections:", err)
+		}
+		c.JSON(http.StatusOK, AIResponse{Bot: botResponse, Sources: newSources(gen.hits)})
+		return
 	}
-	fullPrompt.WriteString(fmt.Sprintf("%s: %s\n", msg.User, msg.Text))
-	fullPrompt.WriteString("Bot:")
 
-	fmt.Println("[INFO] Prompt construit, envoi au modèle IA...")
+	// 5️⃣ Sauvegarder la question et la réponse ensemble
+	reply := gen.reply(user.ID, tmpl)
+	if err := saveTurn(db, turn{rows: []*models.ConversationHistory{&question, &reply}, invocations: gen.invocations, flags: gen.flags, usage: gen.usage}); err != nil {
+		fmt.Println("[ERROR] Impossible de sauvegarder l'échange:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de sauvegarder la conversation"})
+		return
+	}
 
-	// 4️⃣ Appel au modèle IA
-	iaHost := "ia"
-	iaPort := 11434
-	iaURL := fmt.Sprintf("http://%s:%d/api/generate", iaHost, iaPort)
+	c.JSON(http.StatusOK, AIResponse{
+		Bot:       botResponse,
+		Sources:   newSources(gen.hits),
+		MessageID: reply.ID,
+	})
+	fmt.Println("[INFO] Conversation sauvegardée avec succès pour l'utilisateur:", user.Username)
+}
 
-	payload := map[string]interface{}{
-		"model":       "mistral",
-		"prompt":      fullPrompt.String(),
-		"temperature": 0.7,
-		"max_tokens":  300,
+// activeTemplate charge la version active du prompt de la persona (AI_DEFAULT_PERSONA si vide).
+// En cas d'échec, la réponse est déjà écrite.
+func (ctrl *Controller) activeTemplate(c *gin.Context, db *gorm.DB, persona string) (prompts.Template, bool) {
+	if persona == "" {
+		persona = defaultPersona()
+	}
+	tmpl, err := ctrl.prompts().Active(db, persona)
+	if errors.Is(err, prompts.ErrUnknownPersona) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Persona inconnue"})
+		return tmpl, false
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de charger le prompt"})
+		fmt.Println("[ERROR] Chargement du prompt:", err)
+		return tmpl, false
+	}
+	return tmpl, true
+}
 
-	jsonData, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", iaURL, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
+// profilePromptData renvoie les données du prompt système avec les préférences du profil de l'utilisateur,
+// ou sans elles si le profil ne peut pas être lu
+func profilePromptData(db *gorm.DB, userID uint, username string) prompts.Data {
+	data, err := promptData(db, userID, username)
+	if err != nil {
+		fmt.Println("[ERROR] Lecture du profil:", err)
+		data = prompts.NewData(username, models.UserProfile{}, "", time.Now())
+	}
+	return data
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// renderSystemPrompt construit le prompt système à partir de data.
+// En cas d'échec, la réponse est déjà écrite.
+func renderSystemPrompt(c *gin.Context, tmpl prompts.Template, data prompts.Data) (string, bool) {
+	system, err := tmpl.Render(data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		fmt.Println("[ERROR] Erreur lors de l'appel IA:", err)
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de construire le prompt"})
+		fmt.Println("[ERROR] Rendu du prompt:", err)
+		return "", false
+	}
+	return system, true
+}
+
+// generation est le résultat d'un appel au modèle pour répondre à une question
+type generation struct {
+	// input est la question après modération (données personnelles masquées), à enregistrer
+	input       string
+	resp        llm.Response
+	invocations []models.ToolInvocation
+	hits        []rag.Hit
+	latency     time.Duration
+	// flags sont les détections de la modération sur la question et la réponse
+	flags []models.ModerationFlag
+	// usage est la consommation de tokens de la génération et de la modération (nil si aucun modèle n'a été appelé)
+	usage *models.AIUsage
+}
+
+// reply renvoie le message du bot à enregistrer, avec le prompt, le modèle et la durée qui l'ont produit
+func (g generation) reply(userID uint, tmpl prompts.Template) models.ConversationHistory {
+	return models.ConversationHistory{
+		UserID:        userID,
+		Role:          models.MessageRoleAssistant,
+		Sender:        "bot",
+		Message:       g.resp.Message.Content,
+		Status:        models.MessageStatusComplete,
+		Persona:       tmpl.Persona,
+		PromptVersion: &tmpl.Version,
+		Model:         g.resp.Model,
+		LatencyMs:     g.latency.Milliseconds(),
 	}
-	defer resp.Body.Close()
+}
 
-	// 5️⃣ Lecture du flux IA
-	scanner := bufio.NewScanner(resp.Body)
-	var finalResp strings.Builder
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		var chunk OllamaStreamResp
-		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
-			fmt.Println("[WARN] Impossible de parser la ligne:", line)
-			continue
+// answer demande au modèle la réponse à text, après le prompt système et les messages de history,
+// avec les extraits de documents proches de la question. La question et la réponse passent par la
+// modération : une question refusée n'est pas envoyée au modèle (erreur *moderation.BlockedError).
+func (ctrl *Controller) answer(c *gin.Context, db *gorm.DB, caller chatCaller, system string, history []models.ConversationHistory, text string) (generation, error) {
+	guard := ctrl.moderation()
+	in := guard.Moderate(c.Request.Context(), moderation.Input, text)
+	// Les appels du classificateur sont décomptés avec la génération, même quand la question est refusée
+	gen := generation{input: in.Text, flags: moderationFlags(moderation.Input, in.Findings), usage: addCalls(ctrl.usage(), nil, in.Calls)}
+	if in.Blocked {
+		fmt.Println("[INFO] Question refusée par la modération:", len(in.Findings), "détection(s)")
+		return gen, &moderation.BlockedError{Findings: in.Findings}
+	}
+	text = in.Text
+
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: system}}
+	for _, h := range history {
+		role := llm.RoleUser
+		if h.Role == models.MessageRoleAssistant {
+			role = llm.RoleAssistant
 		}
-		finalResp.WriteString(chunk.Response)
+		messages = append(messages, llm.Message{Role: role, Content: h.Message})
 	}
+	// Extraits de nos guides et FAQ proches de la question, que le modèle cite par leur numéro
+	hits := ctrl.retrieveSources(c, db, text)
+	if len(hits) > 0 {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: rag.Prompt(hits)})
+		fmt.Println("[INFO] Extraits de documents ajoutés:", len(hits))
+	}
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: text})
 
-	if err := scanner.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la lecture du flux IA"})
-		fmt.Println("[ERROR] Scanner IA:", err)
-		return
+	fmt.Println("[INFO] Prompt construit, envoi au modèle IA...")
+	start := time.Now()
+	resp, invocations, err := ctrl.generate(c.Request.Context(), db, caller, llm.Request{
+		Messages:    messages,
+		Temperature: 0.7,
+		MaxTokens:   300,
+	})
+	gen.resp, gen.invocations, gen.hits, gen.latency = resp, invocations, hits, time.Since(start)
+	gen.usage = addCalls(ctrl.usage(), newUsage(ctrl.usage(), resp, invocations), in.Calls)
+	if err != nil {
+		return gen, err
 	}
 
-	botResponse := finalResp.String()
-	fmt.Println("[INFO] Réponse IA générée:", botResponse)
+	// Une réponse bloquée est remplacée par un refus ; la détection reste visible des administrateurs
+	out := guard.Moderate(c.Request.Context(), moderation.Output, resp.Message.Content)
+	gen.flags = append(gen.flags, moderationFlags(moderation.Output, out.Findings)...)
+	gen.usage = addCalls(ctrl.usage(), gen.usage, out.Calls)
+	gen.resp.Message.Content = out.Text
+	if out.Blocked {
+		fmt.Println("[INFO] Réponse bloquée par la modération")
+		gen.resp.Message.Content = guard.BlockedReply
+	}
+	return gen, nil
+}
 
-	// 6️⃣ Sauvegarder les messages
-	if err := db.Create(&ConversationHistory{
-		UserID:  user.ID,
-		Sender:  msg.User,
-		Message: msg.Text,
-	}).Error; err != nil {
-		fmt.Println("[ERROR] Impossible de sauvegarder message utilisateur:", err)
+// failureStatus est le statut d'une question restée sans réponse à cause de err
+func failureStatus(err error) string {
+	var blocked *moderation.BlockedError
+	if errors.As(err, &blocked) {
+		return models.MessageStatusBlocked
 	}
+	return models.MessageStatusFailed
+}
 
-	if err := db.Create(&ConversationHistory{
-		UserID:  user.ID,
-		Sender:  "bot",
-		Message: botResponse,
-	}).Error; err != nil {
-		fmt.Println("[ERROR] Impossible de sauvegarder message bot:", err)
+// turn est un échange à enregistrer avec saveTurn
+type turn struct {
+	rows        []*models.ConversationHistory
+	invocations []models.ToolInvocation
+	// question, pour une nouvelle version de réponse, est la question existante à laquelle répond rows
+	question *models.ConversationHistory
+	// branch fait partir l'échange de parent (nil : nouvelle racine) au lieu de prolonger la branche active
+	branch bool
+	parent *uint
+	// flags sont les détections de la modération, rattachées à la question ou à la réponse selon leur sens
+	flags []models.ModerationFlag
+	// usage est la consommation de tokens de la génération, rattachée à la réponse
+	usage *models.AIUsage
+}
+
+// saveTurn enregistre les messages d'un échange, les appels d'outils et la consommation associés
+// dans une seule transaction : l'historique ne contient jamais une réponse sans sa question. Les numéros d'ordre
+// sont attribués à l'enregistrement ; si une requête concurrente du même utilisateur prend les mêmes,
+// l'index unique (user_id, seq) fait échouer la transaction, qui est rejouée. Toute autre erreur est
+// renvoyée immédiatement.
+// Un échange qui crée une branche ou une nouvelle version de réponse devient la branche active.
+func saveTurn(db *gorm.DB, t turn) error {
+	rows := t.rows
+	userID := rows[0].UserID
+	turnID := newTurnID()
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var last int
+			if err := tx.Model(&models.ConversationHistory{}).Where("user_id = ?", userID).
+				Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+				return err
+			}
+
+			parent, id := t.parent, turnID
+			switch {
+			case t.question != nil:
+				parent, id = &t.question.ID, t.question.TurnID
+				// Une question restée sans réponse obtient enfin la sienne
+				if t.question.Status != models.MessageStatusComplete {
+					if err := tx.Model(&models.ConversationHistory{}).Where("id = ?", t.question.ID).Updates(map[string]interface{}{
+						"status": models.MessageStatusComplete, "error": "",
+					}).Error; err != nil {
+						return err
+					}
+				}
+			case !t.branch:
+				leaf, err := activeLeaf(tx, userID)
+				if err != nil {
+					return err
+				}
+				parent = nil
+				if leaf.ID != 0 {
+					parent = &leaf.ID
+				}
+			}
+
+			for i, row := range rows {
+				row.ID, row.TurnID, row.Seq, row.ParentID, row.Active = 0, id, last+i+1, parent, true
+				if err := tx.Create(row).Error; err != nil {
+					return err
+				}
+				parent = &row.ID
+			}
+			if t.branch || t.question != nil {
+				if err := activateBranch(tx, userID, rows[len(rows)-1].ID); err != nil {
+					return err
+				}
+			}
+
+			// Les outils ont servi à produire la réponse (aucune si la génération a échoué)
+			var messageID *uint
+			if last := rows[len(rows)-1]; last.Role == models.MessageRoleAssistant {
+				messageID = &last.ID
+			}
+			if err := saveFlags(tx, t, messageID); err != nil {
+				return err
+			}
+			if err := saveUsage(tx, t.usage, userID, messageID); err != nil {
+				return err
+			}
+
+			invocations := t.invocations
+			if len(invocations) == 0 {
+				return nil
+			}
+			for i := range invocations {
+				invocations[i].ID, invocations[i].MessageID = 0, messageID
+			}
+			return tx.Create(&invocations).Error
+		})
+		if !duplicateKey(db, err) {
+			return err
+		}
 	}
+	return err
+}
 
-	c.JSON(http.StatusOK, AIResponse{
-		Bot: botResponse,
+// duplicateKey indique si err est la violation d'un index unique (MySQL 1062, SQLite UNIQUE)
+func duplicateKey(db *gorm.DB, err error) bool {
+	if err == nil {
+		return false
+	}
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// saveFlags rattache les détections de la modération à la nouvelle question de l'échange et à la
+// réponse replyID. Celles d'une question existante (réponse régénérée) ont été enregistrées avec elle.
+func saveFlags(tx *gorm.DB, t turn, replyID *uint) error {
+	var questionID *uint
+	if rows := t.rows; rows[0].Role == models.MessageRoleUser {
+		questionID = &rows[0].ID
+	}
+	userID := t.rows[0].UserID
+	flags := []models.ModerationFlag{}
+	for _, flag := range t.flags {
+		flag.ID, flag.UserID, flag.MessageID = 0, &userID, questionID
+		if flag.Direction == moderation.Output {
+			flag.MessageID = replyID
+		}
+		if flag.MessageID != nil {
+			flags = append(flags, flag)
+		}
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	return tx.Create(&flags).Error
+}
+
+// saveClientTurn enregistre ce qui est conservé d'un échange anonyme : sa consommation, décomptée de
+// l'adresse du client, et les détections de la modération, sans message
+func saveClientTurn(db *gorm.DB, c *gin.Context, gen generation) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := saveClientUsage(tx, gen.usage, c.ClientIP()); err != nil {
+			return err
+		}
+		if len(gen.flags) == 0 {
+			return nil
+		}
+		flags := make([]models.ModerationFlag, len(gen.flags))
+		for i, flag := range gen.flags {
+			flag.ID, flag.UserID, flag.MessageID = 0, nil, nil
+			flag.ClientIP, flag.RequestID = truncate(c.ClientIP(), 45), c.GetString(ContextRequestID)
+			flags[i] = flag
+		}
+		return tx.Create(&flags).Error
 	})
-	fmt.Println("[INFO] Conversation sauvegardée avec succès pour l'utilisateur:", user.Username)
+}
+
+func newTurnID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
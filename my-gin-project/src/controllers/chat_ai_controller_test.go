@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fakeLLM répond avec des réponses prédéfinies et conserve les requêtes reçues.
+// Tant que des outils sont proposés, il demande d'abord les appels de toolCalls, un tour à la fois.
+type fakeLLM struct {
+	replies   []string
+	toolCalls [][]llm.ToolCall
+	requests  []llm.Request
+	// err, s'il est renseigné, est renvoyé à chaque appel
+	err error
+	// promptTokens et completionTokens sont décomptés à chaque réponse
+	promptTokens, completionTokens int
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, req llm.Request) (llm.Response, error) {
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return llm.Response{}, f.err
+	}
+	if len(req.Tools) > 0 && len(f.toolCalls) > 0 {
+		calls := f.toolCalls[0]
+		f.toolCalls = f.toolCalls[1:]
+		return llm.Response{Model: "fake", Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: calls}, PromptTokens: f.promptTokens, CompletionTokens: f.completionTokens}, nil
+	}
+	reply := "OK"
+	if len(f.replies) > 0 {
+		reply, f.replies = f.replies[0], f.replies[1:]
+	}
+	return llm.Response{Model: "fake", Message: llm.Message{Role: llm.RoleAssistant, Content: reply}, PromptTokens: f.promptTokens, CompletionTokens: f.completionTokens}, nil
+}
+
+// Embed compte quelques mots-clés, pour que les textes d'un même sujet aient des vecteurs proches
+func (f *fakeLLM) Embed(ctx context.Context, inputs []string) (llm.Embeddings, error) {
+	keywords := []string{"annecy", "lac", "vélo", "paris", "musée", "bagage"}
+	out := llm.Embeddings{Model: "fake-embed"}
+	for _, input := range inputs {
+		v := make([]float32, len(keywords))
+		for i, k := range keywords {
+			v[i] = float32(strings.Count(strings.ToLower(input), k))
+		}
+		out.Vectors = append(out.Vectors, v)
+	}
+	return out, nil
+}
+
+// asUser authentifie chaque requête au nom de username, créé au besoin, comme le ferait AuthMiddleware
+func asUser(username string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		models.DB.Where(models.User{Username: username}).FirstOrCreate(&user)
+		c.Set(ContextUsername, user.Username)
+		c.Set(ContextUserID, user.ID)
+	}
+}
+
+func setupChatAIRouter(model llm.Client, username string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{DB: models.DB, LLM: model}
+	r.POST("/chat-ai", asUser(username), ctrl.ChatAI)
+	return r
+}
+
+func TestChatAIStructuredMessages(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{replies: []string{"Essaie Annecy", "En train depuis Lyon"}}
+	router := setupChatAIRouter(model, "bot")
+
+	// Un utilisateur nommé "bot" ne doit pas être confondu avec l'assistant
+	for _, text := range []string{"Une idée de week-end ?", "Comment y aller ?"} {
+		resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": text})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+	}
+	var out AIResponse
+	json.Unmarshal(sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Merci"}).Body.Bytes(), &out)
+	if out.Bot != "OK" {
+		t.Errorf("Unexpected reply: %+v", out)
+	}
+
+	messages := model.requests[1].Messages
+	roles := []string{}
+	for _, m := range messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("Unexpected roles: %v", roles)
+	}
+	if messages[2].Content != "Essaie Annecy" || messages[3].Content != "Comment y aller ?" {
+		t.Errorf("Unexpected messages: %+v", messages)
+	}
+	if !strings.Contains(messages[0].Content, "assistant de voyage") {
+		t.Errorf("Expected the persona prompt as system message, got %q", messages[0].Content)
+	}
+
+	var bot models.ConversationHistory
+	models.DB.Where("role = ?", models.MessageRoleAssistant).First(&bot)
+	if bot.Sender != "bot" || bot.Persona != "travel" || bot.PromptVersion == nil || *bot.PromptVersion != 0 {
+		t.Errorf("Unexpected bot message: %+v", bot)
+	}
+
+	if resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "x", "persona": "pirate"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown persona, got %d", resp.Code)
+	}
+}
+
+func TestChatAIBackendErrors(t *testing.T) {
+	setupTestDB()
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&llm.Error{Kind: llm.ErrUnavailable, Err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{&llm.Error{Kind: llm.ErrCircuitOpen, Err: errors.New("too many recent failures"), RetryAfter: 12 * time.Second}, http.StatusServiceUnavailable},
+		{&llm.Error{Kind: llm.ErrTimeout, Err: errors.New("no first token")}, http.StatusGatewayTimeout},
+		{&llm.Error{Kind: llm.ErrBadResponse, Err: errors.New("model 'mistral' not found")}, http.StatusBadGateway},
+		{&llm.Error{Kind: llm.ErrEmptyResponse, Err: errors.New("no content")}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		router := setupChatAIRouter(&fakeLLM{err: tt.err}, "thomas")
+		resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Bonjour"})
+		if resp.Code != tt.want || strings.Contains(resp.Body.String(), "mistral") {
+			t.Errorf("%v: expected %d without details, got %d %s", tt.err, tt.want, resp.Code, resp.Body.String())
+		}
+		// Retry-After suit le disjoncteur, quand il est ouvert
+		if retry := resp.Header().Get("Retry-After"); (errors.Is(tt.err, llm.ErrCircuitOpen) && retry != "12") || (!errors.Is(tt.err, llm.ErrCircuitOpen) && retry != "") {
+			t.Errorf("%v: unexpected Retry-After %q", tt.err, retry)
+		}
+	}
+	// Aucune réponse vide n'est enregistrée : seules les questions le sont, avec la cause de l'échec
+	var rows []models.ConversationHistory
+	models.DB.Order("seq").Find(&rows)
+	if len(rows) != len(tests) {
+		t.Fatalf("Expected %d saved questions, got %d", len(tests), len(rows))
+	}
+	for i, row := range rows {
+		if row.Role != models.MessageRoleUser || row.Status != models.MessageStatusFailed || row.Error == "" || row.Seq != i+1 {
+			t.Errorf("Unexpected message: %+v", row)
+		}
+	}
+}
+
+func TestChatAITurns(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{err: &llm.Error{Kind: llm.ErrTimeout, Err: errors.New("no first token")}}
+	router := setupChatAIRouter(model, "thomas")
+	sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Question sans réponse"})
+	model.err = nil
+	model.replies = []string{"Essaie Annecy", "En train"}
+	sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Une idée ?"})
+	sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Comment y aller ?"})
+
+	// La question en échec n'est pas renvoyée au modèle
+	for _, m := range model.requests[2].Messages {
+		if m.Content == "Question sans réponse" {
+			t.Errorf("Expected the failed question to be left out of the prompt")
+		}
+	}
+
+	var rows []models.ConversationHistory
+	models.DB.Order("seq").Find(&rows)
+	if len(rows) != 5 {
+		t.Fatalf("Expected 5 messages, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if row.Seq != i+1 {
+			t.Errorf("Expected seq %d, got %d", i+1, row.Seq)
+		}
+	}
+	if rows[1].TurnID != rows[2].TurnID || rows[3].TurnID != rows[4].TurnID || rows[2].TurnID == rows[3].TurnID || rows[0].TurnID == rows[1].TurnID {
+		t.Errorf("Expected each question and its reply to share a turn: %+v", rows)
+	}
+}
+
+func TestSaveTurnRetries(t *testing.T) {
+	db := setupTestDB()
+	attempts := 0
+	db.Callback().Create().Before("gorm:create").Register("test:attempts", func(tx *gorm.DB) {
+		if tx.Statement.Table == "conversation_history" {
+			attempts++
+		}
+	})
+	defer db.Callback().Create().Remove("test:attempts")
+
+	// Seul un conflit sur un index unique est rejoué : les autres erreurs sont renvoyées aussitôt
+	db.Exec("DROP TABLE tool_invocations")
+	question := models.ConversationHistory{UserID: 1, Role: models.MessageRoleUser, Sender: "thomas", Message: "Bonjour", Status: models.MessageStatusComplete}
+	err := saveTurn(db, turn{rows: []*models.ConversationHistory{&question}, invocations: []models.ToolInvocation{{Tool: "search_items"}}})
+	if err == nil || duplicateKey(db, err) || attempts != 1 {
+		t.Errorf("Expected a single attempt, got %d (%v)", attempts, err)
+	}
+
+	err = db.Create(&models.User{Username: "thomas"}).Error
+	if err == nil {
+		err = db.Create(&models.User{Username: "thomas"}).Error
+	}
+	if !duplicateKey(db, err) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestChatAIAnonymousCaller(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{}
+	router := setupChatToolsRouter(model)
+	token := loginToken(t, router, "alice", "s3cret-passphrase")
+	var alice models.User
+	models.DB.Where("username = ?", "alice").First(&alice)
+	models.DB.Create(&models.UserProfile{UserID: alice.ID, DisplayName: "Alice", HomeCity: "Lyon"})
+	sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Mon passeport expire en mai"})
+
+	// Nommer alice sans être authentifié ne donne accès ni à son profil ni à son historique
+	resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"user": "alice", "text": "Que sais-tu de moi ?"})
+	var out AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.MessageID != 0 {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	messages := model.requests[len(model.requests)-1].Messages
+	if len(messages) != 2 || strings.Contains(messages[0].Content, "Lyon") || strings.Contains(messages[0].Content, "Alice") {
+		t.Errorf("Expected a neutral prompt without history, got %+v", messages)
+	}
+	var count int64
+	models.DB.Model(&models.ConversationHistory{}).Where("user_id = ?", alice.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected the anonymous exchange not to be saved in alice's history, got %d messages", count)
+	}
+
+	// Le nom d'un appelant anonyme ne désigne aucun compte : aucun n'est créé à son nom
+	sendJSON(router, "POST", "/chat-ai", "", map[string]string{"user": "mallory", "text": "Bonjour"})
+	if err := models.DB.Where("username = ?", "mallory").First(&models.User{}).Error; err == nil {
+		t.Error("Expected no account to be created for an anonymous caller")
+	}
+
+	// Un compte suspendu ne peut plus discuter avec l'assistant
+	now := time.Now()
+	models.DB.Model(&alice).Update("disabled_at", &now)
+	if resp := sendJSON(setupChatAIRouter(model, "alice"), "POST", "/chat-ai", "", map[string]string{"text": "Bonjour"}); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a disabled account, got %d", resp.Code)
+	}
+}
+
+func TestMigrateConversationRoles(t *testing.T) {
+	db := setupTestDB()
+	alice := models.User{Username: "alice", Password: "x"}
+	bot := models.User{Username: "bot", Password: "x"}
+	db.Create(&alice)
+	db.Create(&bot)
+	// Messages enregistrés avant l'introduction du rôle et des échanges numérotés
+	db.Exec("DROP INDEX idx_conversation_history_user_seq")
+	for _, row := range []models.ConversationHistory{
+		{UserID: alice.ID, Sender: "alice", Message: "a1"},
+		{UserID: alice.ID, Sender: "bot", Message: "b1"},
+		{UserID: bot.ID, Sender: "bot", Message: "u1"},
+		{UserID: bot.ID, Sender: "bot", Message: "b2"},
+		{UserID: bot.ID, Sender: "bot", Message: "u2"},
+	} {
+		db.Create(&row)
+	}
+	db.Exec("UPDATE conversation_history SET active = NULL")
+
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var rows []models.ConversationHistory
+	db.Order("id").Find(&rows)
+	want := []string{"user", "assistant", "user", "assistant", "user"}
+	seqs := []int{1, 2, 1, 2, 3}
+	for i, row := range rows {
+		if row.Role != want[i] {
+			t.Errorf("Message %s: expected role %s, got %q", row.Message, want[i], row.Role)
+		}
+		if row.Seq != seqs[i] || row.Status != models.MessageStatusComplete {
+			t.Errorf("Message %s: expected seq %d and status complete, got %d %q", row.Message, seqs[i], row.Seq, row.Status)
+		}
+	}
+	// Une question et la réponse qui la suit forment un échange
+	if rows[0].TurnID == "" || rows[0].TurnID != rows[1].TurnID || rows[2].TurnID != rows[3].TurnID || rows[4].TurnID == rows[3].TurnID {
+		t.Errorf("Unexpected turns: %q %q %q %q %q", rows[0].TurnID, rows[1].TurnID, rows[2].TurnID, rows[3].TurnID, rows[4].TurnID)
+	}
+	// Les messages de chaque utilisateur forment une seule branche, active
+	parents := []*uint{nil, &rows[0].ID, nil, &rows[2].ID, &rows[3].ID}
+	for i, row := range rows {
+		if !row.Active || (row.ParentID == nil) != (parents[i] == nil) || (row.ParentID != nil && *row.ParentID != *parents[i]) {
+			t.Errorf("Message %s: unexpected place in the tree: parent %v, active %v", row.Message, row.ParentID, row.Active)
+		}
+	}
+	if !db.Migrator().HasIndex(&models.ConversationHistory{}, "idx_conversation_history_user_seq") {
+		t.Error("Expected the unique index on (user_id, seq)")
+	}
+}
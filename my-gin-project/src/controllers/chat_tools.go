@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/search"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Taille maximale du résultat d'un outil renvoyé au modèle
+const maxToolResult = 8 * 1024
+
+// chatCaller est l'appelant de /chat-ai, dont les outils reprennent les permissions
+type chatCaller struct {
+	UserID   uint
+	Username string
+	// Authenticated indique que l'appelant a présenté un token ou une clé d'API
+	Authenticated bool
+	// Scopes sont les portées de la clé d'API (nil : pas de limitation)
+	Scopes []string
+}
+
+// callerFrom construit l'appelant à partir du contexte renseigné par OptionalAuth
+func callerFrom(ctx *gin.Context, userID uint, username string) chatCaller {
+	caller := chatCaller{UserID: userID, Username: username}
+	if _, ok := ctx.Get(ContextUserID); ok {
+		caller.Authenticated = true
+	}
+	if _, ok := ctx.Get(ContextAPIKeyID); ok {
+		caller.Scopes = append([]string{}, ctx.GetStringSlice(ContextScopes)...)
+	}
+	return caller
+}
+
+// can indique si l'appelant peut utiliser un outil exigeant scope, avec les mêmes règles que l'API
+func (c chatCaller) can(scope string) bool {
+	return c.Authenticated && (c.Scopes == nil || scope == "" || slices.Contains(c.Scopes, scope))
+}
+
+// chatTool est un outil que l'assistant peut appeler
+type chatTool struct {
+	llm.ToolFunction
+	// Scope est la portée nécessaire ("" : appelant authentifié seulement)
+	Scope string
+	Run   func(db *gorm.DB, caller chatCaller, args json.RawMessage) (interface{}, error)
+}
+
+// errToolInput signale des arguments invalides ; le message est renvoyé au modèle
+type errToolInput string
+
+func (e errToolInput) Error() string { return string(e) }
+
+var chatTools = []chatTool{
+	{
+		ToolFunction: llm.ToolFunction{
+			Name:        "search_items",
+			Description: "Recherche des offres du catalogue (hébergements, activités, transports) par mots-clés, avec leur prix réel.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query":     map[string]interface{}{"type": "string", "description": "Mots-clés, par exemple une ville ou un type d'offre"},
+					"max_price": map[string]interface{}{"type": "number", "description": "Prix maximum"},
+					"limit":     map[string]interface{}{"type": "integer", "description": "Nombre maximum de résultats (10 par défaut)"},
+				},
+				"required": []string{"query"},
+			},
+		},
+		Scope: models.ScopeItemsRead,
+		Run:   toolSearchItems,
+	},
+	{
+		ToolFunction: llm.ToolFunction{
+			Name:        "get_item",
+			Description: "Renvoie le détail et le prix d'une offre du catalogue à partir de son identifiant.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{"type": "integer", "description": "Identifiant de l'offre"},
+				},
+				"required": []string{"id"},
+			},
+		},
+		Scope: models.ScopeItemsRead,
+		Run:   toolGetItem,
+	},
+	{
+		ToolFunction: llm.ToolFunction{
+			Name:        "price_items",
+			Description: "Calcule le prix total d'une liste d'offres du catalogue avec leurs quantités.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"items": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"id":       map[string]interface{}{"type": "integer"},
+								"quantity": map[string]interface{}{"type": "integer", "description": "1 par défaut"},
+							},
+							"required": []string{"id"},
+						},
+					},
+				},
+				"required": []string{"items"},
+			},
+		},
+		Scope: models.ScopeItemsRead,
+		Run:   toolPriceItems,
+	},
+	{
+		ToolFunction: llm.ToolFunction{
+			Name:        "get_user_profile",
+			Description: "Renvoie le profil de voyage de l'utilisateur (ville de départ, devise, budget, besoins).",
+			Parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		},
+		Run: toolGetUserProfile,
+	},
+}
+
+// availableTools renvoie les outils que l'appelant a le droit d'utiliser
+func availableTools(caller chatCaller) []chatTool {
+	var tools []chatTool
+	for _, tool := range chatTools {
+		if caller.can(tool.Scope) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+func toolDefinitions(tools []chatTool) []llm.Tool {
+	var defs []llm.Tool
+	for _, tool := range tools {
+		defs = append(defs, llm.Tool{Type: "function", Function: tool.ToolFunction})
+	}
+	return defs
+}
+
+// decodeArgs lit les arguments d'un appel, envoyés en objet JSON ou en chaîne JSON
+func decodeArgs(raw json.RawMessage, v interface{}) error {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return errToolInput("invalid arguments")
+		}
+		raw = json.RawMessage(s)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return errToolInput("invalid arguments: " + err.Error())
+	}
+	return nil
+}
+
+func toolSearchItems(db *gorm.DB, caller chatCaller, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		Query    string   `json:"query"`
+		MaxPrice *float64 `json:"max_price"`
+		Limit    int      `json:"limit"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	if in.Query == "" {
+		return nil, errToolInput("query is required")
+	}
+	if in.Limit <= 0 {
+		in.Limit = 10
+	}
+	in.Limit = min(in.Limit, 25)
+
+	results, err := search.New(db).Search(in.Query, []string{search.TypeItem}, 100)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	var items []models.Item
+	if len(ids) > 0 {
+		query := db.Where("id IN ?", ids)
+		if in.MaxPrice != nil {
+			query = query.Where("price <= ?", *in.MaxPrice)
+		}
+		if err := query.Find(&items).Error; err != nil {
+			return nil, err
+		}
+	}
+	// Conserver l'ordre de pertinence
+	byID := map[int]models.Item{}
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	found := []models.Item{}
+	for _, id := range ids {
+		if item, ok := byID[id]; ok && len(found) < in.Limit {
+			found = append(found, item)
+		}
+	}
+	return gin.H{"items": found}, nil
+}
+
+func toolGetItem(db *gorm.DB, caller chatCaller, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		ID int `json:"id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	var item models.Item
+	if err := db.First(&item, in.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errToolInput(fmt.Sprintf("item %d not found", in.ID))
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+func toolPriceItems(db *gorm.DB, caller chatCaller, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		Items []struct {
+			ID       int `json:"id"`
+			Quantity int `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	if len(in.Items) == 0 || len(in.Items) > 50 {
+		return nil, errToolInput("between 1 and 50 items are required")
+	}
+
+	ids := make([]int, len(in.Items))
+	for i, line := range in.Items {
+		ids[i] = line.ID
+	}
+	var items []models.Item
+	if err := db.Where("id IN ?", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	byID := map[int]models.Item{}
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	type priceLine struct {
+		ID        int     `json:"id"`
+		Name      string  `json:"name"`
+		UnitPrice float64 `json:"unit_price"`
+		Quantity  int     `json:"quantity"`
+		Subtotal  float64 `json:"subtotal"`
+	}
+	lines := []priceLine{}
+	missing := []int{}
+	total := 0.0
+	for _, line := range in.Items {
+		item, ok := byID[line.ID]
+		if !ok {
+			missing = append(missing, line.ID)
+			continue
+		}
+		qty := line.Quantity
+		if qty <= 0 {
+			qty = 1
+		}
+		if qty > 100 {
+			return nil, errToolInput("quantity must not exceed 100")
+		}
+		subtotal := item.Price * float64(qty)
+		lines = append(lines, priceLine{ID: item.ID, Name: item.Name, UnitPrice: item.Price, Quantity: qty, Subtotal: subtotal})
+		total += subtotal
+	}
+	return gin.H{"lines": lines, "total": total, "missing_ids": missing}, nil
+}
+
+func toolGetUserProfile(db *gorm.DB, caller chatCaller, args json.RawMessage) (interface{}, error) {
+	return loadProfile(db, caller.UserID)
+}
+
+// runTool exécute un appel d'outil du modèle et renvoie le contenu à lui transmettre
+func runTool(db *gorm.DB, caller chatCaller, tools []chatTool, call llm.FunctionCall) (string, models.ToolInvocation) {
+	start := time.Now()
+	inv := models.ToolInvocation{UserID: caller.UserID, Tool: truncate(call.Name, 64), Arguments: string(call.Arguments)}
+
+	var result interface{}
+	var err error = errToolInput("unknown tool " + call.Name)
+	for _, tool := range tools {
+		if tool.Name == call.Name {
+			result, err = tool.Run(db, caller, call.Arguments)
+			break
+		}
+	}
+	inv.DurationMs = time.Since(start).Milliseconds()
+
+	var input errToolInput
+	switch {
+	case errors.As(err, &input):
+		result = gin.H{"error": input.Error()}
+	case err != nil:
+		// Les erreurs techniques ne sont pas détaillées au modèle
+		fmt.Println("[ERROR] Outil", call.Name+":", err)
+		result = gin.H{"error": "tool failed"}
+	}
+	if err != nil {
+		inv.Error = truncate(err.Error(), 255)
+	}
+	data, _ := json.Marshal(result)
+	content := truncate(string(data), maxToolResult)
+	inv.Result = content
+	return content, inv
+}
+
+// generate obtient la réponse du modèle à messages, en exécutant les outils qu'il demande.
+// Après AI_MAX_TOOL_ROUNDS tours d'outils, le modèle est rappelé sans outils pour qu'il conclue.
+// Les appels d'outils sont renvoyés même en cas d'erreur, pour être journalisés.
+func (ctrl *Controller) generate(ctx context.Context, db *gorm.DB, caller chatCaller, req llm.Request) (llm.Response, []models.ToolInvocation, error) {
+	tools := availableTools(caller)
+	maxRounds := config.Int("AI_MAX_TOOL_ROUNDS", 4)
+	var invocations []models.ToolInvocation
+	// Les tokens de tous les tours sont cumulés dans la réponse renvoyée, pour les quotas
+	var promptTokens, completionTokens int
+	var model string
+
+	for round := 0; ; round++ {
+		req.Tools = nil
+		if round < maxRounds {
+			req.Tools = toolDefinitions(tools)
+		}
+		resp, err := ctrl.llm().Chat(ctx, req)
+		promptTokens += resp.PromptTokens
+		completionTokens += resp.CompletionTokens
+		if resp.Model != "" {
+			model = resp.Model
+		}
+		if err != nil || len(resp.Message.ToolCalls) == 0 || len(req.Tools) == 0 {
+			resp.Model, resp.PromptTokens, resp.CompletionTokens = model, promptTokens, completionTokens
+			return resp, invocations, err
+		}
+
+		req.Messages = append(req.Messages, resp.Message)
+		for _, call := range resp.Message.ToolCalls {
+			content, inv := runTool(db, caller, tools, call.Function)
+			inv.Round = round + 1
+			invocations = append(invocations, inv)
+			fmt.Println("[INFO] Outil exécuté:", call.Function.Name)
+			req.Messages = append(req.Messages, llm.Message{Role: llm.RoleTool, Content: content, ToolName: call.Function.Name})
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func toolCall(name, args string) llm.ToolCall {
+	return llm.ToolCall{Function: llm.FunctionCall{Name: name, Arguments: json.RawMessage(args)}}
+}
+
+func setupChatToolsRouter(model llm.Client) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{DB: models.DB, LLM: model}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	r.POST("/chat-ai", OptionalAuth(), ctrl.ChatAI)
+	return r
+}
+
+func TestChatAITools(t *testing.T) {
+	setupTestDB()
+	models.DB.Create(&models.Item{Name: "Hôtel du lac à Annecy", Price: 120})
+	models.DB.Create(&models.Item{Name: "Location de vélo à Annecy", Price: 30})
+
+	model := &fakeLLM{
+		replies: []string{"Bonjour !", "Le vélo coûte 60 € pour deux jours"},
+		toolCalls: [][]llm.ToolCall{
+			{toolCall("search_items", `{"query": "annecy", "max_price": 100}`)},
+			// Arguments envoyés en chaîne JSON, et outil inexistant
+			{toolCall("price_items", `"{\"items\": [{\"id\": 2, \"quantity\": 2}, {\"id\": 99}]}"`), toolCall("book_hotel", `{}`)},
+		},
+	}
+	router := setupChatToolsRouter(model)
+
+	// Sans authentification, aucun outil n'est proposé
+	if resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"user": "guest", "text": "Bonjour"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if len(model.requests) != 1 || model.requests[0].Tools != nil {
+		t.Fatalf("Expected a single call without tools, got %+v", model.requests)
+	}
+	if resp := sendJSON(router, "POST", "/chat-ai", "invalid", map[string]string{"user": "guest", "text": "Bonjour"}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid token, got %d", resp.Code)
+	}
+
+	model.requests = nil
+	token := loginToken(t, router, "alice", "s3cret-passphrase")
+	resp := sendJSON(router, "POST", "/chat-ai", token, map[string]string{"user": "mallory", "text": "Un vélo à Annecy ?"})
+	var out AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out.Bot != "Le vélo coûte 60 € pour deux jours" {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if len(model.requests) != 3 || len(model.requests[0].Tools) != len(chatTools) {
+		t.Fatalf("Expected 3 calls with every tool offered, got %d", len(model.requests))
+	}
+
+	// Les résultats des outils sont renvoyés au modèle
+	messages := model.requests[1].Messages
+	search := messages[len(messages)-1]
+	if search.Role != llm.RoleTool || search.ToolName != "search_items" ||
+		!strings.Contains(search.Content, "Location de vélo") || strings.Contains(search.Content, "Hôtel") {
+		t.Errorf("Unexpected search result: %+v", search)
+	}
+	messages = model.requests[2].Messages
+	price, unknown := messages[len(messages)-2], messages[len(messages)-1]
+	if !strings.Contains(price.Content, `"total":60`) || !strings.Contains(price.Content, `"missing_ids":[99]`) {
+		t.Errorf("Unexpected price result: %s", price.Content)
+	}
+	if !strings.Contains(unknown.Content, "unknown tool") {
+		t.Errorf("Expected an error for an unknown tool, got %s", unknown.Content)
+	}
+
+	// L'appelant authentifié parle en son nom et les appels sont journalisés avec la réponse
+	var alice models.User
+	models.DB.Where("username = ?", "alice").First(&alice)
+	var reply models.ConversationHistory
+	models.DB.Where("user_id = ? AND role = ?", alice.ID, models.MessageRoleAssistant).First(&reply)
+	if reply.ID == 0 {
+		t.Fatalf("Expected the reply to be saved for alice")
+	}
+	var invocations []models.ToolInvocation
+	models.DB.Order("id").Find(&invocations)
+	if len(invocations) != 3 {
+		t.Fatalf("Expected 3 tool invocations, got %d", len(invocations))
+	}
+	for _, inv := range invocations {
+		if inv.UserID != alice.ID || inv.MessageID == nil || *inv.MessageID != reply.ID {
+			t.Errorf("Unexpected invocation: %+v", inv)
+		}
+	}
+	if invocations[1].Round != 2 || invocations[1].Error != "" || invocations[2].Error == "" {
+		t.Errorf("Unexpected invocations: %+v", invocations)
+	}
+}
+
+func TestChatAIToolRoundsLimit(t *testing.T) {
+	setupTestDB()
+	t.Setenv("AI_MAX_TOOL_ROUNDS", "2")
+	loop := []llm.ToolCall{toolCall("get_user_profile", `{}`)}
+	model := &fakeLLM{toolCalls: [][]llm.ToolCall{loop, loop, loop, loop}}
+	router := setupChatToolsRouter(model)
+	token := loginToken(t, router, "alice", "s3cret-passphrase")
+
+	if resp := sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Bonjour"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// Deux tours d'outils, puis un dernier appel sans outils pour conclure
+	if len(model.requests) != 3 || model.requests[2].Tools != nil {
+		t.Errorf("Expected the last of 3 calls without tools, got %d calls", len(model.requests))
+	}
+}
+
+func TestAvailableTools(t *testing.T) {
+	names := func(caller chatCaller) []string {
+		var out []string
+		for _, tool := range availableTools(caller) {
+			out = append(out, tool.Name)
+		}
+		return out
+	}
+	if tools := names(chatCaller{}); len(tools) != 0 {
+		t.Errorf("Expected no tools for an anonymous caller, got %v", tools)
+	}
+	if tools := names(chatCaller{Authenticated: true, Scopes: []string{}}); strings.Join(tools, ",") != "get_user_profile" {
+		t.Errorf("Expected only the profile tool for an API key without scopes, got %v", tools)
+	}
+	if tools := names(chatCaller{Authenticated: true, Scopes: []string{models.ScopeItemsRead}}); len(tools) != len(chatTools) {
+		t.Errorf("Expected every tool with items:read, got %v", tools)
+	}
+}
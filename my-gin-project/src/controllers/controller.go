@@ -1,42 +1,161 @@
 package controllers
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"my-gin-project/src/audit"
+	"my-gin-project/src/jsonpatch"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/mailer"
 	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+	"my-gin-project/src/password"
+	"my-gin-project/src/prompts"
+	"my-gin-project/src/ratelimit"
+	"my-gin-project/src/sso"
+	"my-gin-project/src/usage"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Controller struct {
 	DB *gorm.DB
+
+	// RateLimitStore conserve les seaux de limitation de débit (pas de limitation si nil)
+	RateLimitStore ratelimit.Store
+	// LoginLockout verrouille les comptes après des échecs de connexion répétés (désactivé si nil)
+	LoginLockout *ratelimit.Lockout
+
+	// Mailer envoie les emails de vérification et de réinitialisation (sortie standard si nil)
+	Mailer mailer.Mailer
+	// PasswordHasher et PasswordPolicy hachent et valident les mots de passe (valeurs par défaut si nil)
+	PasswordHasher *password.Hasher
+	PasswordPolicy *password.Policy
+	// SSOProviders sont les fournisseurs OpenID Connect acceptés pour la connexion
+	SSOProviders sso.Providers
+	// LLM est le modèle de langage de l'assistant (Ollama configuré par l'environnement si nil)
+	LLM llm.Client
+	// Embedder calcule les embeddings des documents (LLM s'il en calcule, sinon Ollama configuré par l'environnement, si nil)
+	Embedder llm.Embedder
+	// Prompts fournit les prompts système de l'assistant IA (modèles intégrés si nil)
+	Prompts *prompts.Library
+	// Moderation contrôle les questions et les réponses de l'assistant IA (contrôles par défaut si nil)
+	Moderation *moderation.Pipeline
+	// Usage fixe les quotas de tokens de l'assistant IA et leur prix (quotas par défaut si nil)
+	Usage *usage.Policy
+
+	// Bulk limite POST /items/bulk (limites par défaut pour les champs nuls)
+	Bulk BulkLimits
+}
+
+// jwtSecret signe les tokens d'accès, les défis de double authentification et les cookies SSO.
+// Il est défini au démarrage par SetJWTSecret : sans lui, aucun token n'est émis ni accepté.
+var jwtSecret []byte
+
+var errNoJWTSecret = errors.New("JWT secret is not configured")
+
+// SetJWTSecret définit la clé de signature des tokens (JWT_SECRET), d'au moins 32 octets
+func SetJWTSecret(secret string) error {
+	if len(secret) < 32 {
+		return errors.New("JWT_SECRET must be at least 32 bytes long")
+	}
+	jwtSecret = []byte(secret)
+	return nil
 }
 
-var jwtSecret = []byte("secret") // à mettre dans une variable d'environnement en prod
+// signJWT signe claims en HS256 avec jwtSecret
+func signJWT(claims jwt.MapClaims) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", errNoJWTSecret
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// parseJWT vérifie la signature (HS256 uniquement) et l'expiration d'un token et renvoie ses claims
+func parseJWT(raw string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		if len(jwtSecret) == 0 {
+			return nil, errNoJWTSecret
+		}
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims, nil
+}
 
 // GET /items - récupérer tous les items
 // @Summary Get all items
 // @Description Retrieve list of items (protected route)
 // @Tags items
 // @Produce json
+// @Param name query string false "Name contains"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param sort query string false "Sort field: id, name or price, prefixed with - for descending order"
 // @Success 200 {array} models.Item
+// @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security ApiKeyAuth
+// @Security APIKey
 // @Router /items [get]
 func (c *Controller) GetItems(ctx *gin.Context) {
+	query, err := itemFilters(ctx, models.DB)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var items []models.Item
-	if err := models.DB.Find(&items).Error; err != nil {
+	if err := query.Find(&items).Error; err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
 		return
 	}
 	ctx.JSON(http.StatusOK, items)
 }
 
+// itemFilters applique sur db les filtres de GetItems passés en query string
+func itemFilters(ctx *gin.Context, db *gorm.DB) (*gorm.DB, error) {
+	if name := ctx.Query("name"); name != "" {
+		db = db.Where("name LIKE ?", "%"+name+"%")
+	}
+	for param, cond := range map[string]string{"min_price": "price >= ?", "max_price": "price <= ?"} {
+		if v := ctx.Query(param); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", param)
+			}
+			db = db.Where(cond, price)
+		}
+	}
+
+	sort := ctx.DefaultQuery("sort", "id")
+	column, desc := strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	switch column {
+	case "id", "name", "price":
+	default:
+		return nil, fmt.Errorf("invalid sort")
+	}
+	if desc {
+		column += " desc"
+	}
+	return db.Order(column), nil
+}
+
 // GET /items/:id - récupérer un item par ID
 // @Summary Get item by ID
 // @Description Retrieve a single item
@@ -47,6 +166,7 @@ func (c *Controller) GetItems(ctx *gin.Context) {
 // @Failure 404 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security ApiKeyAuth
+// @Security APIKey
 // @Router /items/{id} [get]
 func (c *Controller) GetItemByID(ctx *gin.Context) {
 	id, _ := strconv.Atoi(ctx.Param("id"))
@@ -69,6 +189,7 @@ func (c *Controller) GetItemByID(ctx *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security ApiKeyAuth
+// @Security APIKey
 // @Router /items [post]
 func (c *Controller) CreateItem(ctx *gin.Context) {
 	var item models.Item
@@ -76,7 +197,15 @@ func (c *Controller) CreateItem(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	if err := models.DB.Create(&item).Error; err != nil {
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "item", ResourceID: item.ID, After: item,
+		})
+	})
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
 		return
 	}
@@ -96,6 +225,7 @@ func (c *Controller) CreateItem(ctx *gin.Context) {
 // @Failure 404 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security ApiKeyAuth
+// @Security APIKey
 // @Router /items/{id} [put]
 func (c *Controller) UpdateItem(ctx *gin.Context) {
 	id, _ := strconv.Atoi(ctx.Param("id"))
@@ -111,10 +241,20 @@ func (c *Controller) UpdateItem(ctx *gin.Context) {
 		return
 	}
 
+	before := item
 	item.Name = input.Name
+	item.Description = input.Description
 	item.Price = input.Price
 
-	if err := models.DB.Save(&item).Error; err != nil {
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "item", ResourceID: item.ID, Before: before, After: item,
+		})
+	})
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
 		return
 	}
@@ -122,6 +262,107 @@ func (c *Controller) UpdateItem(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, item)
 }
 
+// maxPatchSize est la taille maximale du corps de PATCH /items/:id, en octets
+const maxPatchSize = 64 << 10
+
+// PATCH /items/:id - mettre à jour partiellement un item
+// @Summary Partially update an item
+// @Description Apply a JSON Merge Patch (application/merge-patch+json, RFC 7386) or a JSON Patch (application/json-patch+json, RFC 6902) to an item.
+// @Description Merge patch body: a partial item, e.g. {"price": 99.9}. JSON Patch body: an array of operations, e.g. [{"op": "replace", "path": "/price", "value": 99.9}].
+// @Description The patched item is validated before being saved; its id cannot be changed. The body is limited to 64 KiB.
+// @Tags items
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Param id path int true "Item ID"
+// @Param patch body []jsonpatch.Operation true "JSON Patch operations, or a partial models.Item for a merge patch"
+// @Success 200 {object} models.Item
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /items/{id} [patch]
+func (c *Controller) PatchItem(ctx *gin.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	var item models.Item
+	if err := models.DB.First(&item, id).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	// Un patch d'item tient en quelques lignes : le corps est limité avant d'être lu en mémoire
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxPatchSize)
+	patch, err := io.ReadAll(ctx.Request.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Patch too large", "max": maxPatchSize})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	original, _ := json.Marshal(item)
+
+	var patched []byte
+	switch ctx.ContentType() {
+	case jsonpatch.MergePatchType:
+		patched, err = jsonpatch.ApplyMergePatch(original, patch)
+	case jsonpatch.JSONPatchType:
+		patched, err = jsonpatch.ApplyPatch(original, patch)
+	default:
+		ctx.Header("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported patch format"})
+		return
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrInvalidPatch):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	var result models.Item
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patched item is invalid: " + err.Error()})
+		return
+	}
+	if result.ID != item.ID {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Item id cannot be modified"})
+		return
+	}
+	if err := result.Validate(); err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&result).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "item", ResourceID: result.ID, Before: item, After: result,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
 // DELETE /items/:id - supprimer un item
 // @Summary Delete an item
 // @Description Delete an item by ID
@@ -132,10 +373,24 @@ func (c *Controller) UpdateItem(ctx *gin.Context) {
 // @Failure 404 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security ApiKeyAuth
+// @Security APIKey
 // @Router /items/{id} [delete]
 func (c *Controller) DeleteItem(ctx *gin.Context) {
 	id, _ := strconv.Atoi(ctx.Param("id"))
-	if err := models.DB.Delete(&models.Item{}, id).Error; err != nil {
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.First(&item, id).Error; err != nil {
+			// Suppression idempotente : rien à supprimer ni à auditer
+			return nil
+		}
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionDelete, ResourceType: "item", ResourceID: item.ID, Before: item,
+		})
+	})
+	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
@@ -144,7 +399,8 @@ func (c *Controller) DeleteItem(ctx *gin.Context) {
 
 // Register godoc
 // @Summary Register a new user
-// @Description Create a new user with username and password
+// @Description Create a new user with username, password and an optional email; a verification link is sent to the email address.
+// @Description The password must follow the password policy (length, not breached, not containing the username).
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -153,34 +409,66 @@ func (c *Controller) DeleteItem(ctx *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Router /register [post]
 func (c *Controller) Register(ctx *gin.Context) {
-	var user models.User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	var input models.User
+	if err := ctx.ShouldBindJSON(&input); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err := c.passwordPolicy().Validate(input.Password, input.Username); err != nil {
+		if password.IsPolicyError(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking password"})
+		return
+	}
+	hash, err := c.passwordHasher().Hash(input.Password)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
 		return
 	}
-	user.Password = string(hash)
+	// Seuls ces champs peuvent être choisis à l'inscription
+	user := models.User{
+		Username: input.Username,
+		Email:    normalizeEmail(input.Email),
+		Password: hash,
+		Role:     models.RoleUser,
+	}
 
-	if err := models.DB.Create(&user).Error; err != nil {
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		meta := auditMeta(ctx)
+		meta.ActorID, meta.Actor = user.ID, user.Username
+		return audit.Record(tx, meta, audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "user", ResourceID: user.ID, After: user,
+		})
+	})
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving user"})
 		return
 	}
+	// L'inscription réussit même si l'email de vérification n'a pas pu partir
+	if err := c.sendVerificationEmail(user); err != nil {
+		fmt.Println("[ERROR] Envoi de l'email de vérification:", err)
+	}
 	ctx.JSON(http.StatusCreated, gin.H{"message": "User registered"})
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return JWT token.
+// @Description When two-factor authentication is enabled, returns {"mfa_required": true, "mfa_token": "..."} instead; exchange it with POST /login/mfa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body models.User true "User info"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Header 429 {integer} Retry-After "Seconds before the next attempt"
 // @Router /login [post]
 func (c *Controller) Login(ctx *gin.Context) {
 	var input models.User
@@ -189,23 +477,97 @@ func (c *Controller) Login(ctx *gin.Context) {
 		return
 	}
 
+	// Compte verrouillé après trop d'échecs
+	if c.LoginLockout != nil {
+		if wait, err := c.LoginLockout.Locked(input.Username); err == nil && wait > 0 {
+			ratelimit.SetRetryAfter(ctx, wait)
+			ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts"})
+			return
+		}
+	}
+
 	var user models.User
 	if err := models.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+		c.loginFailed(input.Username)
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+	if !c.checkPassword(&user, input.Password) {
+		c.loginFailed(input.Username)
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
 		return
 	}
+	if reason := accountBlocked(user); reason != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+
+	// Double authentification : le token d'accès n'est délivré qu'après POST /login/mfa
+	if user.TOTPEnabledAt != nil {
+		challenge, err := mfaChallenge(user)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge})
+		return
+	}
+
+	if c.LoginLockout != nil {
+		c.LoginLockout.Succeed(user.Username)
+	}
+	c.respondWithToken(ctx, user, "password")
+}
+
+// Durée de validité des tokens d'accès et de leur session
+const tokenTTL = 72 * time.Hour
+
+// Fréquence maximale de mise à jour de last_seen_at des sessions
+const sessionTouchInterval = time.Minute
+
+// accountBlocked renvoie la raison pour laquelle user ne peut pas se connecter ("" si le compte est actif)
+func accountBlocked(user models.User) string {
+	switch {
+	case user.DisabledAt != nil:
+		return "Account disabled"
+	case user.DeactivatedAt != nil:
+		return "Account deactivated"
+	}
+	return ""
+}
+
+// respondWithToken ouvre une session pour user et envoie en réponse son token JWT d'accès.
+// method indique comment l'utilisateur s'est authentifié (password, mfa, oidc:<fournisseur>).
+func (c *Controller) respondWithToken(ctx *gin.Context, user models.User, method string) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now()
+	session := models.Session{
+		ID:        hex.EncodeToString(id),
+		UserID:    user.ID,
+		Method:    method,
+		IP:        ctx.ClientIP(),
+		UserAgent: truncate(ctx.Request.UserAgent(), 255),
+		ExpiresAt: now.Add(tokenTTL),
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).UpdateColumn("last_login_at", now).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
 
-	// Génération du token JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenString, err := signJWT(jwt.MapClaims{
 		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(), // expiration 72h
+		"user_id":  user.ID,
+		"sid":      session.ID,
+		"exp":      session.ExpiresAt.Unix(), // expiration 72h
 	})
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
@@ -214,23 +576,80 @@ func (c *Controller) Login(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
 
+// truncate coupe s à n octets au plus, sans couper de caractère
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// loginFailed comptabilise un échec de connexion pour le verrouillage progressif
+func (c *Controller) loginFailed(username string) {
+	if c.LoginLockout == nil {
+		return
+	}
+	if _, err := c.LoginLockout.Fail(username); err != nil {
+		fmt.Println("[ERROR] Login lockout:", err)
+	}
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		// Clé d'API des intégrations machine à machine
+		if key := ctx.GetHeader(APIKeyHeader); key != "" {
+			authenticateAPIKey(ctx, key)
+			return
+		}
+
 		authHeader := ctx.GetHeader("Authorization")
 		if authHeader == "" {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		claims, err := parseJWT(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		// Les tokens à usage particulier (défi de double authentification) ne donnent pas accès à l'API,
+		// et tout token d'accès est rattaché à une session, qui peut être révoquée
+		sid, ok := claims["sid"].(string)
+		if claims["purpose"] != nil || !ok || sid == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Le compte et la session sont relus en base à chaque requête : une suspension
+		// ou une révocation prend effet immédiatement
+		id, _ := claims["user_id"].(float64)
+		var user models.User
+		if err := models.DB.First(&user, uint(id)).Error; err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
+		if reason := accountBlocked(user); reason != "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": reason})
+			return
+		}
+		var session models.Session
+		now := time.Now()
+		if err := models.DB.Where("id = ? AND user_id = ?", sid, user.ID).First(&session).Error; err != nil || !session.Active(now) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			return
+		}
+		if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) > sessionTouchInterval {
+			models.DB.Model(&session).UpdateColumn("last_seen_at", now)
+		}
+
+		// Conserver l'identité de l'appelant pour les handlers et l'audit
+		ctx.Set(ContextUsername, user.Username)
+		ctx.Set(ContextUserID, user.ID)
+		ctx.Set(ContextSessionID, session.ID)
 
 		ctx.Next()
 	}
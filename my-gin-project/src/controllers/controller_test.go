@@ -4,19 +4,30 @@ import (
 	"bytes"
 	"encoding/json"
 	"my-gin-project/src/models"
+	"my-gin-project/src/ratelimit"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// Clé de signature des tokens émis pendant les tests
+func init() {
+	if err := SetJWTSecret("test-secret-of-at-least-32-bytes!"); err != nil {
+		panic(err)
+	}
+}
+
 // Initialisation de la DB en mémoire pour les tests
 func setupTestDB() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.Item{}, &models.User{})
+	models.Migrate(db)
 	models.DB = db
 	return db
 }
@@ -31,6 +42,7 @@ func setupRouter() *gin.Engine {
 	r.GET("/items/:id", ctrl.GetItemByID)
 	r.POST("/items", ctrl.CreateItem)
 	r.PUT("/items/:id", ctrl.UpdateItem)
+	r.PATCH("/items/:id", ctrl.PatchItem)
 	r.DELETE("/items/:id", ctrl.DeleteItem)
 	r.POST("/register", ctrl.Register)
 	r.POST("/login", ctrl.Login)
@@ -134,3 +146,163 @@ func TestRegisterLogin(t *testing.T) {
 		t.Errorf("Expected token in response")
 	}
 }
+
+func TestAccessTokenRequirements(t *testing.T) {
+	setupTestDB()
+	router := setupRouter()
+	router.GET("/me", AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	token := loginToken(t, router, "alice", "password")
+	var alice models.User
+	models.DB.Where("username = ?", "alice").First(&alice)
+
+	send := func(token string) int {
+		req, _ := http.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if code := send(token); code != http.StatusOK {
+		t.Fatalf("Expected the login token to be accepted, got %d", code)
+	}
+
+	// Un token sans session ne pourrait être ni révoqué ni désactivé
+	claims := jwt.MapClaims{"username": "alice", "user_id": alice.ID, "exp": time.Now().Add(time.Hour).Unix()}
+	noSession, _ := signJWT(claims)
+	if code := send(noSession); code != http.StatusUnauthorized {
+		t.Errorf("Expected a token without sid to be refused, got %d", code)
+	}
+	// Seul HS256 est accepté
+	claims["sid"] = "x"
+	hs512, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(jwtSecret)
+	if code := send(hs512); code != http.StatusUnauthorized {
+		t.Errorf("Expected another signing method to be refused, got %d", code)
+	}
+
+	if err := SetJWTSecret("secret"); err == nil {
+		t.Error("Expected a short secret to be refused")
+	}
+}
+
+func TestPatchItem(t *testing.T) {
+	setupTestDB()
+	router := setupRouter()
+
+	models.DB.Create(&models.Item{Name: "Hotel", Price: 80.0})
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/items/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Merge patch : seul le prix change, le nom est conservé
+	resp := patch("application/merge-patch+json", `{"price": 95.5}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var item models.Item
+	json.Unmarshal(resp.Body.Bytes(), &item)
+	if item.Name != "Hotel" || item.Price != 95.5 {
+		t.Errorf("Unexpected item after merge patch: %+v", item)
+	}
+
+	// JSON Patch avec test + replace
+	resp = patch("application/json-patch+json", `[{"op":"test","path":"/price","value":95.5},{"op":"replace","path":"/name","value":"Hotel de Paris"}]`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	models.DB.First(&item, 1)
+	if item.Name != "Hotel de Paris" || item.Price != 95.5 {
+		t.Errorf("Unexpected item after JSON patch: %+v", item)
+	}
+
+	// Test en échec
+	resp = patch("application/json-patch+json", `[{"op":"test","path":"/price","value":1}]`)
+	if resp.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", resp.Code)
+	}
+
+	// Item résultant invalide
+	resp = patch("application/merge-patch+json", `{"name": null}`)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", resp.Code)
+	}
+
+	// Changement d'id refusé
+	resp = patch("application/json-patch+json", `[{"op":"replace","path":"/id","value":2}]`)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", resp.Code)
+	}
+
+	// Type de contenu non supporté
+	resp = patch("application/json", `{"price": 1}`)
+	if resp.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", resp.Code)
+	}
+
+	// Corps trop volumineux
+	resp = patch("application/merge-patch+json", `{"description": "`+strings.Repeat("a", maxPatchSize)+`"}`)
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", resp.Code)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	setupTestDB()
+	router := gin.New()
+	router.GET("/search", (&Controller{}).Search)
+
+	models.DB.Create(&models.Item{Name: "Excursion en Provence", Description: "Champs de lavande et villages perchés"})
+
+	req, _ := http.NewRequest("GET", "/search?q=lavende", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var body SearchResponse
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if resp.Code != http.StatusOK || len(body.Results) != 1 {
+		t.Fatalf("Unexpected response (%d): %s", resp.Code, resp.Body.String())
+	}
+	if body.Results[0].Highlights["description"] != "Champs de <mark>lavande</mark> et villages perchés" {
+		t.Errorf("Unexpected highlight: %+v", body.Results[0].Highlights)
+	}
+
+	req, _ = http.NewRequest("GET", "/search", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupTestDB()
+	gin.SetMode(gin.TestMode)
+	ctrl := &Controller{LoginLockout: ratelimit.NewLockout(ratelimit.NewMemoryStore())}
+	ctrl.LoginLockout.Threshold = 2
+	router := gin.New()
+	router.POST("/register", ctrl.Register)
+	router.POST("/login", ctrl.Login)
+
+	post := func(path, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": "carol", "password": password})
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	post("/register", "s3cret-passphrase")
+	post("/login", "wrong")
+	post("/login", "wrong")
+
+	// Même le bon mot de passe est refusé pendant le verrouillage
+	resp := post("/login", "s3cret-passphrase")
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected locked account, got %d %v", resp.Code, resp.Header())
+	}
+}
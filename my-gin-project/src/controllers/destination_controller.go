@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GET /destinations - récupérer toutes les destinations
+// @Summary Get all destinations
+// @Description Retrieve list of destinations (protected route)
+// @Tags destinations
+// @Produce json
+// @Success 200 {array} models.Destination
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /destinations [get]
+func (c *Controller) GetDestinations(ctx *gin.Context) {
+	var destinations []models.Destination
+	if err := models.DB.Order("name").Find(&destinations).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch destinations"})
+		return
+	}
+	ctx.JSON(http.StatusOK, destinations)
+}
+
+// POST /destinations - créer une destination
+// @Summary Create a new destination
+// @Description Add a new destination
+// @Tags destinations
+// @Accept json
+// @Produce json
+// @Param destination body models.Destination true "Destination info"
+// @Success 201 {object} models.Destination
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /destinations [post]
+func (c *Controller) CreateDestination(ctx *gin.Context) {
+	var destination models.Destination
+	if err := ctx.ShouldBindJSON(&destination); err != nil || strings.TrimSpace(destination.Name) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&destination).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "destination", ResourceID: destination.ID, After: destination,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create destination"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, destination)
+}
@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/rag"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DocumentRequest struct {
+	Title  string `json:"title" binding:"required" example:"Guide d'Annecy"`
+	Source string `json:"source" example:"guides/annecy.md"`
+	// Format : markdown (par défaut) ou text, par exemple pour le texte extrait d'un PDF
+	Format  string `json:"format" example:"markdown"`
+	Content string `json:"content" binding:"required" example:"# Annecy\n\nLe lac d'Annecy se découvre à vélo."`
+}
+
+type DocumentList struct {
+	Total     int64             `json:"total"`
+	Page      int               `json:"page"`
+	PageSize  int               `json:"page_size"`
+	Documents []models.Document `json:"documents"`
+}
+
+type DocumentSearchRequest struct {
+	Query string `json:"query" binding:"required" example:"Peut-on faire le tour du lac à vélo ?"`
+	// Nombre d'extraits (RAG_TOP_K par défaut)
+	K int `json:"k" example:"4"`
+}
+
+// Source est un extrait de document cité dans une réponse de l'assistant
+type Source struct {
+	// Index est le numéro de la citation dans la réponse, [1] pour le premier extrait
+	Index      int     `json:"index" example:"1"`
+	DocumentID uint    `json:"document_id" example:"3"`
+	Title      string  `json:"title" example:"Guide d'Annecy"`
+	Source     string  `json:"source" example:"guides/annecy.md"`
+	ChunkID    uint    `json:"chunk_id" example:"42"`
+	Score      float64 `json:"score" example:"0.82"`
+}
+
+// embedder renvoie le modèle d'embeddings : Embedder, sinon LLM s'il en calcule, sinon Ollama configuré par l'environnement
+func (ctrl *Controller) embedder() llm.Embedder {
+	if ctrl.Embedder != nil {
+		return ctrl.Embedder
+	}
+	if e, ok := ctrl.llm().(llm.Embedder); ok {
+		return e
+	}
+	return llm.OllamaFromEnv()
+}
+
+func (ctrl *Controller) knowledge(db *gorm.DB) *rag.Store {
+	return rag.New(db, ctrl.embedder())
+}
+
+// retrieveSources cherche les extraits de documents utiles pour répondre à question.
+// La recherche est facultative : en cas d'erreur, l'assistant répond sans extraits.
+func (ctrl *Controller) retrieveSources(ctx *gin.Context, db *gorm.DB, question string) []rag.Hit {
+	if !config.Bool("RAG_ENABLED", true) {
+		return nil
+	}
+	hits, err := ctrl.knowledge(db).Retrieve(ctx.Request.Context(), question, config.Int("RAG_TOP_K", 4), ragMinScore())
+	if err != nil {
+		fmt.Println("[ERROR] Recherche dans les documents:", err)
+		return nil
+	}
+	return hits
+}
+
+// ragMinScore est la similarité minimale d'un extrait transmis au modèle
+func ragMinScore() float64 {
+	return config.Float("RAG_MIN_SCORE", 0.5)
+}
+
+func newSources(hits []rag.Hit) []Source {
+	var sources []Source
+	for i, hit := range hits {
+		sources = append(sources, Source{
+			Index: i + 1, DocumentID: hit.DocumentID, Title: hit.Title, Source: hit.Source, ChunkID: hit.ChunkID, Score: hit.Score,
+		})
+	}
+	return sources
+}
+
+// documentInput lit le document envoyé en JSON ou en formulaire multipart (champ "file")
+func documentInput(ctx *gin.Context) (DocumentRequest, error) {
+	var req DocumentRequest
+	var tooLarge *http.MaxBytesError
+	if !strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			if errors.As(err, &tooLarge) {
+				return req, err
+			}
+			return req, errors.New("Invalid input")
+		}
+		return req, nil
+	}
+
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		if errors.As(err, &tooLarge) {
+			return req, err
+		}
+		return req, errors.New("Missing file")
+	}
+	switch strings.ToLower(path.Ext(header.Filename)) {
+	case ".md", ".markdown":
+		req.Format = models.DocumentFormatMarkdown
+	case ".txt", ".text":
+		req.Format = models.DocumentFormatText
+	default:
+		return req, errUnsupportedDocument
+	}
+	file, err := header.Open()
+	if err != nil {
+		return req, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, err
+	}
+	req.Content = string(data)
+	req.Title = ctx.PostForm("title")
+	if req.Title == "" {
+		req.Title = strings.TrimSuffix(header.Filename, path.Ext(header.Filename))
+	}
+	req.Source = ctx.DefaultPostForm("source", header.Filename)
+	return req, nil
+}
+
+var errUnsupportedDocument = errors.New("Unsupported file type: send Markdown or text (extract the text of PDF files first)")
+
+// POST /admin/documents - ajouter un document à la base de connaissances
+// @Summary Ingest a document
+// @Description Add a destination guide or FAQ to the knowledge base of the AI assistant: the document is split into chunks whose embeddings are computed by the configured model.
+// @Description Send JSON or a multipart form with a .md or .txt "file" (plus optional "title" and "source" fields). PDF files must be converted to text first (admin only)
+// @Tags admin
+// @Accept json,multipart/form-data
+// @Produce json
+// @Param request body DocumentRequest false "Document"
+// @Param file formData file false "Markdown or text file"
+// @Success 201 {object} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/documents [post]
+func (c *Controller) CreateDocument(ctx *gin.Context) {
+	maxSize := int64(config.Int("RAG_MAX_DOCUMENT_SIZE", 1<<20))
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize+64*1024)
+
+	req, err := documentInput(ctx)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Document too large", "max": maxSize})
+		return
+	case errors.Is(err, errUnsupportedDocument):
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if int64(len(req.Content)) > maxSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Document too large", "max": maxSize})
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.DocumentFormatMarkdown
+	}
+	if req.Format != models.DocumentFormatMarkdown && req.Format != models.DocumentFormatText {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	if !utf8.ValidString(req.Content) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Document must be UTF-8 text"})
+		return
+	}
+
+	doc := models.Document{
+		Title:     truncate(strings.TrimSpace(req.Title), 255),
+		Source:    truncate(strings.TrimSpace(req.Source), 512),
+		Format:    req.Format,
+		Content:   req.Content,
+		CreatedBy: ctx.GetUint(ContextUserID),
+	}
+	if doc.Title == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+		return
+	}
+	var existing int64
+	if err := models.DB.Model(&models.Document{}).Where("checksum = ?", rag.Checksum(doc.Content)).Count(&existing).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+	if existing > 0 {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Document already ingested"})
+		return
+	}
+
+	chunks, err := c.knowledge(models.DB).Prepare(ctx.Request.Context(), &doc)
+	if errors.Is(err, rag.ErrEmptyDocument) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Document has no text"})
+		return
+	}
+	if err != nil {
+		fmt.Println("[ERROR] Indexation du document:", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Failed to compute embeddings"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := rag.Save(tx, &doc, chunks); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "document", ResourceID: doc.ID, After: withoutContent(doc),
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, withoutContent(doc))
+}
+
+// withoutContent allège un document pour les listes et le journal d'audit
+func withoutContent(doc models.Document) models.Document {
+	doc.Content = ""
+	return doc
+}
+
+// GET /admin/documents - lister les documents
+// @Summary List documents
+// @Description Documents of the knowledge base, without their content, most recent first (admin only)
+// @Tags admin
+// @Produce json
+// @Param q query string false "Text in the title or source"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Documents per page (max 200)"
+// @Success 200 {object} DocumentList
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/documents [get]
+func (c *Controller) GetDocuments(ctx *gin.Context) {
+	query := models.DB.Model(&models.Document{})
+	if q := strings.TrimSpace(ctx.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(title) LIKE ? OR LOWER(source) LIKE ?", like, like)
+	}
+
+	page, size := pagination(ctx)
+	resp := DocumentList{Page: page, PageSize: size, Documents: []models.Document{}}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
+		return
+	}
+	if err := query.Omit("content").Order("id desc").Limit(size).Offset((page - 1) * size).Find(&resp.Documents).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// documentByID charge le document du paramètre :id, ou répond 404
+func documentByID(ctx *gin.Context) (models.Document, bool) {
+	var doc models.Document
+	if err := models.DB.First(&doc, ctx.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		}
+		return doc, false
+	}
+	return doc, true
+}
+
+// GET /admin/documents/:id - consulter un document
+// @Summary Get a document
+// @Description Document of the knowledge base with its content (admin only)
+// @Tags admin
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} models.Document
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/documents/{id} [get]
+func (c *Controller) GetDocument(ctx *gin.Context) {
+	if doc, ok := documentByID(ctx); ok {
+		ctx.JSON(http.StatusOK, doc)
+	}
+}
+
+// DELETE /admin/documents/:id - retirer un document
+// @Summary Delete a document
+// @Description Remove a document and its chunks from the knowledge base (admin only)
+// @Tags admin
+// @Param id path int true "Document ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/documents/{id} [delete]
+func (c *Controller) DeleteDocument(ctx *gin.Context) {
+	doc, ok := documentByID(ctx)
+	if !ok {
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := rag.Delete(tx, &doc); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionDelete, ResourceType: "document", ResourceID: doc.ID, Before: withoutContent(doc),
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// POST /admin/documents/search - tester la recherche dans les documents
+// @Summary Search documents
+// @Description Chunks that the AI assistant would receive for a question, with their similarity score (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body DocumentSearchRequest true "Question"
+// @Success 200 {array} rag.Hit
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/documents/search [post]
+func (c *Controller) SearchDocuments(ctx *gin.Context) {
+	var req DocumentSearchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if req.K <= 0 {
+		req.K = config.Int("RAG_TOP_K", 4)
+	}
+	hits, err := c.knowledge(models.DB).Retrieve(ctx.Request.Context(), req.Query, min(req.K, 20), ragMinScore())
+	if err != nil {
+		fmt.Println("[ERROR] Recherche dans les documents:", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Failed to compute embeddings"})
+		return
+	}
+	if hits == nil {
+		hits = []rag.Hit{}
+	}
+	ctx.JSON(http.StatusOK, hits)
+}
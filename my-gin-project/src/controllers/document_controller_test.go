@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupDocumentRouter(model llm.Client) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{DB: models.DB, LLM: model}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	r.POST("/chat-ai", OptionalAuth(), ctrl.ChatAI)
+	admin := r.Group("/admin/documents", AuthMiddleware(), RequireRole(models.RoleAdmin))
+	admin.GET("", ctrl.GetDocuments)
+	admin.POST("", ctrl.CreateDocument)
+	admin.POST("/search", ctrl.SearchDocuments)
+	admin.GET("/:id", ctrl.GetDocument)
+	admin.DELETE("/:id", ctrl.DeleteDocument)
+	return r
+}
+
+func uploadDocument(router *gin.Engine, token, filename, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.WriteField("source", "faq/"+filename)
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/admin/documents", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestDocuments(t *testing.T) {
+	setupTestDB()
+	model := &fakeLLM{}
+	router := setupDocumentRouter(model)
+	token := loginToken(t, router, "admin", "s3cret-passphrase")
+	models.DB.Model(&models.User{}).Where("username = ?", "admin").Update("role", models.RoleAdmin)
+
+	guide := map[string]string{
+		"title":   "Guide d'Annecy",
+		"source":  "guides/annecy.md",
+		"content": "# Le lac\n\nLe tour du lac d'Annecy se fait à vélo en une journée.\n\n# Musées\n\nLe musée-château domine la vieille ville.",
+	}
+	resp := sendJSON(router, "POST", "/admin/documents", token, guide)
+	var doc models.Document
+	json.Unmarshal(resp.Body.Bytes(), &doc)
+	if resp.Code != http.StatusCreated || doc.Chunks != 2 || doc.EmbeddingModel != "fake-embed" || doc.Content != "" {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/admin/documents", token, guide); resp.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate document, got %d", resp.Code)
+	}
+
+	if resp := uploadDocument(router, token, "bagages.txt", "Un bagage cabine de 10 kg est inclus dans chaque billet."); resp.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a text file, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := uploadDocument(router, token, "guide.pdf", "%PDF-1.7"); resp.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a PDF file, got %d", resp.Code)
+	}
+
+	var list DocumentList
+	json.Unmarshal(sendJSON(router, "GET", "/admin/documents?q=bagages", token, nil).Body.Bytes(), &list)
+	if list.Total != 1 || list.Documents[0].Title != "bagages" || list.Documents[0].Source != "faq/bagages.txt" {
+		t.Errorf("Unexpected documents: %+v", list)
+	}
+
+	resp = sendJSON(router, "POST", "/admin/documents/search", token, map[string]string{"query": "Un musée à Annecy ?"})
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "musée-château") || strings.Contains(resp.Body.String(), "bagage") {
+		t.Errorf("Unexpected search response: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// L'assistant reçoit les extraits pertinents et la réponse cite leurs sources
+	model.replies = []string{"Oui, le tour du lac à vélo prend une journée [1]."}
+	resp = sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Peut-on faire le tour du lac à vélo ?"})
+	var out AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || len(out.Sources) != 1 || out.Sources[0].Index != 1 || out.Sources[0].Source != "guides/annecy.md" {
+		t.Fatalf("Unexpected chat response: %d %s", resp.Code, resp.Body.String())
+	}
+	messages := model.requests[len(model.requests)-1].Messages
+	context := messages[len(messages)-2]
+	if context.Role != llm.RoleSystem || !strings.Contains(context.Content, "[1] Guide d'Annecy (guides/annecy.md)\n# Le lac\n\nLe tour du lac") {
+		t.Errorf("Expected the excerpts before the question, got %+v", context)
+	}
+
+	if resp := sendJSON(router, "DELETE", "/admin/documents/"+strconv.Itoa(int(doc.ID)), token, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.Code)
+	}
+	var chunks int64
+	models.DB.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunks)
+	if chunks != 0 {
+		t.Errorf("Expected the chunks to be deleted, got %d", chunks)
+	}
+	out = AIResponse{}
+	json.Unmarshal(sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Et le lac ?"}).Body.Bytes(), &out)
+	if len(out.Sources) != 0 {
+		t.Errorf("Expected no sources after deletion, got %+v", out.Sources)
+	}
+}
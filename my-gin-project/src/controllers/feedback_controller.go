@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Périodes du rapport de qualité
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// Regroupements possibles du rapport de qualité
+var reportGroups = []string{"model", "template", "period"}
+
+type FeedbackRequest struct {
+	// Rating : up ou down
+	Rating  string `json:"rating" binding:"required" example:"down"`
+	Comment string `json:"comment" example:"Le train de nuit Paris-Venise n'existe plus"`
+}
+
+// QualityReportRow agrège les réponses de l'assistant d'un groupe (modèle, prompt et période)
+type QualityReportRow struct {
+	Period        string `json:"period,omitempty" example:"2026-W42"`
+	Model         string `json:"model,omitempty" example:"mistral"`
+	Persona       string `json:"persona,omitempty" example:"travel"`
+	PromptVersion *int   `json:"prompt_version,omitempty" example:"3"`
+	Replies       int64  `json:"replies" example:"120"`
+	Rated         int64  `json:"rated" example:"30"`
+	Up            int64  `json:"up" example:"24"`
+	Down          int64  `json:"down" example:"6"`
+	// Satisfaction est la part d'avis positifs parmi les réponses notées (null sans avis)
+	Satisfaction *float64 `json:"satisfaction" example:"0.8"`
+	AvgLatencyMs int64    `json:"avg_latency_ms" example:"2350"`
+	Comments     int64    `json:"comments" example:"9"`
+}
+
+type QualityReport struct {
+	GroupBy []string           `json:"group_by" example:"model,template,period"`
+	Period  string             `json:"period" example:"week"`
+	Rows    []QualityReportRow `json:"rows"`
+}
+
+// attachFeedback complète les messages avec l'avis donné sur chacun
+func attachFeedback(messages []HistoryMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	var feedback []models.MessageFeedback
+	if err := models.DB.Where("message_id IN ?", ids).Find(&feedback).Error; err != nil {
+		return err
+	}
+	byMessage := map[uint]*models.MessageFeedback{}
+	for i := range feedback {
+		byMessage[feedback[i].MessageID] = &feedback[i]
+	}
+	for i := range messages {
+		messages[i].Feedback = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// PUT /conversations/history/:id/feedback - donner son avis sur une réponse
+// @Summary Rate a reply
+// @Description Thumbs up or down on one of the assistant's replies to the current user, with an optional comment. A new rating replaces the previous one.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path int true "Message ID"
+// @Param request body FeedbackRequest true "Rating"
+// @Success 200 {object} models.MessageFeedback
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/{id}/feedback [put]
+func (c *Controller) PutFeedback(ctx *gin.Context) {
+	var req FeedbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if req.Rating != models.FeedbackUp && req.Rating != models.FeedbackDown {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be up or down"})
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(req.Comment) > 2000 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Comment is too long"})
+		return
+	}
+	message, ok := ownMessage(ctx)
+	if !ok {
+		return
+	}
+	if message.Role != models.MessageRoleAssistant {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Only replies can be rated"})
+		return
+	}
+
+	var feedback models.MessageFeedback
+	if err := models.DB.Where("message_id = ?", message.ID).Limit(1).Find(&feedback).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+	feedback.MessageID, feedback.UserID = message.ID, message.UserID
+	feedback.Rating, feedback.Comment = req.Rating, req.Comment
+	if err := models.DB.Save(&feedback).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+	ctx.JSON(http.StatusOK, feedback)
+}
+
+// DELETE /conversations/history/:id/feedback - retirer son avis
+// @Summary Delete a rating
+// @Description Remove the current user's rating of a reply
+// @Tags conversations
+// @Param id path int true "Message ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/{id}/feedback [delete]
+func (c *Controller) DeleteFeedback(ctx *gin.Context) {
+	message, ok := ownMessage(ctx)
+	if !ok {
+		return
+	}
+	if err := models.DB.Where("message_id = ?", message.ID).Delete(&models.MessageFeedback{}).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feedback"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// periodColumn est l'expression SQL de la période de h.created_at : 2026-10-19, 2026-W42 (semaine ISO) ou 2026-10
+func periodColumn(db *gorm.DB, period string) string {
+	if db.Dialector.Name() == "mysql" {
+		switch period {
+		case PeriodDay:
+			return "DATE_FORMAT(h.created_at, '%Y-%m-%d')"
+		case PeriodMonth:
+			return "DATE_FORMAT(h.created_at, '%Y-%m')"
+		}
+		return "DATE_FORMAT(h.created_at, '%x-W%v')"
+	}
+	switch period {
+	case PeriodDay:
+		return "strftime('%Y-%m-%d', h.created_at)"
+	case PeriodMonth:
+		return "strftime('%Y-%m', h.created_at)"
+	}
+	// La semaine ISO est celle de son jeudi, qui donne aussi l'année
+	thursday := "date(h.created_at, '-3 days', 'weekday 4')"
+	return fmt.Sprintf("printf('%%s-W%%02d', strftime('%%Y', %s), (CAST(strftime('%%j', %s) AS INTEGER) - 1) / 7 + 1)", thursday, thursday)
+}
+
+// qualityReport agrège en SQL les réponses du bot enregistrées entre from et to (bornes facultatives)
+func qualityReport(groupBy []string, period string, from, to *time.Time) ([]QualityReportRow, error) {
+	columns := []string{}
+	selected := []string{}
+	if slices.Contains(groupBy, "period") {
+		column := periodColumn(models.DB, period)
+		columns, selected = append(columns, column), append(selected, column+" AS period")
+	}
+	if slices.Contains(groupBy, "model") {
+		columns, selected = append(columns, "h.model"), append(selected, "h.model")
+	}
+	if slices.Contains(groupBy, "template") {
+		columns, selected = append(columns, "h.persona", "h.prompt_version"), append(selected, "h.persona", "h.prompt_version")
+	}
+	query := models.DB.Table("conversation_history AS h").
+		Select(strings.Join(append(selected, "COUNT(*) AS replies", "COUNT(f.rating) AS rated",
+			"COALESCE(SUM(CASE WHEN f.rating = ? THEN 1 ELSE 0 END), 0) AS up",
+			"COALESCE(SUM(CASE WHEN f.rating = ? THEN 1 ELSE 0 END), 0) AS down",
+			"COALESCE(SUM(CASE WHEN f.comment <> '' THEN 1 ELSE 0 END), 0) AS comments",
+			"COALESCE(SUM(h.latency_ms), 0) AS latency_ms"), ", "), models.FeedbackUp, models.FeedbackDown).
+		Joins("LEFT JOIN message_feedback f ON f.message_id = h.id").
+		Where("h.role = ? AND h.status = ?", models.MessageRoleAssistant, models.MessageStatusComplete)
+	if from != nil {
+		query = query.Where("h.created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("h.created_at <= ?", *to)
+	}
+	if len(columns) > 0 {
+		query = query.Group(strings.Join(columns, ", ")).Order(strings.Join(columns, ", "))
+	}
+	var groups []struct {
+		QualityReportRow
+		LatencyMs int64
+	}
+	if err := query.Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	report := make([]QualityReportRow, 0, len(groups))
+	for _, g := range groups {
+		// Sans regroupement, la seule ligne est le total, vide s'il n'y a aucune réponse
+		if g.Replies == 0 {
+			continue
+		}
+		row := g.QualityReportRow
+		row.AvgLatencyMs = g.LatencyMs / row.Replies
+		if row.Rated > 0 {
+			s := math.Round(float64(row.Up)/float64(row.Rated)*1000) / 1000
+			row.Satisfaction = &s
+		}
+		report = append(report, row)
+	}
+	return report, nil
+}
+
+// GET /admin/feedback/report - rapport de qualité de l'assistant IA
+// @Summary Get quality report
+// @Description Satisfaction of the users with the AI assistant's replies (thumbs up/down), with the number of comments and the average latency, aggregated by model, prompt template and period (admin only).
+// @Description Only counts are returned: the messages and comments stay private. With format=csv the report is downloaded for offline evaluation.
+// @Tags admin
+// @Produce json,text/csv
+// @Param group_by query string false "Comma-separated groups among model, template and period (all by default)"
+// @Param period query string false "day, week (default, ISO weeks) or month"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} QualityReport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/feedback/report [get]
+func (c *Controller) GetQualityReport(ctx *gin.Context) {
+	groupBy := reportGroups
+	if v := ctx.Query("group_by"); v != "" {
+		groupBy = strings.Split(v, ",")
+		for i, g := range groupBy {
+			groupBy[i] = strings.TrimSpace(g)
+			if !slices.Contains(reportGroups, groupBy[i]) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by"})
+				return
+			}
+		}
+	}
+	period := ctx.DefaultQuery("period", PeriodWeek)
+	if period != PeriodDay && period != PeriodWeek && period != PeriodMonth {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+		return
+	}
+	format := ctx.DefaultQuery("format", HistoryFormatJSON)
+	if format != HistoryFormatJSON && format != FormatCSV {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	var bounds [2]*time.Time
+	for i, param := range []string{"from", "to"} {
+		if v := ctx.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			bounds[i] = &t
+		}
+	}
+
+	rows, err := qualityReport(groupBy, period, bounds[0], bounds[1])
+	if err != nil {
+		fmt.Println("[ERROR] Rapport de qualité:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build quality report"})
+		return
+	}
+	if format == HistoryFormatJSON {
+		ctx.JSON(http.StatusOK, QualityReport{GroupBy: groupBy, Period: period, Rows: rows})
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="quality-report.csv"`)
+	ctx.Status(http.StatusOK)
+	w := csv.NewWriter(ctx.Writer)
+	w.Write([]string{"period", "model", "persona", "prompt_version", "replies", "rated", "up", "down", "satisfaction", "avg_latency_ms", "comments"})
+	for _, row := range rows {
+		version, satisfaction := "", ""
+		if row.PromptVersion != nil {
+			version = strconv.Itoa(*row.PromptVersion)
+		}
+		if row.Satisfaction != nil {
+			satisfaction = strconv.FormatFloat(*row.Satisfaction, 'f', -1, 64)
+		}
+		w.Write([]string{
+			row.Period, row.Model, row.Persona, version,
+			strconv.FormatInt(row.Replies, 10), strconv.FormatInt(row.Rated, 10),
+			strconv.FormatInt(row.Up, 10), strconv.FormatInt(row.Down, 10),
+			satisfaction, strconv.FormatInt(row.AvgLatencyMs, 10), strconv.FormatInt(row.Comments, 10),
+		})
+	}
+	w.Flush()
+}
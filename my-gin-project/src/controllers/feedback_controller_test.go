@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"my-gin-project/src/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedback(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{replies: []string{"Essaie Annecy"}})
+	_, aliceToken, _ := adminAndUser(t, router)
+	var out AIResponse
+	json.Unmarshal(sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Une idée ?"}).Body.Bytes(), &out)
+	path := "/conversations/history/" + strconv.Itoa(int(out.MessageID)) + "/feedback"
+
+	// Le modèle et la durée de génération sont enregistrés avec la réponse
+	var reply models.ConversationHistory
+	models.DB.First(&reply, out.MessageID)
+	if reply.Model != "fake" || reply.LatencyMs < 0 {
+		t.Errorf("Unexpected reply: %+v", reply)
+	}
+
+	if resp := sendJSON(router, "PUT", "/conversations/history/"+strconv.Itoa(int(*reply.ParentID))+"/feedback", aliceToken, map[string]string{"rating": "up"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when rating a question, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", path, aliceToken, map[string]string{"rating": "meh"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid rating, got %d", resp.Code)
+	}
+	bobToken := loginToken(t, router, "bob", "password")
+	if resp := sendJSON(router, "PUT", path, bobToken, map[string]string{"rating": "up"}); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's reply, got %d", resp.Code)
+	}
+
+	sendJSON(router, "PUT", path, aliceToken, map[string]string{"rating": "up"})
+	resp := sendJSON(router, "PUT", path, aliceToken, map[string]string{"rating": "down", "comment": "Il pleut tout le temps"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var count int64
+	models.DB.Model(&models.MessageFeedback{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the rating to be replaced, got %d ratings", count)
+	}
+
+	var list HistoryList
+	json.Unmarshal(sendJSON(router, "GET", "/conversations/history", aliceToken, nil).Body.Bytes(), &list)
+	if f := list.Messages[0].Feedback; f == nil || f.Rating != models.FeedbackDown || f.Comment != "Il pleut tout le temps" {
+		t.Errorf("Expected the rating in the history, got %+v", list.Messages[0])
+	}
+
+	if resp := sendJSON(router, "DELETE", path, aliceToken, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.Code)
+	}
+	models.DB.Model(&models.MessageFeedback{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the rating to be deleted, got %d", count)
+	}
+}
+
+func TestQualityReport(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{})
+	adminToken, aliceToken, _ := adminAndUser(t, router)
+	v1, v2 := 1, 2
+	monday := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)
+	for i, r := range []struct {
+		model   string
+		version *int
+		at      time.Time
+		latency int64
+		rating  string
+		comment string
+	}{
+		{"mistral", &v1, monday, 1000, models.FeedbackUp, ""},
+		{"mistral", &v1, monday.Add(time.Hour), 3000, models.FeedbackDown, "Hôtel fermé"},
+		{"mistral", &v1, monday.Add(2 * time.Hour), 2000, "", ""},
+		{"mistral", &v2, monday.AddDate(0, 0, 7), 500, models.FeedbackUp, ""},
+		{"llama3", &v2, monday.AddDate(0, 0, 7), 800, "", ""},
+	} {
+		reply := models.ConversationHistory{
+			UserID: 1, Role: models.MessageRoleAssistant, Sender: "bot", Message: "x", Seq: i + 1, Active: true,
+			Status: models.MessageStatusComplete, Persona: "travel", PromptVersion: r.version, Model: r.model,
+			LatencyMs: r.latency, CreatedAt: r.at,
+		}
+		models.DB.Create(&reply)
+		if r.rating != "" {
+			models.DB.Create(&models.MessageFeedback{MessageID: reply.ID, UserID: 1, Rating: r.rating, Comment: r.comment})
+		}
+	}
+
+	if resp := sendJSON(router, "GET", "/admin/feedback/report", aliceToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "GET", "/admin/feedback/report?group_by=user", adminToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown group, got %d", resp.Code)
+	}
+
+	resp := sendJSON(router, "GET", "/admin/feedback/report", adminToken, nil)
+	var report QualityReport
+	json.Unmarshal(resp.Body.Bytes(), &report)
+	if resp.Code != http.StatusOK || len(report.Rows) != 3 {
+		t.Fatalf("Unexpected report: %d %s", resp.Code, resp.Body.String())
+	}
+	first := report.Rows[0]
+	if first.Period != "2026-W42" || first.Model != "mistral" || *first.PromptVersion != 1 || first.Replies != 3 ||
+		first.Rated != 2 || first.Up != 1 || *first.Satisfaction != 0.5 || first.AvgLatencyMs != 2000 || first.Comments != 1 {
+		t.Errorf("Unexpected row: %+v", first)
+	}
+	if report.Rows[1].Model != "llama3" || report.Rows[1].Satisfaction != nil {
+		t.Errorf("Expected no satisfaction without ratings, got %+v", report.Rows[1])
+	}
+
+	report = QualityReport{}
+	json.Unmarshal(sendJSON(router, "GET", "/admin/feedback/report?group_by=model", adminToken, nil).Body.Bytes(), &report)
+	if len(report.Rows) != 2 || report.Rows[1].Model != "mistral" || report.Rows[1].Replies != 4 || report.Rows[1].Period != "" {
+		t.Errorf("Unexpected report by model: %+v", report.Rows)
+	}
+
+	resp = sendJSON(router, "GET", "/admin/feedback/report?group_by=template&format=csv", adminToken, nil)
+	lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+	if len(lines) != 3 || lines[0] != "period,model,persona,prompt_version,replies,rated,up,down,satisfaction,avg_latency_ms,comments" ||
+		lines[2] != ",,travel,2,2,1,1,0,1,650,0" {
+		t.Errorf("Unexpected CSV: %q", lines)
+	}
+
+	for period, want := range map[string]string{"day": "2026-10-12:3,2026-10-19:2", "month": "2026-10:5"} {
+		report = QualityReport{}
+		json.Unmarshal(sendJSON(router, "GET", "/admin/feedback/report?group_by=period&period="+period, adminToken, nil).Body.Bytes(), &report)
+		got := []string{}
+		for _, row := range report.Rows {
+			got = append(got, fmt.Sprintf("%s:%d", row.Period, row.Replies))
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("Unexpected report by %s: %v", period, got)
+		}
+	}
+}
+
+func TestPeriodColumn(t *testing.T) {
+	db := setupTestDB()
+	// Les semaines ISO à cheval sur deux années appartiennent à l'année de leur jeudi
+	for at, want := range map[string]string{"2027-01-01 12:00:00": "2026-W53", "2024-12-30 08:00:00": "2025-W01", "2026-10-18 23:59:00": "2026-W42"} {
+		var got string
+		db.Raw("SELECT "+periodColumn(db, PeriodWeek)+" FROM (SELECT ? AS created_at) AS h", at).Scan(&got)
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", at, want, got)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Formats d'export d'une conversation
+const (
+	HistoryFormatJSON     = "json"
+	HistoryFormatMarkdown = "markdown"
+	HistoryFormatHTML     = "html"
+)
+
+// HistoryMessage est un message de conversation tel que le voit son auteur
+type HistoryMessage struct {
+	ID     uint   `json:"id" example:"42"`
+	TurnID string `json:"turn_id" example:"9f2c4e1a7b3d5f60a1b2c3d4e5f60718"`
+	Seq    int    `json:"seq" example:"7"`
+	// Role : user ou assistant
+	Role    string `json:"role" example:"assistant"`
+	Sender  string `json:"sender" example:"bot"`
+	Message string `json:"message" example:"Le lac d'Annecy se découvre à vélo."`
+	// Status : complete, ou failed pour une question restée sans réponse
+	Status string `json:"status" example:"complete"`
+	// ParentID est le message précédent dans l'arbre de la conversation ; Active indique
+	// si le message fait partie de la branche active
+	ParentID      *uint  `json:"parent_id" example:"41"`
+	Active        bool   `json:"active" example:"true"`
+	Persona       string `json:"persona,omitempty" example:"travel"`
+	PromptVersion *int   `json:"prompt_version,omitempty" example:"2"`
+	// Model et LatencyMs (durée de génération en millisecondes) décrivent la production d'une réponse
+	Model     string    `json:"model,omitempty" example:"mistral"`
+	LatencyMs int64     `json:"latency_ms,omitempty" example:"2350"`
+	CreatedAt time.Time `json:"created_at"`
+	// Feedback est l'avis de l'utilisateur sur une réponse
+	Feedback *models.MessageFeedback `json:"feedback,omitempty"`
+}
+
+type HistoryList struct {
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Messages []HistoryMessage `json:"messages"`
+}
+
+// HistoryExport est l'export JSON d'une conversation, dans l'ordre chronologique
+type HistoryExport struct {
+	User       string           `json:"user" example:"thomas"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Messages   []HistoryMessage `json:"messages"`
+}
+
+func newHistoryMessage(row models.ConversationHistory) HistoryMessage {
+	return HistoryMessage{
+		ID:            row.ID,
+		TurnID:        row.TurnID,
+		Seq:           row.Seq,
+		Role:          row.Role,
+		Sender:        row.Sender,
+		Message:       row.Message,
+		Status:        row.Status,
+		ParentID:      row.ParentID,
+		Active:        row.Active,
+		Persona:       row.Persona,
+		PromptVersion: row.PromptVersion,
+		Model:         row.Model,
+		LatencyMs:     row.LatencyMs,
+		CreatedAt:     row.CreatedAt,
+	}
+}
+
+// historyFilters restreint la requête aux messages de userID, filtrés par q (recherche plein texte),
+// from et to (RFC 3339) et active (branche active seulement ; active vaut activeDefault s'il est absent)
+func historyFilters(ctx *gin.Context, db *gorm.DB, userID uint, activeDefault string) (*gorm.DB, error) {
+	query := db.Model(&models.ConversationHistory{}).Where("user_id = ?", userID)
+	if v := ctx.DefaultQuery("active", activeDefault); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("Invalid active")
+		}
+		if active {
+			query = query.Where("active = ?", true)
+		}
+	}
+	if q := strings.TrimSpace(ctx.Query("q")); q != "" {
+		if db.Dialector.Name() == "mysql" {
+			// Index FULLTEXT ft_conversation_history (parser ngram), comme pour la recherche d'items
+			query = query.Where("MATCH(message) AGAINST (? IN NATURAL LANGUAGE MODE)", q)
+		} else {
+			for _, term := range strings.Fields(strings.ToLower(q)) {
+				query = query.Where("LOWER(message) LIKE ?", "%"+term+"%")
+			}
+		}
+	}
+	for param, cond := range map[string]string{"from": "created_at >= ?", "to": "created_at <= ?"} {
+		if v := ctx.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s", param)
+			}
+			query = query.Where(cond, t)
+		}
+	}
+	return query, nil
+}
+
+// historyPage renvoie une page des messages de query, les plus récents d'abord
+func historyPage(ctx *gin.Context, query *gorm.DB) (HistoryList, error) {
+	page, size := pagination(ctx)
+	resp := HistoryList{Page: page, PageSize: size, Messages: []HistoryMessage{}}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		return resp, err
+	}
+	var rows []models.ConversationHistory
+	if err := query.Order("seq desc").Limit(size).Offset((page - 1) * size).Find(&rows).Error; err != nil {
+		return resp, err
+	}
+	for _, row := range rows {
+		resp.Messages = append(resp.Messages, newHistoryMessage(row))
+	}
+	return resp, attachFeedback(resp.Messages)
+}
+
+// GET /conversations/history - historique de l'utilisateur connecté
+// @Summary List conversation history
+// @Description Messages exchanged with the AI assistant by the current user, most recent first, with full-text search
+// @Tags conversations
+// @Produce json
+// @Param q query string false "Full-text search in the messages"
+// @Param active query bool false "Only the messages of the active branch"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Messages per page (max 200)"
+// @Success 200 {object} HistoryList
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history [get]
+func (c *Controller) GetHistory(ctx *gin.Context) {
+	query, err := historyFilters(ctx, models.DB, ctx.GetUint(ContextUserID), "")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := historyPage(ctx, query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// GET /conversations/history/export - exporter la conversation
+// @Summary Export conversation history
+// @Description Download the current user's conversation in chronological order, as JSON, Markdown or HTML ready to be printed to PDF
+// @Tags conversations
+// @Produce json,text/markdown,text/html
+// @Param format query string false "json (default), markdown or html"
+// @Param q query string false "Full-text search in the messages"
+// @Param active query bool false "Only the messages of the active branch (default true)"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Success 200 {object} HistoryExport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/export [get]
+func (c *Controller) ExportHistory(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", HistoryFormatJSON)
+	if format != HistoryFormatJSON && format != HistoryFormatMarkdown && format != HistoryFormatHTML {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	query, err := historyFilters(ctx, models.DB, ctx.GetUint(ContextUserID), "true")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []models.ConversationHistory
+	if err := query.Order("seq").Find(&rows).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+	export := HistoryExport{User: ctx.GetString(ContextUsername), ExportedAt: time.Now(), Messages: []HistoryMessage{}}
+	for _, row := range rows {
+		export.Messages = append(export.Messages, newHistoryMessage(row))
+	}
+	if err := attachFeedback(export.Messages); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+
+	var body bytes.Buffer
+	contentType, ext := "application/json", "json"
+	switch format {
+	case HistoryFormatJSON:
+		enc := json.NewEncoder(&body)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(export)
+	case HistoryFormatMarkdown:
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+		writeHistoryMarkdown(&body, export)
+	case HistoryFormatHTML:
+		contentType, ext = "text/html; charset=utf-8", "html"
+		err = historyHTML.Execute(&body, export)
+	}
+	if err != nil {
+		fmt.Println("[ERROR] Export de la conversation:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export conversation history"})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation.%s"`, ext))
+	ctx.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// historySpeaker est le libellé d'un message dans les exports
+func historySpeaker(m HistoryMessage) string {
+	if m.Role == models.MessageRoleAssistant {
+		return "Assistant"
+	}
+	return m.Sender
+}
+
+func writeHistoryMarkdown(buf *bytes.Buffer, export HistoryExport) {
+	fmt.Fprintf(buf, "# Conversation de %s avec l'assistant\n\n", export.User)
+	fmt.Fprintf(buf, "_Exportée le %s_\n", export.ExportedAt.Format("02/01/2006 15:04"))
+	for _, m := range export.Messages {
+		fmt.Fprintf(buf, "\n### %s — %s\n\n%s\n", historySpeaker(m), m.CreatedAt.Format("02/01/2006 15:04"), strings.TrimSpace(m.Message))
+		if m.Status == models.MessageStatusFailed {
+			buf.WriteString("\n> Aucune réponse : la génération a échoué.\n")
+		}
+	}
+}
+
+// historyHTML met en page la conversation pour l'impression (Ctrl+P, « Enregistrer au format PDF »)
+var historyHTML = template.Must(template.New("history").Funcs(template.FuncMap{
+	"speaker": historySpeaker,
+	"date":    func(t time.Time) string { return t.Format("02/01/2006 15:04") },
+	"failed":  func(m HistoryMessage) bool { return m.Status == models.MessageStatusFailed },
+}).Parse(`<!DOCTYPE html>
+<html lang="fr">
+<head>
+<meta charset="utf-8">
+<title>Conversation de {{.User}}</title>
+<style>
+@page { size: A4; margin: 2cm; }
+body { font-family: sans-serif; font-size: 11pt; color: #222; max-width: 48em; margin: 0 auto; }
+.message { margin: 1em 0; padding: .6em .9em; border-radius: 6px; break-inside: avoid; }
+.user { background: #eef3fb; }
+.assistant { background: #f4f4f4; }
+.meta { font-size: 9pt; color: #666; margin-bottom: .3em; }
+.text { white-space: pre-wrap; }
+.failed { font-style: italic; color: #a33; }
+</style>
+</head>
+<body>
+<h1>Conversation de {{.User}} avec l'assistant</h1>
+<p class="meta">Exportée le {{date .ExportedAt}}</p>
+{{range .Messages}}<div class="message {{.Role}}">
+<div class="meta">{{speaker .}} — {{date .CreatedAt}}</div>
+<div class="text">{{.Message}}</div>
+{{if failed .}}<div class="failed">Aucune réponse : la génération a échoué.</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+// DELETE /conversations/history/:id - supprimer un message
+// @Summary Delete a message
+// @Description Permanently erase one of the current user's messages and the tool results and moderation flags attached to it.
+// @Description Deleting a question also deletes its replies (the whole turn); the following messages are attached to the previous turn
+// @Tags conversations
+// @Param id path int true "Message ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history/{id} [delete]
+func (c *Controller) DeleteHistoryMessage(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var row models.ConversationHistory
+	if err := models.DB.Where("id = ? AND user_id = ?", id, ctx.GetUint(ContextUserID)).First(&row).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		// Une question est supprimée avec ses réponses (toutes les versions de l'échange),
+		// qui n'auraient plus de sens seules
+		ids := []uint{row.ID}
+		if row.Role == models.MessageRoleUser && row.TurnID != "" {
+			if err := tx.Model(&models.ConversationHistory{}).Where("user_id = ? AND turn_id = ?", row.UserID, row.TurnID).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.ToolInvocation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.MessageFeedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.ModerationFlag{}).Error; err != nil {
+			return err
+		}
+		// La consommation reste décomptée des quotas, sans lien vers le message effacé
+		if err := tx.Model(&models.AIUsage{}).Where("message_id IN ?", ids).Update("message_id", nil).Error; err != nil {
+			return err
+		}
+		// Les messages suivants se rattachent au parent du message supprimé
+		if err := tx.Model(&models.ConversationHistory{}).Where("parent_id IN ? AND id NOT IN ?", ids, ids).
+			Update("parent_id", row.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.ConversationHistory{}).Error; err != nil {
+			return err
+		}
+		// Le contenu effacé n'est pas recopié dans le journal d'audit
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionDelete, ResourceType: "conversation_message", ResourceID: row.ID,
+			Before: gin.H{"turn_id": row.TurnID, "seq": row.Seq, "role": row.Role, "messages": len(ids)},
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DELETE /conversations/history - effacer tout l'historique
+// @Summary Delete conversation history
+// @Description Permanently erase all of the current user's messages, tool results and moderation flags (right to erasure). Token usage is kept, without link to the messages, and still counts towards the quotas
+// @Tags conversations
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /conversations/history [delete]
+func (c *Controller) DeleteHistory(ctx *gin.Context) {
+	userID := ctx.GetUint(ContextUserID)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ToolInvocation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MessageFeedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ModerationFlag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AIUsage{}).Where("user_id = ?", userID).Update("message_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", userID).Delete(&models.ConversationHistory{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionDelete, ResourceType: "conversation_history", ResourceID: userID,
+			Before: gin.H{"messages": result.RowsAffected},
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation history"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GET /admin/users/:id/conversations - consulter les conversations d'un utilisateur
+// @Summary Get user conversations
+// @Description Messages of a user, most recent first (admin only). A reason is required and every access is written to the audit log.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Param reason query string true "Why the conversation is consulted (support ticket, abuse report...)"
+// @Param q query string false "Full-text search in the messages"
+// @Param active query bool false "Only the messages of the active branch"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Messages per page (max 200)"
+// @Success 200 {object} HistoryList
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/conversations [get]
+func (c *Controller) GetUserConversations(ctx *gin.Context) {
+	reason := strings.TrimSpace(ctx.Query("reason"))
+	if reason == "" || len(reason) > 255 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to view a user's conversations"})
+		return
+	}
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	query, err := historyFilters(ctx, models.DB, user.ID, "")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := historyPage(ctx, query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation history"})
+		return
+	}
+
+	// La consultation n'est possible que si elle est tracée
+	err = audit.Record(models.DB, auditMeta(ctx), audit.Event{
+		Action: models.AuditActionRead, ResourceType: "conversation_history", ResourceID: user.ID,
+		After: gin.H{"reason": reason, "query": ctx.Request.URL.RawQuery, "messages": len(resp.Messages)},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record access"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupHistoryRouter(model llm.Client) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	ctrl := &Controller{DB: models.DB, LLM: model}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	r.POST("/chat-ai", OptionalAuth(), ctrl.ChatAI)
+	conversations := r.Group("/conversations", AuthMiddleware(), RequireUserSession())
+	conversations.GET("/history", ctrl.GetHistory)
+	conversations.GET("/history/export", ctrl.ExportHistory)
+	conversations.DELETE("/history", ctrl.DeleteHistory)
+	conversations.DELETE("/history/:id", ctrl.DeleteHistoryMessage)
+	conversations.POST("/regenerate", ctrl.RegenerateReply)
+	conversations.POST("/history/:id/edit", ctrl.EditMessage)
+	conversations.POST("/history/:id/activate", ctrl.ActivateBranch)
+	conversations.PUT("/history/:id/feedback", ctrl.PutFeedback)
+	conversations.DELETE("/history/:id/feedback", ctrl.DeleteFeedback)
+	r.GET("/admin/users/:id/conversations", AuthMiddleware(), RequireRole(models.RoleAdmin), RequireUserSession(), ctrl.GetUserConversations)
+	r.GET("/admin/feedback/report", AuthMiddleware(), RequireRole(models.RoleAdmin), RequireUserSession(), ctrl.GetQualityReport)
+	r.GET("/admin/moderation/flags", AuthMiddleware(), RequireRole(models.RoleAdmin), RequireUserSession(), ctrl.GetModerationFlags)
+	return r
+}
+
+func TestConversationHistory(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{replies: []string{"Essaie Annecy", "En train depuis Lyon", "Bonjour !"}})
+	adminToken, aliceToken, _ := adminAndUser(t, router)
+	sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Une idée de week-end au bord d'un lac ?"})
+	sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Comment aller à Annecy ?"})
+	sendJSON(router, "POST", "/chat-ai", adminToken, map[string]string{"text": "Annecy en hiver ?"})
+
+	resp := sendJSON(router, "GET", "/conversations/history?page_size=3", aliceToken, nil)
+	var list HistoryList
+	json.Unmarshal(resp.Body.Bytes(), &list)
+	if resp.Code != http.StatusOK || list.Total != 4 || len(list.Messages) != 3 {
+		t.Fatalf("Unexpected history: %d %s", resp.Code, resp.Body.String())
+	}
+	if list.Messages[0].Message != "En train depuis Lyon" || list.Messages[0].Seq != 4 || list.Messages[0].Role != models.MessageRoleAssistant {
+		t.Errorf("Expected the most recent message first, got %+v", list.Messages[0])
+	}
+
+	// La recherche ne porte que sur les messages de l'utilisateur
+	list = HistoryList{}
+	json.Unmarshal(sendJSON(router, "GET", "/conversations/history?q=annecy", aliceToken, nil).Body.Bytes(), &list)
+	if list.Total != 2 {
+		t.Errorf("Expected 2 messages about Annecy, got %+v", list)
+	}
+	if resp := sendJSON(router, "GET", "/conversations/history?from=hier", aliceToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid date, got %d", resp.Code)
+	}
+}
+
+func TestExportConversationHistory(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{replies: []string{"Essaie <b>Annecy</b>"}})
+	aliceToken := loginToken(t, router, "alice", "password")
+	sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Une idée de week-end ?"})
+
+	resp := sendJSON(router, "GET", "/conversations/history/export", aliceToken, nil)
+	var export HistoryExport
+	json.Unmarshal(resp.Body.Bytes(), &export)
+	if resp.Code != http.StatusOK || export.User != "alice" || len(export.Messages) != 2 || export.Messages[0].Role != models.MessageRoleUser {
+		t.Fatalf("Unexpected JSON export: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = sendJSON(router, "GET", "/conversations/history/export?format=markdown", aliceToken, nil)
+	if !strings.Contains(resp.Body.String(), "### alice") || !strings.Contains(resp.Header().Get("Content-Disposition"), "conversation.md") {
+		t.Errorf("Unexpected Markdown export: %s", resp.Body.String())
+	}
+
+	// Le contenu des messages est échappé dans l'export HTML
+	resp = sendJSON(router, "GET", "/conversations/history/export?format=html", aliceToken, nil)
+	if !strings.Contains(resp.Body.String(), "&lt;b&gt;Annecy&lt;/b&gt;") || !strings.Contains(resp.Body.String(), "@page") {
+		t.Errorf("Unexpected HTML export: %s", resp.Body.String())
+	}
+
+	if resp := sendJSON(router, "GET", "/conversations/history/export?format=pdf", aliceToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", resp.Code)
+	}
+}
+
+func TestDeleteConversationHistory(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{})
+	_, aliceToken, _ := adminAndUser(t, router)
+	bobToken := loginToken(t, router, "bob", "password")
+	for _, token := range []string{aliceToken, aliceToken, bobToken} {
+		sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Bonjour"})
+	}
+	var bobMessage models.ConversationHistory
+	models.DB.Where("sender = ?", "bob").First(&bobMessage)
+	var aliceMessage, aliceReply models.ConversationHistory
+	models.DB.Where("sender = ?", "alice").First(&aliceMessage)
+	models.DB.Where("parent_id = ?", aliceMessage.ID).First(&aliceReply)
+	models.DB.Create(&models.ToolInvocation{UserID: aliceMessage.UserID, MessageID: &aliceReply.ID, Tool: "get_user_profile"})
+
+	if resp := sendJSON(router, "DELETE", "/conversations/history/"+strconv.Itoa(int(bobMessage.ID)), aliceToken, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's message, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "DELETE", "/conversations/history/"+strconv.Itoa(int(aliceMessage.ID)), aliceToken, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// La question est supprimée avec sa réponse : l'échange suivant se rattache au parent de la question
+	var rows []models.ConversationHistory
+	models.DB.Where("user_id = ?", aliceMessage.UserID).Order("seq").Find(&rows)
+	if len(rows) != 2 || rows[0].Seq != 3 || rows[0].ParentID != nil || *rows[1].ParentID != rows[0].ID {
+		t.Errorf("Expected the next turn to be attached to the deleted question's parent: %+v", rows)
+	}
+	var count int64
+	models.DB.Model(&models.ToolInvocation{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the tool invocation to be deleted with its turn, got %d", count)
+	}
+
+	if resp := sendJSON(router, "DELETE", "/conversations/history", aliceToken, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.Code)
+	}
+	models.DB.Model(&models.ConversationHistory{}).Where("user_id = ?", aliceMessage.UserID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected alice's history to be erased, %d messages left", count)
+	}
+	models.DB.Model(&models.ConversationHistory{}).Where("user_id = ?", bobMessage.UserID).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected bob's history to be kept, got %d messages", count)
+	}
+
+	// Le journal d'audit trace les suppressions sans conserver le texte effacé
+	var logs []models.AuditLog
+	models.DB.Where("resource_type LIKE ?", "conversation%").Find(&logs)
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(logs))
+	}
+	for _, log := range logs {
+		if strings.Contains(string(log.Changes), "Bonjour") || strings.Contains(string(log.Changes), "OK") {
+			t.Errorf("Audit entry should not contain the erased messages: %s", log.Changes)
+		}
+	}
+}
+
+func TestAdminUserConversations(t *testing.T) {
+	setupTestDB()
+	router := setupHistoryRouter(&fakeLLM{})
+	adminToken, aliceToken, aliceID := adminAndUser(t, router)
+	sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Ma réservation a disparu"})
+	path := "/admin/users/" + aliceID + "/conversations"
+
+	if resp := sendJSON(router, "GET", path+"?reason=test", aliceToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "GET", path, adminToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a reason, got %d", resp.Code)
+	}
+	var count int64
+	models.DB.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionRead).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no access to be recorded, got %d", count)
+	}
+
+	resp := sendJSON(router, "GET", path+"?reason=Ticket+4521", adminToken, nil)
+	var list HistoryList
+	json.Unmarshal(resp.Body.Bytes(), &list)
+	if resp.Code != http.StatusOK || list.Total != 2 {
+		t.Fatalf("Unexpected conversations: %d %s", resp.Code, resp.Body.String())
+	}
+	var log models.AuditLog
+	models.DB.Where("action = ?", models.AuditActionRead).First(&log)
+	if log.Actor != "admin" || log.ResourceType != "conversation_history" || log.ResourceID != aliceID || !strings.Contains(string(log.Changes), "Ticket 4521") {
+		t.Errorf("Unexpected audit entry: %+v %s", log, log.Changes)
+	}
+}
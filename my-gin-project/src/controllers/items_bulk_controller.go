@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Modes d'exécution de POST /items/bulk
+const (
+	BulkModeAtomic     = "atomic"
+	BulkModeBestEffort = "best_effort"
+)
+
+// Actions possibles d'une opération bulk
+const (
+	BulkActionCreate = "create"
+	BulkActionUpdate = "update"
+	BulkActionDelete = "delete"
+)
+
+var errBulkAborted = errors.New("bulk operation aborted")
+
+type BulkOperation struct {
+	Action string       `json:"action" example:"create" enums:"create,update,delete"`
+	ID     int          `json:"id,omitempty" example:"0"`
+	Item   *models.Item `json:"item,omitempty"`
+}
+
+type BulkRequest struct {
+	Mode       string          `json:"mode" example:"atomic" enums:"atomic,best_effort"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+type BulkResult struct {
+	Index  int          `json:"index"`
+	Action string       `json:"action"`
+	ID     int          `json:"id,omitempty"`
+	Status int          `json:"status" example:"201"`
+	Error  string       `json:"error,omitempty"`
+	Item   *models.Item `json:"item,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// BulkLimits sont les limites de POST /items/bulk
+type BulkLimits struct {
+	// MaxOperations est le nombre maximal d'opérations par requête
+	MaxOperations int
+	// InsertBatchSize est le nombre de lignes par INSERT pour les créations
+	InsertBatchSize int
+}
+
+// DefaultBulkLimits renvoie les limites par défaut de POST /items/bulk
+func DefaultBulkLimits() BulkLimits {
+	return BulkLimits{MaxOperations: 1000, InsertBatchSize: 100}
+}
+
+// BulkLimitsFromEnv lit BULK_MAX_OPERATIONS et BULK_INSERT_BATCH_SIZE, qui doivent être des entiers positifs :
+// une valeur invalide est refusée au démarrage plutôt que de bloquer ou de désactiver les opérations bulk
+func BulkLimitsFromEnv() (BulkLimits, error) {
+	limits := DefaultBulkLimits()
+	for key, value := range map[string]*int{"BULK_MAX_OPERATIONS": &limits.MaxOperations, "BULK_INSERT_BATCH_SIZE": &limits.InsertBatchSize} {
+		v := config.String(key, "")
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return BulkLimits{}, fmt.Errorf("%s must be a positive integer, got %q", key, v)
+		}
+		*value = n
+	}
+	return limits, nil
+}
+
+// bulkLimits renvoie les limites du controller, complétées par les valeurs par défaut
+func (c *Controller) bulkLimits() BulkLimits {
+	limits, def := c.Bulk, DefaultBulkLimits()
+	if limits.MaxOperations <= 0 {
+		limits.MaxOperations = def.MaxOperations
+	}
+	if limits.InsertBatchSize <= 0 {
+		limits.InsertBatchSize = def.InsertBatchSize
+	}
+	return limits
+}
+
+// POST /items/bulk - créer, modifier et supprimer des items en une requête
+// @Summary Bulk item operations
+// @Description Apply a batch of create/update/delete operations.
+// @Description In "atomic" mode (default) every operation succeeds or none is applied; in "best_effort" mode each operation reports its own status.
+// @Description Creates are inserted in batches before updates and deletes, which are applied in request order.
+// @Tags items
+// @Accept json
+// @Produce json
+// @Param operations body BulkRequest true "Operations"
+// @Success 200 {object} BulkResponse
+// @Success 207 {object} BulkResponse "Some operations failed (best_effort mode)"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} BulkResponse "Transaction rolled back (atomic mode)"
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /items/bulk [post]
+func (c *Controller) BulkItems(ctx *gin.Context) {
+	var req BulkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = BulkModeAtomic
+	}
+	if req.Mode != BulkModeAtomic && req.Mode != BulkModeBestEffort {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode"})
+		return
+	}
+	if len(req.Operations) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No operations"})
+		return
+	}
+	limits := c.bulkLimits()
+	if limit := limits.MaxOperations; len(req.Operations) > limit {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Too many operations", "max": limit})
+		return
+	}
+
+	results := validateBulkOperations(req.Operations)
+	atomic := req.Mode == BulkModeAtomic
+
+	var err error
+	if atomic {
+		if bulkFailed(results) {
+			err = errBulkAborted
+		} else {
+			err = models.DB.Transaction(func(tx *gorm.DB) error {
+				return runBulkOperations(tx, auditMeta(ctx), req.Operations, results, limits.InsertBatchSize, true)
+			})
+		}
+	} else {
+		runBulkOperations(models.DB, auditMeta(ctx), req.Operations, results, limits.InsertBatchSize, false)
+	}
+
+	resp := BulkResponse{Mode: req.Mode, Results: results}
+	if err != nil {
+		// La transaction est annulée : aucune opération n'a été appliquée
+		for i := range results {
+			if results[i].Status < http.StatusBadRequest {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Error = "Not applied: another operation failed"
+				results[i].Item = nil
+			}
+		}
+	}
+	for _, r := range results {
+		if r.Status < http.StatusBadRequest {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	switch {
+	case err != nil:
+		ctx.JSON(http.StatusUnprocessableEntity, resp)
+	case resp.Failed > 0:
+		ctx.JSON(http.StatusMultiStatus, resp)
+	default:
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+// validateBulkOperations vérifie chaque opération avant exécution ;
+// les opérations invalides reçoivent un statut 400
+func validateBulkOperations(ops []BulkOperation) []BulkResult {
+	results := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = BulkResult{Index: i, Action: op.Action, ID: op.ID}
+
+		var err error
+		switch op.Action {
+		case BulkActionCreate:
+			if op.Item == nil {
+				err = errors.New("item is required")
+			} else {
+				err = op.Item.Validate()
+			}
+		case BulkActionUpdate:
+			if op.ID <= 0 {
+				err = errors.New("id is required")
+			} else if op.Item == nil {
+				err = errors.New("item is required")
+			} else {
+				err = op.Item.Validate()
+			}
+		case BulkActionDelete:
+			if op.ID <= 0 {
+				err = errors.New("id is required")
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+func bulkFailed(results []BulkResult) bool {
+	for _, r := range results {
+		if r.Status >= http.StatusBadRequest {
+			return true
+		}
+	}
+	return false
+}
+
+// runBulkOperations exécute les opérations valides. Les créations sont insérées par lots.
+// Chaque écriture et son entrée d'audit partagent une transaction.
+// Si stopOnError est vrai, la première erreur interrompt l'exécution et est renvoyée.
+func runBulkOperations(db *gorm.DB, meta audit.Meta, ops []BulkOperation, results []BulkResult, batchSize int, stopOnError bool) error {
+	var creates []int
+	var items []models.Item
+	for i, op := range ops {
+		if op.Action == BulkActionCreate && results[i].Status == 0 {
+			item := *op.Item
+			item.ID = 0
+			creates = append(creates, i)
+			items = append(items, item)
+		}
+	}
+
+	if len(items) > 0 {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(&items, batchSize).Error; err != nil {
+				return err
+			}
+			events := make([]audit.Event, len(items))
+			for n, item := range items {
+				events[n] = audit.Event{Action: models.AuditActionCreate, ResourceType: "item", ResourceID: item.ID, After: item}
+			}
+			return audit.RecordMany(tx, meta, events)
+		})
+		if err != nil {
+			if stopOnError {
+				results[creates[0]].Status = http.StatusInternalServerError
+				results[creates[0]].Error = "Failed to create item"
+				return err
+			}
+			// Un lot en échec : on retente item par item pour isoler les erreurs
+			for n := range items {
+				items[n].ID = 0
+				err := db.Transaction(func(tx *gorm.DB) error {
+					if err := tx.Create(&items[n]).Error; err != nil {
+						return err
+					}
+					return audit.Record(tx, meta, audit.Event{
+						Action: models.AuditActionCreate, ResourceType: "item", ResourceID: items[n].ID, After: items[n],
+					})
+				})
+				if err != nil {
+					results[creates[n]].Status = http.StatusInternalServerError
+					results[creates[n]].Error = "Failed to create item"
+					continue
+				}
+				setBulkResult(&results[creates[n]], http.StatusCreated, items[n])
+			}
+		} else {
+			for n, i := range creates {
+				setBulkResult(&results[i], http.StatusCreated, items[n])
+			}
+		}
+	}
+
+	for i, op := range ops {
+		if op.Action == BulkActionCreate || results[i].Status != 0 {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var item models.Item
+			if err := tx.First(&item, op.ID).Error; err != nil {
+				results[i].Status = http.StatusNotFound
+				results[i].Error = "Item not found"
+				return err
+			}
+			before := item
+
+			switch op.Action {
+			case BulkActionUpdate:
+				item.Name = op.Item.Name
+				item.Description = op.Item.Description
+				item.Price = op.Item.Price
+				if err := tx.Save(&item).Error; err != nil {
+					results[i].Status = http.StatusInternalServerError
+					results[i].Error = "Failed to update item"
+					return err
+				}
+				if err := audit.Record(tx, meta, audit.Event{
+					Action: models.AuditActionUpdate, ResourceType: "item", ResourceID: item.ID, Before: before, After: item,
+				}); err != nil {
+					results[i].Status = http.StatusInternalServerError
+					results[i].Error = "Failed to update item"
+					return err
+				}
+				setBulkResult(&results[i], http.StatusOK, item)
+			case BulkActionDelete:
+				if err := tx.Delete(&item).Error; err != nil {
+					results[i].Status = http.StatusInternalServerError
+					results[i].Error = "Failed to delete item"
+					return err
+				}
+				if err := audit.Record(tx, meta, audit.Event{
+					Action: models.AuditActionDelete, ResourceType: "item", ResourceID: item.ID, Before: before,
+				}); err != nil {
+					results[i].Status = http.StatusInternalServerError
+					results[i].Error = "Failed to delete item"
+					return err
+				}
+				results[i].Status = http.StatusNoContent
+			}
+			return nil
+		})
+
+		if stopOnError && err != nil {
+			return errBulkAborted
+		}
+	}
+	return nil
+}
+
+func setBulkResult(result *BulkResult, status int, item models.Item) {
+	result.Status = status
+	result.ID = item.ID
+	result.Item = &item
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupBulkRouter(ctrl *Controller) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/items/bulk", ctrl.BulkItems)
+	return r
+}
+
+func postBulk(router *gin.Engine, body string) (*httptest.ResponseRecorder, BulkResponse) {
+	req, _ := http.NewRequest("POST", "/items/bulk", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var out BulkResponse
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	return resp, out
+}
+
+func TestBulkItemsAtomic(t *testing.T) {
+	setupTestDB()
+	router := setupBulkRouter(&Controller{})
+	models.DB.Create(&models.Item{Name: "Train", Price: 40})
+
+	resp, out := postBulk(router, `{"operations": [
+		{"action": "create", "item": {"name": "Vol", "price": 120}},
+		{"action": "create", "item": {"name": "Bus", "price": 15}},
+		{"action": "update", "id": 1, "item": {"name": "TGV", "price": 60}}
+	]}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if out.Succeeded != 3 || out.Results[0].ID == 0 || out.Results[0].Status != http.StatusCreated {
+		t.Errorf("Unexpected response: %+v", out)
+	}
+
+	// Une opération en échec annule toute la transaction
+	resp, out = postBulk(router, `{"mode": "atomic", "operations": [
+		{"action": "delete", "id": 1},
+		{"action": "delete", "id": 999}
+	]}`)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if out.Results[0].Status != http.StatusFailedDependency || out.Results[1].Status != http.StatusNotFound {
+		t.Errorf("Unexpected results: %+v", out.Results)
+	}
+	var count int64
+	models.DB.Model(&models.Item{}).Where("id = ?", 1).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected item 1 to survive the rollback")
+	}
+}
+
+func TestBulkItemsBestEffort(t *testing.T) {
+	setupTestDB()
+	router := setupBulkRouter(&Controller{})
+
+	resp, out := postBulk(router, `{"mode": "best_effort", "operations": [
+		{"action": "create", "item": {"name": "Hotel", "price": 90}},
+		{"action": "create", "item": {"name": "", "price": 10}},
+		{"action": "delete", "id": 42}
+	]}`)
+	if resp.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if out.Succeeded != 1 || out.Failed != 2 {
+		t.Errorf("Unexpected counts: %+v", out)
+	}
+	if out.Results[1].Status != http.StatusBadRequest || out.Results[2].Status != http.StatusNotFound {
+		t.Errorf("Unexpected results: %+v", out.Results)
+	}
+}
+
+func TestBulkItemsMaxOperations(t *testing.T) {
+	setupTestDB()
+	router := setupBulkRouter(&Controller{Bulk: BulkLimits{MaxOperations: 1}})
+
+	resp, _ := postBulk(router, `{"operations": [{"action": "delete", "id": 1}, {"action": "delete", "id": 2}]}`)
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", resp.Code)
+	}
+}
+
+func TestBulkLimitsFromEnv(t *testing.T) {
+	t.Setenv("BULK_MAX_OPERATIONS", "50")
+	limits, err := BulkLimitsFromEnv()
+	if err != nil || limits.MaxOperations != 50 || limits.InsertBatchSize != 100 {
+		t.Fatalf("Unexpected limits: %+v %v", limits, err)
+	}
+
+	// Une limite nulle, négative ou non numérique est refusée au démarrage
+	for _, value := range []string{"0", "-1", "abc"} {
+		t.Setenv("BULK_INSERT_BATCH_SIZE", value)
+		if _, err := BulkLimitsFromEnv(); err == nil {
+			t.Errorf("Expected BULK_INSERT_BATCH_SIZE=%q to be rejected", value)
+		}
+	}
+}
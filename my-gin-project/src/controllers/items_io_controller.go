@@ -0,0 +1,534 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Formats d'import/export des items
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Actions rapportées par l'import
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionReject = "reject"
+)
+
+type ImportRow struct {
+	Line   int    `json:"line" example:"2"`
+	Action string `json:"action" example:"create" enums:"create,update,reject"`
+	ID     int    `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport compte les lignes créées, mises à jour et rejetées ; seules les lignes rejetées sont
+// détaillées, dans la limite de maxImportErrors, pour que la taille du rapport ne dépende pas du fichier
+type ImportReport struct {
+	DryRun   bool        `json:"dry_run"`
+	Key      string      `json:"key" example:"name"`
+	Created  int         `json:"created"`
+	Updated  int         `json:"updated"`
+	Rejected int         `json:"rejected"`
+	Errors   []ImportRow `json:"errors"`
+	// ErrorsTruncated indique que des lignes rejetées ne figurent pas dans Errors
+	ErrorsTruncated bool `json:"errors_truncated"`
+}
+
+// maxImportErrors est le nombre de lignes rejetées détaillées dans le rapport d'import
+const maxImportErrors = 100
+
+// GET /items/export - exporter les items
+// @Summary Export items
+// @Description Stream items as CSV or NDJSON (JSON Lines). Accepts the same filters as GET /items.
+// @Tags items
+// @Produce text/csv,application/x-ndjson
+// @Param format query string false "csv (default) or ndjson"
+// @Param name query string false "Name contains"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param sort query string false "Sort field: id, name or price, prefixed with - for descending order"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /items/export [get]
+func (c *Controller) ExportItems(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", FormatCSV)
+	if format != FormatCSV && format != FormatNDJSON {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	query, err := itemFilters(ctx, models.DB)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := query.Model(&models.Item{}).Rows()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
+		return
+	}
+	defer rows.Close()
+
+	contentType := "text/csv; charset=utf-8"
+	if format == FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="items.%s"`, format))
+	ctx.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(ctx.Writer)
+	encoder := json.NewEncoder(ctx.Writer)
+	if format == FormatCSV {
+		csvWriter.Write([]string{"id", "name", "description", "price"})
+	}
+
+	// Les lignes sont écrites au fil de l'eau, sans charger tous les items en mémoire
+	for n := 1; rows.Next(); n++ {
+		var item models.Item
+		if err := query.ScanRows(rows, &item); err != nil {
+			fmt.Println("[ERROR] Export items:", err)
+			break
+		}
+		if format == FormatCSV {
+			csvWriter.Write([]string{
+				strconv.Itoa(item.ID),
+				item.Name,
+				item.Description,
+				strconv.FormatFloat(item.Price, 'f', -1, 64),
+			})
+		} else {
+			encoder.Encode(item)
+		}
+		if n%500 == 0 {
+			csvWriter.Flush()
+			ctx.Writer.Flush()
+		}
+	}
+	csvWriter.Flush()
+}
+
+// POST /items/import - importer des items
+// @Summary Import items
+// @Description Import items from a CSV or NDJSON file, sent as the "file" field of a multipart form or as the raw request body.
+// @Description Rows are upserted by a natural key (name by default, or id) and processed in chunks.
+// @Description With dry_run=true nothing is written and the report shows what would be created, updated or rejected.
+// @Description The report counts the rows by action and details the first 100 rejected rows.
+// @Tags items
+// @Accept multipart/form-data,text/csv,application/x-ndjson
+// @Produce json
+// @Param file formData file false "CSV or NDJSON file"
+// @Param format query string false "csv or ndjson (detected from the content type or file extension by default)"
+// @Param key query string false "Upsert key: name (default) or id"
+// @Param mapping query string false "Header mapping, e.g. nom:name,prix:price"
+// @Param dry_run query bool false "Only report what would be done"
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /items/import [post]
+func (c *Controller) ImportItems(ctx *gin.Context) {
+	key := ctx.DefaultQuery("key", "name")
+	if key != "name" && key != "id" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+	mapping, err := parseHeaderMapping(ctx.Query("mapping"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(ctx.Query("dry_run"))
+
+	body, contentType, filename, err := importSource(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		format = detectImportFormat(contentType, filename)
+	}
+	var reader importReader
+	switch format {
+	case FormatCSV:
+		reader, err = newCSVImportReader(body, mapping)
+	case FormatNDJSON:
+		reader = newNDJSONImportReader(body, mapping)
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := ImportReport{DryRun: dryRun, Key: key, Errors: []ImportRow{}}
+	meta := auditMeta(ctx)
+	chunkSize := config.Int("IMPORT_CHUNK_SIZE", 500)
+	chunk := make([]importRecord, 0, chunkSize)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+			return
+		}
+		chunk = append(chunk, record)
+		if len(chunk) == chunkSize {
+			importChunk(models.DB, meta, chunk, key, dryRun, &report)
+			chunk = chunk[:0]
+		}
+	}
+	importChunk(models.DB, meta, chunk, key, dryRun, &report)
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// importSource renvoie le flux à importer : le champ "file" d'un formulaire multipart,
+// lu en streaming, ou à défaut le corps de la requête
+func importSource(ctx *gin.Context) (io.Reader, string, string, error) {
+	if !strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		return ctx.Request.Body, ctx.ContentType(), "", nil
+	}
+	mr, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, "", "", err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", "", errors.New("missing file")
+		}
+		if err != nil {
+			return nil, "", "", err
+		}
+		if part.FormName() == "file" {
+			contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			return part, contentType, part.FileName(), nil
+		}
+	}
+}
+
+func detectImportFormat(contentType, filename string) string {
+	switch contentType {
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return FormatNDJSON
+	case "text/csv":
+		return FormatCSV
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	}
+	return FormatCSV
+}
+
+// parseHeaderMapping lit un mapping "colonne:champ,colonne:champ" vers les champs d'un item
+func parseHeaderMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if s == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(pair, ":")
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid mapping %q", pair)
+		}
+		switch to {
+		case "id", "name", "description", "price":
+		default:
+			return nil, fmt.Errorf("invalid mapping target %q", to)
+		}
+		mapping[from] = to
+	}
+	return mapping, nil
+}
+
+func mapField(mapping map[string]string, name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if to, ok := mapping[name]; ok {
+		return to
+	}
+	return name
+}
+
+// importRecord est une ligne du fichier importé, avec ses champs déjà renommés
+type importRecord struct {
+	Line   int
+	Fields map[string]string
+	Err    error
+}
+
+type importReader interface {
+	// Next renvoie la ligne suivante, ou io.EOF en fin de fichier
+	Next() (importRecord, error)
+}
+
+type csvImportReader struct {
+	r       *csv.Reader
+	headers []string
+}
+
+func newCSVImportReader(r io.Reader, mapping map[string]string) (*csvImportReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("missing CSV header")
+	}
+	headers := make([]string, len(header))
+	for i, h := range header {
+		headers[i] = mapField(mapping, strings.TrimPrefix(h, "\ufeff"))
+	}
+	return &csvImportReader{r: cr, headers: headers}, nil
+}
+
+func (c *csvImportReader) Next() (importRecord, error) {
+	values, err := c.r.Read()
+	if err == io.EOF {
+		return importRecord{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRecord{Line: parseErr.Line, Err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return importRecord{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	fields := map[string]string{}
+	for i, v := range values {
+		if i < len(c.headers) {
+			fields[c.headers[i]] = v
+		}
+	}
+	return importRecord{Line: line, Fields: fields}, nil
+}
+
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	mapping map[string]string
+	line    int
+}
+
+func newNDJSONImportReader(r io.Reader, mapping map[string]string) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonImportReader{scanner: scanner, mapping: mapping}
+}
+
+func (n *ndjsonImportReader) Next() (importRecord, error) {
+	for n.scanner.Scan() {
+		n.line++
+		text := strings.TrimSpace(n.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &values); err != nil {
+			return importRecord{Line: n.line, Err: errors.New("invalid JSON")}, nil
+		}
+		fields := map[string]string{}
+		for k, v := range values {
+			if v != nil {
+				fields[mapField(n.mapping, k)] = fmt.Sprint(v)
+			}
+		}
+		return importRecord{Line: n.line, Fields: fields}, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return importRecord{}, err
+	}
+	return importRecord{}, io.EOF
+}
+
+// toItem convertit une ligne importée en item validé
+func (r importRecord) toItem() (models.Item, error) {
+	var item models.Item
+	if r.Err != nil {
+		return item, r.Err
+	}
+	if v := strings.TrimSpace(r.Fields["id"]); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return item, errors.New("invalid id")
+		}
+		item.ID = id
+	}
+	item.Name = strings.TrimSpace(r.Fields["name"])
+	item.Description = strings.TrimSpace(r.Fields["description"])
+	if v := strings.TrimSpace(r.Fields["price"]); v != "" {
+		// Accepte aussi la virgule décimale des tableurs français
+		price, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+		if err != nil {
+			return item, errors.New("invalid price")
+		}
+		item.Price = price
+	}
+	return item, item.Validate()
+}
+
+// importChunk upsert un lot de lignes par la clé naturelle key, dans une transaction
+func importChunk(db *gorm.DB, meta audit.Meta, chunk []importRecord, key string, dryRun bool, report *ImportReport) {
+	if len(chunk) == 0 {
+		return
+	}
+
+	rows := make([]ImportRow, len(chunk))
+	items := make([]models.Item, len(chunk))
+	var keys []interface{}
+	for i, record := range chunk {
+		item, err := record.toItem()
+		rows[i] = ImportRow{Line: record.Line, Name: item.Name, ID: item.ID}
+		if err != nil {
+			rows[i].Action, rows[i].Error = ImportActionReject, err.Error()
+			continue
+		}
+		items[i] = item
+		if k := importKey(item, key); k != nil {
+			keys = append(keys, k)
+		}
+	}
+
+	// Une seule requête pour retrouver les items existants du lot
+	var existing []models.Item
+	if len(keys) > 0 {
+		if err := db.Where(key+" IN ?", keys).Find(&existing).Error; err != nil {
+			rejectChunk(rows, "Failed to look up existing items")
+			appendImportRows(report, rows)
+			return
+		}
+	}
+	byKey := map[string]*models.Item{}
+	for i := range existing {
+		byKey[fmt.Sprint(importKey(existing[i], key))] = &existing[i]
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var events []audit.Event
+		for i := range chunk {
+			if rows[i].Action == ImportActionReject {
+				continue
+			}
+			item := items[i]
+			k := importKey(item, key)
+			current := byKey[fmt.Sprint(k)]
+			if k == nil || current == nil {
+				rows[i].Action = ImportActionCreate
+				if key == "name" {
+					item.ID = 0
+				}
+				if !dryRun {
+					if err := tx.Create(&item).Error; err != nil {
+						return err
+					}
+					events = append(events, audit.Event{
+						Action: models.AuditActionCreate, ResourceType: "item", ResourceID: item.ID, After: item,
+					})
+				}
+				rows[i].ID = item.ID
+				if k := importKey(item, key); k != nil {
+					byKey[fmt.Sprint(k)] = &item
+				}
+				continue
+			}
+
+			rows[i].Action, rows[i].ID = ImportActionUpdate, current.ID
+			before := *current
+			// Seules les colonnes présentes dans le fichier sont mises à jour
+			current.Name = item.Name
+			if _, ok := chunk[i].Fields["description"]; ok {
+				current.Description = item.Description
+			}
+			// Un prix vide n'est pas lu par toItem : il laisse le prix existant
+			if strings.TrimSpace(chunk[i].Fields["price"]) != "" {
+				current.Price = item.Price
+			}
+			if !dryRun {
+				if err := tx.Save(current).Error; err != nil {
+					return err
+				}
+				events = append(events, audit.Event{
+					Action: models.AuditActionUpdate, ResourceType: "item", ResourceID: current.ID, Before: before, After: *current,
+				})
+			}
+		}
+		return audit.RecordMany(tx, meta, events)
+	})
+	if err != nil {
+		fmt.Println("[ERROR] Import items:", err)
+		rejectChunk(rows, "Failed to save chunk")
+	}
+	appendImportRows(report, rows)
+}
+
+func importKey(item models.Item, key string) interface{} {
+	if key == "id" {
+		if item.ID == 0 {
+			return nil
+		}
+		return item.ID
+	}
+	return item.Name
+}
+
+func rejectChunk(rows []ImportRow, msg string) {
+	for i := range rows {
+		if rows[i].Action != ImportActionReject {
+			rows[i].Action, rows[i].Error = ImportActionReject, msg
+		}
+	}
+}
+
+func appendImportRows(report *ImportReport, rows []ImportRow) {
+	for _, row := range rows {
+		switch row.Action {
+		case ImportActionCreate:
+			report.Created++
+		case ImportActionUpdate:
+			report.Updated++
+		default:
+			report.Rejected++
+			if len(report.Errors) < maxImportErrors {
+				report.Errors = append(report.Errors, row)
+			} else {
+				report.ErrorsTruncated = true
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"my-gin-project/src/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupItemsIORouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{}
+	r.GET("/items/export", ctrl.ExportItems)
+	r.POST("/items/import", ctrl.ImportItems)
+	return r
+}
+
+func TestExportItems(t *testing.T) {
+	setupTestDB()
+	router := setupItemsIORouter()
+	models.DB.Create(&[]models.Item{{Name: "Vol Paris-Nice", Price: 89.9}, {Name: "Train Lyon", Price: 35}, {Name: "Vol Nantes", Price: 120}})
+
+	req, _ := http.NewRequest("GET", "/items/export?name=Vol&sort=-price", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	want := "id,name,description,price\n3,Vol Nantes,,120\n1,Vol Paris-Nice,,89.9\n"
+	if resp.Code != http.StatusOK || resp.Body.String() != want {
+		t.Errorf("Unexpected CSV export (%d): %q", resp.Code, resp.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/items/export?format=ndjson&max_price=50", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if got := strings.TrimSpace(resp.Body.String()); got != `{"id":2,"name":"Train Lyon","description":"","price":35}` {
+		t.Errorf("Unexpected NDJSON export: %q", got)
+	}
+}
+
+func TestImportItemsCSV(t *testing.T) {
+	setupTestDB()
+	router := setupItemsIORouter()
+	models.DB.Create(&models.Item{Name: "Hotel Nice", Price: 100})
+
+	csvData := "nom,prix\nHotel Nice,\"110,5\"\nGite Annecy,75\n,12\nHotel Nice,115\n"
+
+	importCSV := func(query string) ImportReport {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "catalogue.csv")
+		part.Write([]byte(csvData))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/items/import?mapping=nom:name,prix:price"+query, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var report ImportReport
+		json.Unmarshal(resp.Body.Bytes(), &report)
+		return report
+	}
+
+	report := importCSV("&dry_run=true")
+	if report.Created != 1 || report.Updated != 2 || report.Rejected != 1 {
+		t.Errorf("Unexpected dry-run report: %+v", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 4 || report.Errors[0].Action != ImportActionReject {
+		t.Errorf("Expected line 4 to be rejected, got %+v", report.Errors)
+	}
+	var count int64
+	models.DB.Model(&models.Item{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Dry run must not write, found %d items", count)
+	}
+
+	report = importCSV("")
+	if report.Created != 1 || report.Updated != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	var item models.Item
+	models.DB.Where("name = ?", "Hotel Nice").First(&item)
+	if item.Price != 115 {
+		t.Errorf("Expected Hotel Nice price 115, got %v", item.Price)
+	}
+}
+
+func TestImportItemsNDJSON(t *testing.T) {
+	setupTestDB()
+	router := setupItemsIORouter()
+
+	body := `{"name": "Croisiere", "price": 900}
+not json
+{"name": "Kayak", "price": 30}
+`
+	req, _ := http.NewRequest("POST", "/items/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var report ImportReport
+	json.Unmarshal(resp.Body.Bytes(), &report)
+	if report.Created != 2 || report.Rejected != 1 || report.Errors[0].Line != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
+
+func TestImportItemsKeepsMissingColumns(t *testing.T) {
+	setupTestDB()
+	router := setupItemsIORouter()
+	models.DB.Create(&models.Item{Name: "Hotel Nice", Description: "Vue mer", Price: 100})
+
+	// Sans colonne price ni description, ou avec un prix vide, les valeurs existantes sont conservées
+	for _, csvData := range []string{"id,name\n1,Hotel Nice Centre\n", "id,name,price\n1,Hotel Nice Centre,\n"} {
+		req, _ := http.NewRequest("POST", "/items/import?key=id", strings.NewReader(csvData))
+		req.Header.Set("Content-Type", "text/csv")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var item models.Item
+		models.DB.First(&item, 1)
+		if item.Name != "Hotel Nice Centre" || item.Price != 100 || item.Description != "Vue mer" {
+			t.Errorf("Expected only the name to change, got %+v", item)
+		}
+	}
+}
+
+func TestImportItemsCapsErrors(t *testing.T) {
+	setupTestDB()
+	router := setupItemsIORouter()
+
+	// Seules les premières lignes rejetées sont détaillées ; les compteurs portent sur tout le fichier
+	body := strings.Repeat("not json\n", maxImportErrors+5) + `{"name": "Kayak", "price": 30}` + "\n"
+	req, _ := http.NewRequest("POST", "/items/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var report ImportReport
+	json.Unmarshal(resp.Body.Bytes(), &report)
+	if report.Created != 1 || report.Rejected != maxImportErrors+5 || len(report.Errors) != maxImportErrors || !report.ErrorsTruncated {
+		t.Errorf("Unexpected report: created %d, rejected %d, %d errors, truncated %v", report.Created, report.Rejected, len(report.Errors), report.ErrorsTruncated)
+	}
+}
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/mfa"
+	"my-gin-project/src/models"
+	"my-gin-project/src/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Nombre de codes de secours générés à l'activation de la double authentification
+const recoveryCodeCount = 10
+
+const mfaPurpose = "mfa"
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URL    string `json:"otpauth_url" example:"otpauth://totp/Travel%20API:alice?issuer=Travel+API&secret=JBSWY3DPEHPK3PXP"`
+	QRCode string `json:"qr_code" example:"data:image/png;base64,iVBORw0KGgo..."`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code TOTP à 6 chiffres ou code de secours
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// mfaChallenge génère le token de courte durée échangé contre un token d'accès par POST /login/mfa
+func mfaChallenge(user models.User) (string, error) {
+	return signJWT(jwt.MapClaims{
+		"purpose":  mfaPurpose,
+		"username": user.Username,
+		"user_id":  user.ID,
+		"exp":      time.Now().Add(config.Duration("MFA_CHALLENGE_TTL", 5*time.Minute)).Unix(),
+	})
+}
+
+// parseMFAChallenge vérifie un token de défi et renvoie l'identifiant de l'utilisateur
+func parseMFAChallenge(tokenString string) (uint, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	id, ok := claims["user_id"].(float64)
+	if claims["purpose"] != mfaPurpose || !ok {
+		return 0, errors.New("invalid token")
+	}
+	return uint(id), nil
+}
+
+// issueRecoveryCodes remplace les codes de secours de user et renvoie les nouveaux codes en clair
+func issueRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := mfa.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+	return codes, tx.Create(&rows).Error
+}
+
+// saveUser enregistre les modifications de user, avec son entrée d'audit
+func saveUser(tx *gorm.DB, ctx *gin.Context, before, user *models.User) error {
+	if err := tx.Save(user).Error; err != nil {
+		return err
+	}
+	return audit.Record(tx, auditMeta(ctx), audit.Event{
+		Action: models.AuditActionUpdate, ResourceType: "user", ResourceID: user.ID, Before: *before, After: *user,
+	})
+}
+
+// POST /me/2fa/totp - démarrer l'activation de la double authentification
+// @Summary Enroll TOTP
+// @Description Generate a new TOTP secret for the current user. Scan the otpauth:// URI or the QR code
+// @Description with an authenticator app, then confirm with POST /me/2fa/totp/confirm.
+// @Tags account
+// @Produce json
+// @Success 200 {object} TOTPEnrollment
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/2fa/totp [post]
+func (c *Controller) EnrollTOTP(ctx *gin.Context) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+
+	enrollment, err := mfa.Enroll(config.String("TOTP_ISSUER", "Travel API"), user.Username)
+	if err != nil {
+		fmt.Println("[ERROR] Génération du secret TOTP:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll"})
+		return
+	}
+	before := user
+	user.TOTPSecret = enrollment.Secret
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return saveUser(tx, ctx, &before, &user)
+	}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, TOTPEnrollment{
+		Secret: enrollment.Secret,
+		URL:    enrollment.URL,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	})
+}
+
+// POST /me/2fa/totp/confirm - activer la double authentification
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a first code from the authenticator app.
+// @Description Returns one-time recovery codes; they are only shown once.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body TOTPCodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/2fa/totp/confirm [post]
+func (c *Controller) ConfirmTOTP(ctx *gin.Context) {
+	var req TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No pending enrollment"})
+		return
+	}
+	step, ok := mfa.Validate(user.TOTPSecret, req.Code, user.TOTPLastStep, time.Now())
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	var codes []string
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		now := time.Now()
+		user.TOTPEnabledAt = &now
+		user.TOTPLastStep = step
+		if err := saveUser(tx, ctx, &before, &user); err != nil {
+			return err
+		}
+		codes, err = issueRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// POST /me/2fa/recovery-codes - régénérer les codes de secours
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes of the current user. The password is required, or a sign-in within the last 5 minutes for an account without password.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body PasswordConfirmation false "Current password, omitted for an account without password"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/2fa/recovery-codes [post]
+func (c *Controller) RegenerateRecoveryCodes(ctx *gin.Context) {
+	user, ok := c.confirmedUser(ctx)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication not enabled"})
+		return
+	}
+
+	var codes []string
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = issueRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DELETE /me/2fa/totp - désactiver la double authentification
+// @Summary Disable TOTP
+// @Description Disable two-factor authentication and delete the recovery codes. The password is required, or a sign-in within the last 5 minutes for an account without password.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param request body PasswordConfirmation false "Current password, omitted for an account without password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/2fa/totp [delete]
+func (c *Controller) DisableTOTP(ctx *gin.Context) {
+	user, ok := c.confirmedUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		user.TOTPSecret, user.TOTPEnabledAt, user.TOTPLastStep = "", nil, 0
+		if err := saveUser(tx, ctx, &before, &user); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA godoc
+// @Summary Complete two-factor login
+// @Description Exchange the mfa_token returned by POST /login and a TOTP or recovery code for a JWT token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFALoginRequest true "Challenge token and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /login/mfa [post]
+func (c *Controller) LoginMFA(ctx *gin.Context) {
+	var req MFALoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	userID, err := parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil || user.TOTPEnabledAt == nil || accountBlocked(user) != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	// Les codes erronés comptent dans le verrouillage progressif des connexions
+	if c.LoginLockout != nil {
+		if wait, err := c.LoginLockout.Locked(user.Username); err == nil && wait > 0 {
+			ratelimit.SetRetryAfter(ctx, wait)
+			ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts"})
+			return
+		}
+	}
+	ok, err := verifySecondFactor(ctx, user, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		c.loginFailed(user.Username)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if c.LoginLockout != nil {
+		c.LoginLockout.Succeed(user.Username)
+	}
+	c.respondWithToken(ctx, user, "mfa")
+}
+
+// verifySecondFactor accepte un code TOTP ou, à défaut, un code de secours, et le consomme
+func verifySecondFactor(ctx *gin.Context, user models.User, code string) (bool, error) {
+	if step, ok := mfa.Validate(user.TOTPSecret, code, user.TOTPLastStep, time.Now()); ok {
+		// La condition protège contre deux utilisations concurrentes du même code
+		res := models.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return res.RowsAffected == 1, res.Error
+	}
+
+	var used bool
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var rc models.RecoveryCode
+		err := tx.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(mfa.NormalizeRecoveryCode(code))).
+			Limit(1).Find(&rc).Error
+		if err != nil || rc.ID == 0 {
+			return err
+		}
+		before := rc
+		res := tx.Model(&rc).Where("used_at IS NULL").Update("used_at", time.Now())
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		used = true
+		meta := auditMeta(ctx)
+		meta.ActorID, meta.Actor = user.ID, user.Username
+		return audit.Record(tx, meta, audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "recovery_code", ResourceID: rc.ID,
+			Before: before, After: rc,
+		})
+	})
+	return used, err
+}
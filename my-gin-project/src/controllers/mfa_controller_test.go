@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/mfa"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupMFARouter() *gin.Engine {
+	var mails bytes.Buffer
+	r := setupAccountRouter(&mails)
+	ctrl := &Controller{}
+	r.POST("/login/mfa", ctrl.LoginMFA)
+	auth := r.Group("/", AuthMiddleware())
+	auth.POST("/me/2fa/totp", ctrl.EnrollTOTP)
+	auth.POST("/me/2fa/totp/confirm", ctrl.ConfirmTOTP)
+	auth.DELETE("/me/2fa/totp", ctrl.DisableTOTP)
+	return r
+}
+
+func TestTOTPLogin(t *testing.T) {
+	setupTestDB()
+	router := setupMFARouter()
+	token := loginToken(t, router, "alice", "password")
+
+	resp := sendJSON(router, "POST", "/me/2fa/totp", token, nil)
+	var enrollment TOTPEnrollment
+	json.Unmarshal(resp.Body.Bytes(), &enrollment)
+	if resp.Code != http.StatusOK || !strings.HasPrefix(enrollment.URL, "otpauth://totp/") || !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Fatalf("Unexpected enrollment: %d %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := sendJSON(router, "POST", "/me/2fa/totp/confirm", token, map[string]string{"code": "000000"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a wrong code, got %d", resp.Code)
+	}
+	now := time.Now()
+	code, _ := mfa.Code(enrollment.Secret, now)
+	resp = sendJSON(router, "POST", "/me/2fa/totp/confirm", token, map[string]string{"code": code})
+	var recovery RecoveryCodesResponse
+	json.Unmarshal(resp.Body.Bytes(), &recovery)
+	if resp.Code != http.StatusOK || len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Unexpected confirmation: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// La connexion renvoie un défi au lieu d'un token d'accès
+	login := func() string {
+		resp := sendJSON(router, "POST", "/login", "", map[string]string{"username": "alice", "password": "password"})
+		var out map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &out)
+		if out["mfa_required"] != true || out["token"] != nil {
+			t.Fatalf("Expected an MFA challenge, got %s", resp.Body.String())
+		}
+		return out["mfa_token"].(string)
+	}
+	challenge := login()
+	if resp := sendJSON(router, "POST", "/me/2fa/totp", challenge, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the challenge token to be refused by the API, got %d", resp.Code)
+	}
+
+	// Le code déjà utilisé pour la confirmation est refusé
+	if resp := sendJSON(router, "POST", "/login/mfa", "", map[string]string{"mfa_token": challenge, "code": code}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed code to be refused, got %d", resp.Code)
+	}
+	next, _ := mfa.Code(enrollment.Secret, now.Add(mfa.Period))
+	resp = sendJSON(router, "POST", "/login/mfa", "", map[string]string{"mfa_token": challenge, "code": next})
+	var out map[string]string
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out["token"] == "" {
+		t.Fatalf("Expected an access token, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	// Code de secours : accepté une seule fois, quelle que soit la saisie
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))
+	if resp := sendJSON(router, "POST", "/login/mfa", "", map[string]string{"mfa_token": login(), "code": recoveryCode}); resp.Code != http.StatusOK {
+		t.Errorf("Expected the recovery code to be accepted, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/login/mfa", "", map[string]string{"mfa_token": login(), "code": recoveryCode}); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be refused, got %d", resp.Code)
+	}
+
+	if resp := sendJSON(router, "DELETE", "/me/2fa/totp", out["token"], map[string]string{"password": "password"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.Code)
+	}
+	if token := loginToken(t, router, "alice", "password"); token == "" {
+		t.Errorf("Expected a plain login once two-factor authentication is disabled")
+	}
+}
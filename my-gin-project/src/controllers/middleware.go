@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+
+	sentry "github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+)
+
+// Clés du contexte Gin renseignées par les middlewares
+const (
+	ContextUsername  = "username"
+	ContextUserID    = "user_id"
+	ContextRequestID = "request_id"
+	// Session du token d'accès, absente pour une clé d'API
+	ContextSessionID = "session_id"
+	// Renseignées uniquement pour les requêtes authentifiées par clé d'API
+	ContextAPIKeyID = "api_key_id"
+	ContextScopes   = "scopes"
+)
+
+// RequestID attribue un identifiant à chaque requête (repris de l'en-tête X-Request-ID s'il est fourni)
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		ctx.Set(ContextRequestID, id)
+		ctx.Header("X-Request-ID", id)
+		ctx.Next()
+	}
+}
+
+// OptionalAuth authentifie la requête si elle présente un token ou une clé d'API, et la laisse
+// passer anonymement sinon. Un token ou une clé invalide est refusé comme avec AuthMiddleware.
+func OptionalAuth() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") == "" && ctx.GetHeader(APIKeyHeader) == "" {
+			ctx.Next()
+			return
+		}
+		auth(ctx)
+	}
+}
+
+// RequireRole n'autorise que les utilisateurs authentifiés ayant l'un des rôles donnés.
+// Doit être placé après AuthMiddleware ; le rôle est relu en base à chaque requête.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := currentUser(ctx)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
+
+// RequireScope vérifie que la clé d'API de la requête possède la portée scope.
+// Les requêtes authentifiées par JWT ne sont pas limitées par les portées.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get(ContextAPIKeyID); ok && !slices.Contains(ctx.GetStringSlice(ContextScopes), scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing scope " + scope})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireUserSession refuse les clés d'API : réservé aux utilisateurs connectés (compte, gestion des clés)
+func RequireUserSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get(ContextAPIKeyID); ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not available with an API key"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// currentUser charge l'utilisateur authentifié par AuthMiddleware
+func currentUser(ctx *gin.Context) (models.User, error) {
+	var user models.User
+	err := models.DB.Where("username = ?", ctx.GetString(ContextUsername)).First(&user).Error
+	return user, err
+}
+
+// auditMeta renvoie l'auteur et le contexte de la requête pour le journal d'audit
+func auditMeta(ctx *gin.Context) audit.Meta {
+	meta := audit.Meta{
+		Actor:     ctx.GetString(ContextUsername),
+		RequestID: ctx.GetString(ContextRequestID),
+		IP:        ctx.ClientIP(),
+	}
+	if id, ok := ctx.Get(ContextUserID); ok {
+		meta.ActorID, _ = id.(uint)
+	}
+	return meta
+}
+
+// reportError journalise une erreur serveur et la transmet à Sentry avec la requête en cours
+// (hub du middleware sentrygin installé dans main.go, ou hub global à défaut)
+func reportError(ctx *gin.Context, msg string, err error) {
+	log.Printf("[ERROR] %s: %v", msg, err)
+	hub := sentrygin.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub.CaptureException(fmt.Errorf("%s: %w", msg, err))
+}
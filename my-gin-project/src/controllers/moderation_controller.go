@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FlaggedMessage est une détection de la modération avec le message concerné, tel qu'enregistré
+// (données personnelles masquées, réponse bloquée remplacée par le refus)
+type FlaggedMessage struct {
+	models.ModerationFlag
+	Username string          `json:"username" example:"thomas"`
+	Message  *HistoryMessage `json:"message,omitempty"`
+}
+
+type ModerationFlagList struct {
+	Total    int64            `json:"total" example:"12"`
+	Page     int              `json:"page" example:"1"`
+	PageSize int              `json:"page_size" example:"50"`
+	Flags    []FlaggedMessage `json:"flags"`
+}
+
+var defaultModeration = moderation.Default()
+
+func (c *Controller) moderation() *moderation.Pipeline {
+	if c.Moderation != nil {
+		return c.Moderation
+	}
+	return defaultModeration
+}
+
+// moderationFlags convertit les détections d'un message en signalements à enregistrer avec lui
+func moderationFlags(direction string, findings []moderation.Finding) []models.ModerationFlag {
+	flags := []models.ModerationFlag{}
+	for _, f := range findings {
+		flags = append(flags, models.ModerationFlag{
+			Direction: direction, Check: f.Check, Category: truncate(f.Category, 64), Action: f.Action,
+		})
+	}
+	return flags
+}
+
+// GET /admin/moderation/flags - messages signalés par la modération
+// @Summary List moderation flags
+// @Description Detections of the moderation pipeline on chat questions (input) and replies (output), most recent first, with the message as stored (admin only).
+// @Description Masked passages and blocked replies are not kept: the message shows what was saved. Every access is written to the audit log.
+// @Description Flags of anonymous /chat-ai calls have no user_id nor message (the exchange is not saved) but the client_ip and request_id of the call.
+// @Tags admin
+// @Produce json
+// @Param direction query string false "input or output"
+// @Param check query string false "length, blocked_terms, pii, injection or classifier"
+// @Param action query string false "block, mask or flag"
+// @Param user_id query int false "Only the flags of this user"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Flags per page (max 200)"
+// @Success 200 {object} ModerationFlagList
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/moderation/flags [get]
+func (c *Controller) GetModerationFlags(ctx *gin.Context) {
+	query := models.DB.Model(&models.ModerationFlag{})
+	for param, column := range map[string]string{"direction": "direction", "check": "check_name", "action": "action"} {
+		if v := ctx.Query(param); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	if v := ctx.Query("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+	for param, cond := range map[string]string{"from": "created_at >= ?", "to": "created_at <= ?"} {
+		if v := ctx.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", param)})
+				return
+			}
+			query = query.Where(cond, t)
+		}
+	}
+
+	page, size := pagination(ctx)
+	resp := ModerationFlagList{Page: page, PageSize: size, Flags: []FlaggedMessage{}}
+	var flags []models.ModerationFlag
+	if err := query.Count(&resp.Total).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation flags"})
+		return
+	}
+	if err := query.Order("id desc").Limit(size).Offset((page - 1) * size).Find(&flags).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation flags"})
+		return
+	}
+
+	messageIDs, userIDs := []uint{}, []uint{}
+	for _, f := range flags {
+		if f.MessageID != nil {
+			messageIDs = append(messageIDs, *f.MessageID)
+		}
+		if f.UserID != nil {
+			userIDs = append(userIDs, *f.UserID)
+		}
+	}
+	var rows []models.ConversationHistory
+	var users []models.User
+	if len(flags) > 0 {
+		models.DB.Where("id IN ?", messageIDs).Find(&rows)
+		models.DB.Select("id, username").Where("id IN ?", userIDs).Find(&users)
+	}
+	messages := map[uint]HistoryMessage{}
+	for _, row := range rows {
+		messages[row.ID] = newHistoryMessage(row)
+	}
+	usernames := map[uint]string{}
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+	for _, f := range flags {
+		item := FlaggedMessage{ModerationFlag: f}
+		if f.UserID != nil {
+			item.Username = usernames[*f.UserID]
+		}
+		if f.MessageID != nil {
+			if m, ok := messages[*f.MessageID]; ok {
+				item.Message = &m
+			}
+		}
+		resp.Flags = append(resp.Flags, item)
+	}
+
+	// Les messages des utilisateurs ne sont consultés que de façon tracée
+	err := audit.Record(models.DB, auditMeta(ctx), audit.Event{
+		Action: models.AuditActionRead, ResourceType: "moderation_flags", ResourceID: "",
+		After: gin.H{"query": ctx.Request.URL.RawQuery, "flags": len(resp.Flags)},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record access"})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
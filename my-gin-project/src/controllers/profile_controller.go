@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Me est le compte de l'utilisateur connecté et son profil
+type Me struct {
+	ID              uint               `json:"id" example:"12"`
+	Username        string             `json:"username" example:"thomas"`
+	Email           *string            `json:"email" example:"thomas@example.com"`
+	EmailVerifiedAt *time.Time         `json:"email_verified_at"`
+	Role            string             `json:"role" example:"user"`
+	TwoFactor       bool               `json:"two_factor"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Profile         models.UserProfile `json:"profile"`
+}
+
+// loadProfile renvoie le profil de userID (un profil vide s'il n'a jamais été renseigné)
+func loadProfile(db *gorm.DB, userID uint) (models.UserProfile, error) {
+	profile := models.UserProfile{UserID: userID, DietaryNeeds: []string{}, AccessibilityNeeds: []string{}}
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&profile).Error
+	return profile, err
+}
+
+// GET /me - consulter son compte et son profil
+// @Summary Get current user
+// @Description Account and travel profile of the current user
+// @Tags account
+// @Produce json
+// @Success 200 {object} Me
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me [get]
+func (c *Controller) GetMe(ctx *gin.Context) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	profile, err := loadProfile(models.DB, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Me{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Role:            user.Role,
+		TwoFactor:       user.TOTPEnabledAt != nil,
+		CreatedAt:       user.CreatedAt,
+		Profile:         profile,
+	})
+}
+
+// PUT /me - mettre à jour son profil
+// @Summary Update profile
+// @Description Replace the travel profile of the current user (display name, home city and airport, currency,
+// @Description language, dietary and accessibility needs, travel style, budget per trip).
+// @Description The AI assistant uses these preferences to personalise its answers.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param profile body models.UserProfile true "Profile"
+// @Success 200 {object} models.UserProfile
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me [put]
+func (c *Controller) UpdateMe(ctx *gin.Context) {
+	var input models.UserProfile
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	input.Normalize()
+	if err := input.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := loadProfile(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		input.UserID = user.ID
+		if err := tx.Save(&input).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionUpdate, ResourceType: "user_profile", ResourceID: user.ID, Before: before, After: input,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	ctx.JSON(http.StatusOK, input)
+}
+
+// preferencesPrompt décrit les préférences renseignées du profil pour le prompt système de l'assistant
+// ("" si le profil est vide)
+func preferencesPrompt(p models.UserProfile) string {
+	var lines []string
+	add := func(label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			lines = append(lines, fmt.Sprintf("- %s : %s", label, value))
+		}
+	}
+	add("Nom", p.DisplayName)
+	home := p.HomeCity
+	if p.HomeAirport != "" {
+		home = strings.TrimSpace(home + " (aéroport " + p.HomeAirport + ")")
+	}
+	add("Ville de départ", home)
+	add("Langue de réponse", p.Language)
+	add("Devise pour les prix", p.Currency)
+	add("Style de voyage", p.TravelStyle)
+	add("Régime alimentaire", strings.Join(p.DietaryNeeds, ", "))
+	add("Besoins d'accessibilité", strings.Join(p.AccessibilityNeeds, ", "))
+	switch {
+	case p.BudgetMin != nil && p.BudgetMax != nil:
+		add("Budget par personne et par voyage", fmt.Sprintf("%g à %g %s", *p.BudgetMin, *p.BudgetMax, p.Currency))
+	case p.BudgetMax != nil:
+		add("Budget par personne et par voyage", fmt.Sprintf("au plus %g %s", *p.BudgetMax, p.Currency))
+	case p.BudgetMin != nil:
+		add("Budget par personne et par voyage", fmt.Sprintf("au moins %g %s", *p.BudgetMin, p.Currency))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Préférences de voyage de l'utilisateur, à prendre en compte dans tes recommandations sans les lui redemander :\n" +
+		strings.Join(lines, "\n")
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"my-gin-project/src/models"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupProfileRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	auth := r.Group("/", AuthMiddleware())
+	auth.GET("/me", ctrl.GetMe)
+	auth.PUT("/me", ctrl.UpdateMe)
+	return r
+}
+
+func TestProfile(t *testing.T) {
+	setupTestDB()
+	router := setupProfileRouter()
+	token := loginToken(t, router, "alice", "password")
+
+	resp := sendJSON(router, "GET", "/me", token, nil)
+	var me Me
+	json.Unmarshal(resp.Body.Bytes(), &me)
+	if resp.Code != http.StatusOK || me.Username != "alice" || me.Profile.DisplayName != "" {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if bytes.Contains(resp.Body.Bytes(), []byte("password")) {
+		t.Errorf("Expected no password in the response")
+	}
+
+	for _, body := range []string{
+		`{"currency": "euro"}`,
+		`{"home_airport": "Lyon"}`,
+		`{"travel_style": "cruise"}`,
+		`{"budget_min": 2000, "budget_max": 1000}`,
+	} {
+		var input map[string]interface{}
+		json.Unmarshal([]byte(body), &input)
+		if resp := sendJSON(router, "PUT", "/me", token, input); resp.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.Code)
+		}
+	}
+
+	resp = sendJSON(router, "PUT", "/me", token, map[string]interface{}{
+		"display_name": " Alice ", "home_city": "Lyon", "home_airport": "lys", "currency": "eur", "language": "fr",
+		"dietary_needs": []string{"végétarien", " ", "végétarien"}, "travel_style": "Comfort", "budget_max": 1500,
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	json.Unmarshal(sendJSON(router, "GET", "/me", token, nil).Body.Bytes(), &me)
+	p := me.Profile
+	if p.DisplayName != "Alice" || p.HomeAirport != "LYS" || p.Currency != "EUR" || p.TravelStyle != "comfort" ||
+		len(p.DietaryNeeds) != 1 || p.BudgetMax == nil || *p.BudgetMax != 1500 {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+
+	var entries int64
+	models.DB.Model(&models.AuditLog{}).Where("resource_type = ?", "user_profile").Count(&entries)
+	if entries != 1 {
+		t.Errorf("Expected 1 audit entry, got %d", entries)
+	}
+}
+
+func TestPreferencesPrompt(t *testing.T) {
+	if prompt := preferencesPrompt(models.UserProfile{}); prompt != "" {
+		t.Errorf("Expected no prompt for an empty profile, got %q", prompt)
+	}
+
+	budget := 1500.0
+	prompt := preferencesPrompt(models.UserProfile{
+		HomeCity: "Lyon", HomeAirport: "LYS", Currency: "EUR",
+		DietaryNeeds: []string{"végétarien", "sans gluten"}, BudgetMax: &budget,
+	})
+	for _, want := range []string{
+		"- Ville de départ : Lyon (aéroport LYS)",
+		"- Régime alimentaire : végétarien, sans gluten",
+		"- Budget par personne et par voyage : au plus 1500 EUR",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected %q in prompt:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "Style de voyage") {
+		t.Errorf("Expected empty preferences to be left out:\n%s", prompt)
+	}
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+	"my-gin-project/src/prompts"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PromptTemplateRequest struct {
+	Description string `json:"description" example:"Assistant de voyage généraliste"`
+	Body        string `json:"body" binding:"required" example:"Tu es l'assistant de voyage de Travel API. Nous sommes le {{.Date.Format \"02/01/2006\"}}."`
+}
+
+type PromptPreviewRequest struct {
+	Persona string `json:"persona" example:"travel"`
+	// Version à prévisualiser (version active par défaut)
+	Version *int `json:"version" example:"2"`
+	// Body, si renseigné, est prévisualisé à la place d'une version enregistrée
+	Body string `json:"body"`
+	// Utilisateur dont le profil est utilisé (données d'exemple par défaut)
+	UserID uint `json:"user_id" example:"12"`
+}
+
+type PromptPreview struct {
+	Persona string `json:"persona" example:"travel"`
+	Version int    `json:"version" example:"2"`
+	Prompt  string `json:"prompt"`
+}
+
+var defaultPrompts = prompts.Default()
+
+func (c *Controller) prompts() *prompts.Library {
+	if c.Prompts != nil {
+		return c.Prompts
+	}
+	return defaultPrompts
+}
+
+// defaultPersona est la persona de l'assistant quand la requête n'en choisit pas (AI_DEFAULT_PERSONA)
+func defaultPersona() string {
+	return config.String("AI_DEFAULT_PERSONA", prompts.DefaultPersona)
+}
+
+// promptData prépare les variables des modèles pour l'utilisateur userID
+func promptData(db *gorm.DB, userID uint, username string) (prompts.Data, error) {
+	profile, err := loadProfile(db, userID)
+	if err != nil {
+		return prompts.Data{}, err
+	}
+	return prompts.NewData(username, profile, preferencesPrompt(profile), time.Now()), nil
+}
+
+// GET /admin/prompts - lister les personas
+// @Summary List personas
+// @Description Active prompt template of each persona of the AI assistant (admin only)
+// @Tags admin
+// @Produce json
+// @Success 200 {array} prompts.Template
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/prompts [get]
+func (c *Controller) GetPersonas(ctx *gin.Context) {
+	personas, err := c.prompts().Personas(models.DB)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch personas"})
+		return
+	}
+	ctx.JSON(http.StatusOK, personas)
+}
+
+// GET /admin/prompts/:persona - versions du prompt d'une persona
+// @Summary List prompt versions
+// @Description Every version of a persona's prompt template, the active one first. Version 0 comes from the template files (admin only)
+// @Tags admin
+// @Produce json
+// @Param persona path string true "Persona"
+// @Success 200 {array} prompts.Template
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/prompts/{persona} [get]
+func (c *Controller) GetPromptVersions(ctx *gin.Context) {
+	versions, err := c.prompts().Versions(models.DB, ctx.Param("persona"))
+	if errors.Is(err, prompts.ErrUnknownPersona) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Persona not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt versions"})
+		return
+	}
+	ctx.JSON(http.StatusOK, versions)
+}
+
+// POST /admin/prompts/:persona - nouvelle version du prompt d'une persona
+// @Summary Create a prompt version
+// @Description Save a new version of a persona's prompt template (Go text/template), which becomes the active one.
+// @Description Variables: .Username, .Name, .Profile, .Preferences, .Date, .Language. Creates the persona if needed (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param persona path string true "Persona"
+// @Param request body PromptTemplateRequest true "Template"
+// @Success 201 {object} models.PromptTemplate
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/prompts/{persona} [post]
+func (c *Controller) CreatePromptVersion(ctx *gin.Context) {
+	var req PromptTemplateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	persona := ctx.Param("persona")
+	if !prompts.ValidPersona(persona) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid persona name"})
+		return
+	}
+	if err := prompts.Validate(req.Body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+		return
+	}
+
+	row := models.PromptTemplate{
+		Persona:     persona,
+		Description: truncate(req.Description, 255),
+		Body:        req.Body,
+		CreatedBy:   ctx.GetUint(ContextUserID),
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := c.prompts().Save(tx, &row); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditMeta(ctx), audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "prompt_template", ResourceID: row.ID, After: row,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prompt template"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, row)
+}
+
+// POST /admin/prompts/preview - prévisualiser un prompt
+// @Summary Preview a prompt
+// @Description Render a saved version or an unsaved template body with a user's profile or sample data (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body PromptPreviewRequest true "Template and user"
+// @Success 200 {object} PromptPreview
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/prompts/preview [post]
+func (c *Controller) PreviewPrompt(ctx *gin.Context) {
+	var req PromptPreviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if req.Persona == "" {
+		req.Persona = defaultPersona()
+	}
+
+	tmpl := prompts.Template{Persona: req.Persona, Body: req.Body}
+	if req.Body == "" {
+		var err error
+		if req.Version != nil {
+			tmpl, err = c.prompts().Version(models.DB, req.Persona, *req.Version)
+		} else {
+			tmpl, err = c.prompts().Active(models.DB, req.Persona)
+		}
+		if errors.Is(err, prompts.ErrUnknownPersona) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt template"})
+			return
+		}
+	}
+
+	data := prompts.SampleData()
+	if req.UserID != 0 {
+		var user models.User
+		if err := models.DB.First(&user, req.UserID).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		var err error
+		if data, err = promptData(models.DB, user.ID, user.Username); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+			return
+		}
+	}
+
+	prompt, err := tmpl.Render(data)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, PromptPreview{Persona: tmpl.Persona, Version: tmpl.Version, Prompt: prompt})
+}
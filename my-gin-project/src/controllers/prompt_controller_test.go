@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"my-gin-project/src/models"
+	"my-gin-project/src/prompts"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupPromptRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{}
+	r.POST("/register", ctrl.Register)
+	r.POST("/login", ctrl.Login)
+	admin := r.Group("/admin/prompts", AuthMiddleware(), RequireRole(models.RoleAdmin))
+	admin.GET("", ctrl.GetPersonas)
+	admin.POST("/preview", ctrl.PreviewPrompt)
+	admin.GET("/:persona", ctrl.GetPromptVersions)
+	admin.POST("/:persona", ctrl.CreatePromptVersion)
+	return r
+}
+
+func TestPromptTemplates(t *testing.T) {
+	setupTestDB()
+	router := setupPromptRouter()
+	token := loginToken(t, router, "admin", "password")
+	models.DB.Model(&models.User{}).Where("username = ?", "admin").Update("role", models.RoleAdmin)
+
+	if resp := sendJSON(router, "POST", "/admin/prompts/travel", token, map[string]string{"body": "{{.Unknown}}"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid template, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "POST", "/admin/prompts/Bad%20Name", token, map[string]string{"body": "ok"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid persona name, got %d", resp.Code)
+	}
+	resp := sendJSON(router, "POST", "/admin/prompts/travel", token, map[string]string{"body": "Salut {{.Name}}, langue {{.Language}}"})
+	var row models.PromptTemplate
+	json.Unmarshal(resp.Body.Bytes(), &row)
+	if resp.Code != http.StatusCreated || row.Version != 1 {
+		t.Fatalf("Unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+
+	var versions []prompts.Template
+	json.Unmarshal(sendJSON(router, "GET", "/admin/prompts/travel", token, nil).Body.Bytes(), &versions)
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 0 {
+		t.Errorf("Unexpected versions: %+v", versions)
+	}
+	if resp := sendJSON(router, "GET", "/admin/prompts/pirate", token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown persona, got %d", resp.Code)
+	}
+
+	// Prévisualisation avec le profil d'un utilisateur
+	var admin models.User
+	models.DB.Where("username = ?", "admin").First(&admin)
+	models.DB.Create(&models.UserProfile{UserID: admin.ID, DisplayName: "Alex", Language: "en"})
+	resp = sendJSON(router, "POST", "/admin/prompts/preview", token, map[string]interface{}{"persona": "travel", "user_id": admin.ID})
+	var preview PromptPreview
+	json.Unmarshal(resp.Body.Bytes(), &preview)
+	if preview.Version != 1 || preview.Prompt != "Salut Alex, langue en" {
+		t.Errorf("Unexpected preview: %s", resp.Body.String())
+	}
+	resp = sendJSON(router, "POST", "/admin/prompts/preview", token, map[string]interface{}{"persona": "travel", "version": 0})
+	json.Unmarshal(resp.Body.Bytes(), &preview)
+	if preview.Version != 0 || !strings.Contains(preview.Prompt, "Camille") {
+		t.Errorf("Expected the builtin template with sample data, got %s", resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/admin/prompts/preview", token, map[string]interface{}{"body": "{{.Name"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid body, got %d", resp.Code)
+	}
+
+	var personas []prompts.Template
+	json.Unmarshal(sendJSON(router, "GET", "/admin/prompts", token, nil).Body.Bytes(), &personas)
+	if len(personas) != 3 {
+		t.Errorf("Expected 3 personas, got %d", len(personas))
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-gin-project/src/models"
+	"my-gin-project/src/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchResponse struct {
+	Query   string          `json:"query" example:"hotel annecy"`
+	Results []search.Result `json:"results"`
+}
+
+// GET /search - recherche plein texte
+// @Summary Full-text search
+// @Description Relevance-ranked search over item names and descriptions and destinations.
+// @Description Matching ignores case and accents and tolerates typos; matched words are wrapped in <mark> in the highlights.
+// @Tags search
+// @Produce json
+// @Param q query string true "Search terms"
+// @Param type query string false "Restrict to item or destination (comma separated)"
+// @Param limit query int false "Maximum number of results (default 20, max 100)"
+// @Success 200 {object} SearchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /search [get]
+func (c *Controller) Search(ctx *gin.Context) {
+	q := strings.TrimSpace(ctx.Query("q"))
+	if q == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Missing query"})
+		return
+	}
+
+	var types []string
+	if t := ctx.Query("type"); t != "" {
+		for _, typ := range strings.Split(t, ",") {
+			if typ != search.TypeItem && typ != search.TypeDestination {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type"})
+				return
+			}
+			types = append(types, typ)
+		}
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	limit = min(limit, 100)
+
+	results, err := search.New(models.DB).Search(q, types, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+	ctx.JSON(http.StatusOK, SearchResponse{Query: q, Results: results})
+}
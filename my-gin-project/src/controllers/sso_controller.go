@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-gin-project/src/audit"
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+	"my-gin-project/src/sso"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	ssoStateCookie  = "oidc_state"
+	ssoStatePurpose = "oidc_state"
+	ssoStateTTL     = 10 * time.Minute
+)
+
+var usernameUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+type ProvidersResponse struct {
+	Providers []string `json:"providers" example:"google"`
+}
+
+// ssoFlow est l'état conservé entre la redirection vers le fournisseur et le retour sur le callback
+type ssoFlow struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// setFlowCookie conserve l'état du flux dans un cookie signé, valable quelques minutes
+func setFlowCookie(ctx *gin.Context, flow ssoFlow) error {
+	signed, err := signJWT(jwt.MapClaims{
+		"purpose":  ssoStatePurpose,
+		"provider": flow.Provider,
+		"state":    flow.State,
+		"nonce":    flow.Nonce,
+		"verifier": flow.Verifier,
+		"exp":      time.Now().Add(ssoStateTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	secure := strings.HasPrefix(config.String("APP_URL", ""), "https://")
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, signed, int(ssoStateTTL.Seconds()), "/auth/", "", secure, true)
+	return nil
+}
+
+// readFlowCookie relit et supprime le cookie d'état du flux
+func readFlowCookie(ctx *gin.Context) (ssoFlow, error) {
+	var flow ssoFlow
+	raw, err := ctx.Cookie(ssoStateCookie)
+	if err != nil {
+		return flow, errors.New("missing state cookie")
+	}
+	ctx.SetCookie(ssoStateCookie, "", -1, "/auth/", "", false, true)
+
+	claims, err := parseJWT(raw)
+	if err != nil {
+		return flow, errors.New("invalid state cookie")
+	}
+	if claims["purpose"] != ssoStatePurpose {
+		return flow, errors.New("invalid state cookie")
+	}
+	flow.Provider, _ = claims["provider"].(string)
+	flow.State, _ = claims["state"].(string)
+	flow.Nonce, _ = claims["nonce"].(string)
+	flow.Verifier, _ = claims["verifier"].(string)
+	return flow, nil
+}
+
+// GET /auth/providers - fournisseurs de connexion externes
+// @Summary List login providers
+// @Description List the configured OpenID Connect providers
+// @Tags auth
+// @Produce json
+// @Success 200 {object} ProvidersResponse
+// @Router /auth/providers [get]
+func (c *Controller) GetSSOProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ProvidersResponse{Providers: c.SSOProviders.Names()})
+}
+
+// GET /auth/:provider/login - démarrer la connexion via un fournisseur externe
+// @Summary Start provider login
+// @Description Redirect to the OpenID Connect provider (authorization code flow with PKCE)
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/{provider}/login [get]
+func (c *Controller) SSOLogin(ctx *gin.Context) {
+	provider, err := c.SSOProviders.Get(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+
+	flow := ssoFlow{Provider: provider.Name, State: randomToken(), Nonce: randomToken(), Verifier: oauth2.GenerateVerifier()}
+	url, err := provider.AuthCodeURL(ctx.Request.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		reportError(ctx, "OIDC, URL d'autorisation", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Provider unavailable"})
+		return
+	}
+	if err := setFlowCookie(ctx, flow); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	ctx.Redirect(http.StatusFound, url)
+}
+
+// GET /auth/:provider/callback - retour du fournisseur externe
+// @Summary Provider login callback
+// @Description Verify the provider response and return a JWT token, or an mfa_token when two-factor authentication is enabled.
+// @Description The external identity is linked to the local account with the same verified email, or a new account is created.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /auth/{provider}/callback [get]
+func (c *Controller) SSOCallback(ctx *gin.Context) {
+	provider, err := c.SSOProviders.Get(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+	flow, err := readFlowCookie(ctx)
+	if err != nil || flow.Provider != provider.Name ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(ctx.Query("state"))) != 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+	if e := ctx.Query("error"); e != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Provider error: " + e})
+		return
+	}
+
+	claims, err := provider.Exchange(ctx.Request.Context(), ctx.Query("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		reportError(ctx, "OIDC, échange du code", err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	user, err := linkIdentity(ctx, provider.Name, claims)
+	if err != nil {
+		reportError(ctx, "OIDC, rattachement de l'identité", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+	if reason := accountBlocked(user); reason != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		challenge, err := mfaChallenge(user)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge})
+		return
+	}
+	c.respondWithToken(ctx, user, "oidc:"+provider.Name)
+}
+
+// linkIdentity renvoie l'utilisateur lié à l'identité externe. À la première connexion, l'identité
+// est rattachée au compte ayant la même adresse email, si elle est vérifiée des deux côtés ;
+// sinon un nouveau compte sans mot de passe est créé.
+func linkIdentity(ctx *gin.Context, provider string, claims sso.Claims) (models.User, error) {
+	var user models.User
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).Limit(1).Find(&identity).Error
+		if err != nil {
+			return err
+		}
+		if identity.ID != 0 {
+			return tx.First(&user, identity.UserID).Error
+		}
+
+		meta := auditMeta(ctx)
+		email := normalizeEmail(&claims.Email)
+		if email != nil && claims.EmailVerified {
+			err := tx.Where("email = ? AND email_verified_at IS NOT NULL", *email).Limit(1).Find(&user).Error
+			if err != nil {
+				return err
+			}
+		}
+		if user.ID == 0 {
+			if user, err = createSSOUser(tx, meta, provider, claims, email); err != nil {
+				return err
+			}
+		}
+
+		identity = models.UserIdentity{UserID: user.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		meta.ActorID, meta.Actor = user.ID, user.Username
+		return audit.Record(tx, meta, audit.Event{
+			Action: models.AuditActionCreate, ResourceType: "user_identity", ResourceID: identity.ID, After: identity,
+		})
+	})
+	return user, err
+}
+
+// createSSOUser crée le compte d'une identité externe ; il n'a pas de mot de passe local
+func createSSOUser(tx *gorm.DB, meta audit.Meta, provider string, claims sso.Claims, email *string) (models.User, error) {
+	user := models.User{Role: models.RoleUser}
+	if email != nil {
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("email = ?", *email).Count(&taken).Error; err != nil {
+			return user, err
+		}
+		if taken == 0 {
+			user.Email = email
+			if claims.EmailVerified {
+				now := time.Now()
+				user.EmailVerifiedAt = &now
+			}
+		}
+	}
+
+	base := claims.PreferredUsername
+	if base == "" && email != nil {
+		base, _, _ = strings.Cut(*email, "@")
+	}
+	base = strings.Trim(usernameUnsafe.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if base == "" {
+		base = provider + "-user"
+	}
+	// Premier nom disponible parmi base, base-2, base-3...
+	for i := 1; ; i++ {
+		user.Username = base
+		if i > 1 {
+			user.Username = base + "-" + strconv.Itoa(i)
+		}
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("username = ?", user.Username).Count(&taken).Error; err != nil {
+			return user, err
+		}
+		if taken == 0 {
+			break
+		}
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return user, err
+	}
+	meta.ActorID, meta.Actor = user.ID, user.Username
+	return user, audit.Record(tx, meta, audit.Event{
+		Action: models.AuditActionCreate, ResourceType: "user", ResourceID: user.ID, After: user,
+	})
+}
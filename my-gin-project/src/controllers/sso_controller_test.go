@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"my-gin-project/src/models"
+	"my-gin-project/src/sso"
+	"my-gin-project/src/sso/ssotest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	sentry "github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+)
+
+func setupSSORouter(provider *ssotest.Provider) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := &Controller{SSOProviders: sso.Providers{"fake": &sso.Provider{
+		Name:         "fake",
+		Issuer:       provider.URL,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "http://localhost:8080/auth/fake/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}}}
+	r.GET("/auth/providers", ctrl.GetSSOProviders)
+	r.GET("/auth/:provider/login", ctrl.SSOLogin)
+	r.GET("/auth/:provider/callback", ctrl.SSOCallback)
+	return r
+}
+
+// ssoLogin déroule le flux complet : redirection vers le fournisseur, autorisation, callback
+func ssoLogin(t *testing.T, router *gin.Engine, tamper func(callback *url.URL)) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/auth/fake/login", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("Expected a redirection to the provider, got %d: %s", resp.Code, resp.Body.String())
+	}
+	cookies := resp.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	authz, err := client.Get(resp.Header().Get("Location"))
+	if err != nil || authz.StatusCode != http.StatusFound {
+		t.Fatalf("Authorization failed: %v %v", authz, err)
+	}
+	callback, _ := url.Parse(authz.Header.Get("Location"))
+	if tamper != nil {
+		tamper(callback)
+	}
+
+	req, _ = http.NewRequest("GET", callback.RequestURI(), nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestSSOLogin(t *testing.T) {
+	setupTestDB()
+	provider := ssotest.NewProvider(ssotest.Identity{
+		Subject: "sub-1", Email: "Alice@Example.com", EmailVerified: true, PreferredUsername: "Alice",
+	})
+	defer provider.Close()
+	router := setupSSORouter(provider)
+
+	// Un compte local porte déjà le nom "alice" mais pas l'adresse : nouveau compte alice-2
+	models.DB.Create(&models.User{Username: "alice", Password: "x"})
+
+	resp := ssoLogin(t, router, nil)
+	var out map[string]string
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	if resp.Code != http.StatusOK || out["token"] == "" {
+		t.Fatalf("Expected a JWT token, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var user models.User
+	models.DB.Where("username = ?", "alice-2").First(&user)
+	if user.ID == 0 || user.Email == nil || *user.Email != "alice@example.com" || user.EmailVerifiedAt == nil {
+		t.Fatalf("Unexpected user: %+v", user)
+	}
+
+	// Deuxième connexion : même compte via l'identité liée
+	ssoLogin(t, router, nil)
+	var users, identities int64
+	models.DB.Model(&models.User{}).Count(&users)
+	models.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&identities)
+	if users != 2 || identities != 1 {
+		t.Errorf("Expected the identity to be reused, got %d users and %d identities", users, identities)
+	}
+
+	// Autre identité avec la même adresse vérifiée : rattachée au compte existant
+	provider.SetIdentity(ssotest.Identity{Subject: "sub-2", Email: "alice@example.com", EmailVerified: true})
+	ssoLogin(t, router, nil)
+	models.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&identities)
+	if identities != 2 {
+		t.Errorf("Expected the second identity to be linked by email, got %d", identities)
+	}
+}
+
+func TestSSOCallbackRejectsForgedState(t *testing.T) {
+	setupTestDB()
+	provider := ssotest.NewProvider(ssotest.Identity{Subject: "sub-1"})
+	defer provider.Close()
+	router := setupSSORouter(provider)
+
+	resp := ssoLogin(t, router, func(callback *url.URL) {
+		q := callback.Query()
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+	})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a forged state, got %d", resp.Code)
+	}
+
+	resp = ssoLogin(t, router, func(callback *url.URL) {
+		q := callback.Query()
+		q.Set("code", "unknown")
+		callback.RawQuery = q.Encode()
+	})
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid code, got %d", resp.Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/auth/other/login", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown provider, got %d", rec.Code)
+	}
+}
+
+func TestSSOAccountDeletionRequiresRecentLogin(t *testing.T) {
+	setupTestDB()
+	provider := ssotest.NewProvider(ssotest.Identity{Subject: "sub-1", Email: "carol@example.com", EmailVerified: true, PreferredUsername: "carol"})
+	defer provider.Close()
+	router := setupSSORouter(provider)
+	router.DELETE("/me", AuthMiddleware(), (&Controller{}).DeleteAccount)
+	login := func() string {
+		var out map[string]string
+		json.Unmarshal(ssoLogin(t, router, nil).Body.Bytes(), &out)
+		return out["token"]
+	}
+
+	// Un compte sans mot de passe confirme en se reconnectant auprès du fournisseur
+	token := login()
+	models.DB.Model(&models.Session{}).Where("1 = 1").Update("created_at", time.Now().Add(-time.Hour))
+	if resp := sendJSON(router, "DELETE", "/me", token, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an old session, got %d", resp.Code)
+	}
+	token = login()
+	if resp := sendJSON(router, "DELETE", "/me", token, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 after a fresh login, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var users int64
+	models.DB.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Errorf("Expected the account to be deleted, %d left", users)
+	}
+}
+
+func TestReportErrorCapturesToSentry(t *testing.T) {
+	var events []*sentry.Event
+	client, _ := sentry.NewClient(sentry.ClientOptions{BeforeSend: func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+		events = append(events, e)
+		return nil
+	}})
+	previous := sentry.CurrentHub().Client()
+	sentry.CurrentHub().BindClient(client)
+	defer sentry.CurrentHub().BindClient(previous)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sentrygin.New(sentrygin.Options{}))
+	router.GET("/fail", func(ctx *gin.Context) {
+		reportError(ctx, "OIDC, échange du code", errors.New("invalid_grant"))
+		ctx.Status(http.StatusUnauthorized)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+	// L'erreur est envoyée avec la requête qui l'a provoquée
+	if len(events) != 1 || events[0].Request == nil || events[0].Request.URL != "http://example.com/fail" {
+		t.Fatalf("Expected one event with the request, got %+v", events)
+	}
+	if ex := events[0].Exception; len(ex) == 0 || ex[len(ex)-1].Value != "OIDC, échange du code: invalid_grant" {
+		t.Errorf("Unexpected exception: %+v", ex)
+	}
+}
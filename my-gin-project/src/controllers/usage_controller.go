@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/ratelimit"
+	"my-gin-project/src/usage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Regroupements possibles du rapport de consommation
+var usageGroups = []string{"user", "model"}
+
+// UsagePeriod est la consommation de l'utilisateur sur la période en cours et son quota
+type UsagePeriod struct {
+	Start   time.Time `json:"start"`
+	ResetAt time.Time `json:"reset_at"`
+	// Limit est le quota de tokens de la période (null : pas de limite)
+	Limit *int64 `json:"limit" example:"100000"`
+	Used  int64  `json:"used" example:"18250"`
+	// Remaining est le nombre de tokens encore disponibles (null : pas de limite)
+	Remaining        *int64  `json:"remaining" example:"81750"`
+	Requests         int64   `json:"requests" example:"24"`
+	PromptTokens     int64   `json:"prompt_tokens" example:"15400"`
+	CompletionTokens int64   `json:"completion_tokens" example:"2850"`
+	Cost             float64 `json:"cost" example:"0.48"`
+}
+
+type UsageSummary struct {
+	Daily   UsagePeriod `json:"daily"`
+	Monthly UsagePeriod `json:"monthly"`
+}
+
+// UsageReportRow est la consommation d'un groupe (utilisateur et modèle)
+type UsageReportRow struct {
+	UserID           *uint   `json:"user_id,omitempty" example:"12"`
+	Username         string  `json:"username,omitempty" example:"thomas"`
+	Model            string  `json:"model,omitempty" example:"mistral"`
+	Requests         int64   `json:"requests" example:"320"`
+	PromptTokens     int64   `json:"prompt_tokens" example:"254000"`
+	CompletionTokens int64   `json:"completion_tokens" example:"41000"`
+	TotalTokens      int64   `json:"total_tokens" example:"295000"`
+	Cost             float64 `json:"cost" example:"7.54"`
+}
+
+type UsageReport struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	GroupBy []string         `json:"group_by" example:"user,model"`
+	Rows    []UsageReportRow `json:"rows"`
+	Total   UsageReportRow   `json:"total"`
+}
+
+type QuotaRequest struct {
+	// Quotas de tokens du compte : null pour revenir aux quotas du rôle, 0 pour ne pas limiter
+	DailyTokens   *int64 `json:"daily_tokens" example:"50000"`
+	MonthlyTokens *int64 `json:"monthly_tokens" example:"1000000"`
+}
+
+var defaultUsage = usage.Default()
+
+func (c *Controller) usage() *usage.Policy {
+	if c.Usage != nil {
+		return c.Usage
+	}
+	return defaultUsage
+}
+
+// newUsage renvoie la consommation d'une génération, au prix du modèle (nil si le modèle n'a pas répondu)
+func newUsage(policy *usage.Policy, resp llm.Response, invocations []models.ToolInvocation) *models.AIUsage {
+	if resp.Model == "" && resp.PromptTokens+resp.CompletionTokens == 0 {
+		return nil
+	}
+	calls := 1
+	for _, inv := range invocations {
+		calls = max(calls, inv.Round+1)
+	}
+	return &models.AIUsage{
+		Model:            truncate(resp.Model, 64),
+		Calls:            calls,
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+		Cost:             policy.Cost(resp.Model, resp.PromptTokens, resp.CompletionTokens),
+	}
+}
+
+// addCalls ajoute à u les appels au modèle faits par la modération (classificateur), chacun au prix de
+// son modèle ; u est créée si la génération n'a pas eu lieu
+func addCalls(policy *usage.Policy, u *models.AIUsage, calls []llm.Response) *models.AIUsage {
+	for _, call := range calls {
+		if u == nil {
+			u = &models.AIUsage{Model: truncate(call.Model, 64)}
+		}
+		u.Calls++
+		u.PromptTokens += call.PromptTokens
+		u.CompletionTokens += call.CompletionTokens
+		u.Cost += policy.Cost(call.Model, call.PromptTokens, call.CompletionTokens)
+	}
+	return u
+}
+
+// saveUsage enregistre la consommation d'une génération de userID, rattachée à la réponse messageID
+func saveUsage(tx *gorm.DB, u *models.AIUsage, userID uint, messageID *uint) error {
+	if u == nil {
+		return nil
+	}
+	u.ID, u.UserID, u.MessageID = 0, &userID, messageID
+	return tx.Create(u).Error
+}
+
+// saveClientUsage enregistre la consommation d'une génération anonyme, décomptée de l'adresse ip
+func saveClientUsage(tx *gorm.DB, u *models.AIUsage, ip string) error {
+	if u == nil {
+		return nil
+	}
+	u.ID, u.UserID, u.ClientIP, u.MessageID = 0, nil, truncate(ip, 45), nil
+	return tx.Create(u).Error
+}
+
+// withinQuota vérifie que userID n'a pas atteint ses quotas de tokens avant d'appeler le modèle.
+// En cas de dépassement (429 avec Retry-After jusqu'à la fin de la période) ou d'échec, la réponse est déjà écrite.
+func (ctrl *Controller) withinQuota(c *gin.Context, db *gorm.DB, userID uint) bool {
+	var user models.User
+	err := db.First(&user, userID).Error
+	if err == nil {
+		err = ctrl.usage().Check(db, user, time.Now())
+	}
+	return quotaChecked(c, err, fmt.Sprint("l'utilisateur ", userID))
+}
+
+// withinClientQuota vérifie que les appels anonymes de l'adresse du client n'ont pas atteint leurs quotas,
+// quel que soit le nom qu'ils indiquent. En cas de dépassement ou d'échec, la réponse est déjà écrite.
+func (ctrl *Controller) withinClientQuota(c *gin.Context, db *gorm.DB) bool {
+	return quotaChecked(c, ctrl.usage().CheckClient(db, c.ClientIP(), time.Now()), "un appelant anonyme")
+}
+
+// quotaChecked répond 429 si err est un dépassement de quota de caller, 500 pour tout autre échec
+func quotaChecked(c *gin.Context, err error, caller string) bool {
+	var exceeded *usage.ExceededError
+	if errors.As(err, &exceeded) {
+		fmt.Println("[INFO] Quota de tokens atteint pour", caller, exceeded.Period)
+		ratelimit.SetRetryAfter(c, time.Until(exceeded.ResetAt))
+		message := "Quota journalier de l'assistant IA atteint"
+		if exceeded.Period == usage.Monthly {
+			message = "Quota mensuel de l'assistant IA atteint"
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": message, "period": exceeded.Period, "limit": exceeded.Limit, "used": exceeded.Used, "reset_at": exceeded.ResetAt,
+		})
+		return false
+	}
+	if err != nil {
+		fmt.Println("[ERROR] Vérification du quota:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de vérifier le quota"})
+		return false
+	}
+	return true
+}
+
+// usagePeriod renvoie la consommation de user sur la période en cours
+func usagePeriod(user models.User, period string, limit int64, now time.Time) (UsagePeriod, error) {
+	start, end := usage.Window(period, now)
+	totals, err := usage.Since(models.DB, user.ID, start)
+	if err != nil {
+		return UsagePeriod{}, err
+	}
+	p := UsagePeriod{
+		Start: start, ResetAt: end, Used: totals.Tokens(), Requests: totals.Requests,
+		PromptTokens: totals.PromptTokens, CompletionTokens: totals.CompletionTokens, Cost: totals.Cost,
+	}
+	if limit > 0 {
+		remaining := max(0, limit-p.Used)
+		p.Limit, p.Remaining = &limit, &remaining
+	}
+	return p, nil
+}
+
+// GET /me/usage - consommation de l'assistant IA
+// @Summary Get my AI usage
+// @Description Tokens used by the current user's AI assistant requests today and this month (UTC), with the quotas of the account and the cost.
+// @Description When a quota is reached, /chat-ai, /conversations/regenerate and /conversations/history/{id}/edit answer 429 until reset_at.
+// @Tags account
+// @Produce json
+// @Success 200 {object} UsageSummary
+// @Failure 401 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /me/usage [get]
+func (c *Controller) GetMyUsage(ctx *gin.Context) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	now, limits := time.Now(), c.usage().LimitsFor(user)
+	var summary UsageSummary
+	if summary.Daily, err = usagePeriod(user, usage.Daily, limits.Daily, now); err == nil {
+		summary.Monthly, err = usagePeriod(user, usage.Monthly, limits.Monthly, now)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+	ctx.JSON(http.StatusOK, summary)
+}
+
+// GET /admin/usage - consommation de l'assistant IA par utilisateur et par modèle
+// @Summary Get AI usage report
+// @Description Requests, tokens and cost of the AI assistant between from and to (current month by default), by user and model, highest consumption first (admin only).
+// @Description Anonymous requests are grouped in a row without user_id.
+// @Tags admin
+// @Produce json
+// @Param group_by query string false "Comma-separated groups among user and model (both by default)"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Success 200 {object} UsageReport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/usage [get]
+func (c *Controller) GetUsageReport(ctx *gin.Context) {
+	groupBy := usageGroups
+	if v := ctx.Query("group_by"); v != "" {
+		groupBy = strings.Split(v, ",")
+		for i, g := range groupBy {
+			groupBy[i] = strings.TrimSpace(g)
+			if !slices.Contains(usageGroups, groupBy[i]) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by " + groupBy[i]})
+				return
+			}
+		}
+	}
+	now := time.Now()
+	from, _ := usage.Window(usage.Monthly, now)
+	report := UsageReport{From: from, To: now, GroupBy: groupBy, Rows: []UsageReportRow{}}
+	for param, bound := range map[string]*time.Time{"from": &report.From, "to": &report.To} {
+		if v := ctx.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", param)})
+				return
+			}
+			*bound = t
+		}
+	}
+
+	columns := []string{}
+	if slices.Contains(groupBy, "user") {
+		columns = append(columns, "u.user_id", "users.username")
+	}
+	if slices.Contains(groupBy, "model") {
+		columns = append(columns, "u.model")
+	}
+	query := models.DB.Table("ai_usage AS u").
+		Select(strings.Join(append(slices.Clone(columns), "COUNT(*) AS requests",
+			"COALESCE(SUM(u.prompt_tokens), 0) AS prompt_tokens", "COALESCE(SUM(u.completion_tokens), 0) AS completion_tokens",
+			"COALESCE(SUM(u.cost), 0) AS cost"), ", ")).
+		Joins("LEFT JOIN users ON users.id = u.user_id").
+		Where("u.created_at >= ? AND u.created_at <= ?", report.From, report.To)
+	if len(columns) > 0 {
+		query = query.Group(strings.Join(columns, ", "))
+	}
+	var rows []UsageReportRow
+	if err := query.Order("SUM(u.prompt_tokens + u.completion_tokens) DESC").Scan(&rows).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build usage report"})
+		return
+	}
+	for _, row := range rows {
+		// Sans regroupement, la seule ligne est le total, vide s'il n'y a eu aucune requête
+		if row.Requests == 0 {
+			continue
+		}
+		row.TotalTokens = row.PromptTokens + row.CompletionTokens
+		report.Rows = append(report.Rows, row)
+		report.Total.Requests += row.Requests
+		report.Total.PromptTokens += row.PromptTokens
+		report.Total.CompletionTokens += row.CompletionTokens
+		report.Total.TotalTokens += row.TotalTokens
+		report.Total.Cost += row.Cost
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+// PUT /admin/users/:id/quota - quotas de tokens d'un utilisateur
+// @Summary Set a user's AI quotas
+// @Description Daily and monthly token quotas of the AI assistant for this account, replacing those of its role; null restores the role quota and 0 removes the limit (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body QuotaRequest true "Quotas"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/quota [put]
+func (c *Controller) SetUserQuota(ctx *gin.Context) {
+	var req QuotaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if (req.DailyTokens != nil && *req.DailyTokens < 0) || (req.MonthlyTokens != nil && *req.MonthlyTokens < 0) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Quotas must be positive or 0"})
+		return
+	}
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := user
+		user.DailyTokenQuota, user.MonthlyTokenQuota = req.DailyTokens, req.MonthlyTokens
+		return saveUser(tx, ctx, &before, &user)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quotas"})
+		return
+	}
+	ctx.JSON(http.StatusOK, newAdminUser(user))
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"encoding/json"
+	"math"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+	"my-gin-project/src/usage"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUsageQuotas(t *testing.T) {
+	setupTestDB()
+	gin.SetMode(gin.TestMode)
+	model := &fakeLLM{
+		promptTokens: 400, completionTokens: 100,
+		toolCalls: [][]llm.ToolCall{{toolCall("search_items", `{"query": "lac"}`)}},
+	}
+	ctrl := &Controller{DB: models.DB, LLM: model, Usage: &usage.Policy{
+		Roles:  map[string]usage.Limits{models.RoleUser: {Daily: 1500, Monthly: 1800}},
+		Prices: map[string]usage.Price{"fake": {Prompt: 1, Completion: 2}},
+	}}
+	router := gin.New()
+	router.POST("/register", ctrl.Register)
+	router.POST("/login", ctrl.Login)
+	router.POST("/chat-ai", OptionalAuth(), ctrl.ChatAI)
+	router.GET("/me/usage", AuthMiddleware(), RequireUserSession(), ctrl.GetMyUsage)
+	router.POST("/conversations/regenerate", AuthMiddleware(), RequireUserSession(), ctrl.RegenerateReply)
+	router.DELETE("/conversations/history", AuthMiddleware(), RequireUserSession(), ctrl.DeleteHistory)
+	admin := router.Group("/admin", AuthMiddleware(), RequireRole(models.RoleAdmin), RequireUserSession())
+	admin.GET("/usage", ctrl.GetUsageReport)
+	admin.PUT("/users/:id/quota", ctrl.SetUserQuota)
+	adminToken, aliceToken, aliceID := adminAndUser(t, router)
+
+	// Les tokens des tours d'outils s'ajoutent à ceux de la réponse
+	resp := sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Un week-end au bord d'un lac ?"})
+	var reply AIResponse
+	json.Unmarshal(resp.Body.Bytes(), &reply)
+	var recorded models.AIUsage
+	models.DB.First(&recorded)
+	if recorded.Calls != 2 || recorded.PromptTokens != 800 || recorded.CompletionTokens != 200 || recorded.MessageID == nil || *recorded.MessageID != reply.MessageID {
+		t.Fatalf("Unexpected usage: %+v", recorded)
+	}
+	if resp := sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Et en train ?"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected the second request to pass, got %d", resp.Code)
+	}
+
+	// Quota du jour atteint : plus d'appel au modèle jusqu'à minuit (UTC)
+	calls := len(model.requests)
+	resp = sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Et à vélo ?"})
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/conversations/regenerate", aliceToken, nil); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 when regenerating, got %d", resp.Code)
+	}
+	if len(model.requests) != calls {
+		t.Errorf("Expected the model not to be called over quota")
+	}
+
+	var summary UsageSummary
+	json.Unmarshal(sendJSON(router, "GET", "/me/usage", aliceToken, nil).Body.Bytes(), &summary)
+	if d := summary.Daily; d.Used != 1500 || d.Requests != 2 || *d.Limit != 1500 || *d.Remaining != 0 || math.Abs(d.Cost-1.8) > 1e-9 {
+		t.Errorf("Unexpected daily usage: %+v", d)
+	}
+	if m := summary.Monthly; *m.Remaining != 300 || !m.ResetAt.After(summary.Daily.ResetAt.AddDate(0, 0, -1)) {
+		t.Errorf("Unexpected monthly usage: %+v", m)
+	}
+
+	// Effacer l'historique ne remet pas la consommation à zéro
+	sendJSON(router, "DELETE", "/conversations/history", aliceToken, nil)
+	if resp := sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Et à vélo ?"}); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the quota to survive the history erasure, got %d", resp.Code)
+	}
+
+	// Le quota du compte remplace celui du rôle
+	resp = sendJSON(router, "PUT", "/admin/users/"+aliceID+"/quota", adminToken, map[string]any{"daily_tokens": 0, "monthly_tokens": 2000})
+	var user AdminUser
+	json.Unmarshal(resp.Body.Bytes(), &user)
+	if resp.Code != http.StatusOK || *user.DailyTokenQuota != 0 || *user.MonthlyTokenQuota != 2000 {
+		t.Fatalf("Unexpected quota update: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := sendJSON(router, "POST", "/chat-ai", aliceToken, map[string]string{"text": "Et à vélo ?"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected the new quota to apply, got %d", resp.Code)
+	}
+	if resp := sendJSON(router, "PUT", "/admin/users/"+aliceID+"/quota", adminToken, map[string]any{"daily_tokens": -1}); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative quota, got %d", resp.Code)
+	}
+	// Les administrateurs n'ont pas de quota par défaut
+	sendJSON(router, "POST", "/chat-ai", adminToken, map[string]string{"text": "Annecy en hiver ?"})
+
+	if resp := sendJSON(router, "GET", "/admin/usage", aliceToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", resp.Code)
+	}
+	var report UsageReport
+	resp = sendJSON(router, "GET", "/admin/usage?group_by=user", adminToken, nil)
+	json.Unmarshal(resp.Body.Bytes(), &report)
+	if resp.Code != http.StatusOK || len(report.Rows) != 2 || report.Rows[0].Username != "alice" || report.Rows[0].TotalTokens != 2000 || report.Rows[0].Model != "" {
+		t.Fatalf("Unexpected report: %d %s", resp.Code, resp.Body.String())
+	}
+	if report.Total.Requests != 4 || report.Total.TotalTokens != 2500 {
+		t.Errorf("Unexpected total: %+v", report.Total)
+	}
+	report = UsageReport{}
+	json.Unmarshal(sendJSON(router, "GET", "/admin/usage?group_by=model&from=2000-01-01T00:00:00Z", adminToken, nil).Body.Bytes(), &report)
+	if len(report.Rows) != 1 || report.Rows[0].Model != "fake" || report.Rows[0].UserID != nil {
+		t.Errorf("Unexpected report by model: %+v", report.Rows)
+	}
+	if resp := sendJSON(router, "GET", "/admin/usage?group_by=persona", adminToken, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown group, got %d", resp.Code)
+	}
+}
+
+func TestAnonymousUsageQuota(t *testing.T) {
+	setupTestDB()
+	gin.SetMode(gin.TestMode)
+	model := &fakeLLM{promptTokens: 400, completionTokens: 100}
+	ctrl := &Controller{DB: models.DB, LLM: model, Usage: &usage.Policy{
+		Roles:     map[string]usage.Limits{models.RoleUser: {Daily: 100000}},
+		Anonymous: usage.Limits{Daily: 1000},
+	}}
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Request.RemoteAddr = "203.0.113.7:51000" })
+	router.POST("/register", ctrl.Register)
+	router.POST("/login", ctrl.Login)
+	router.POST("/chat-ai", OptionalAuth(), ctrl.ChatAI)
+
+	// Changer de nom à chaque requête ne donne pas un nouveau quota : il est celui de l'adresse IP
+	for i, name := range []string{"visitor-1", "visitor-2"} {
+		if resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"user": name, "text": "Une idée de week-end ?"}); resp.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d %s", i, resp.Code, resp.Body.String())
+		}
+	}
+	calls := len(model.requests)
+	resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"user": "visitor-3", "text": "Une idée de week-end ?"})
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %s", resp.Code, resp.Body.String())
+	}
+	if len(model.requests) != calls {
+		t.Errorf("Expected the model not to be called over quota")
+	}
+
+	var rows []models.AIUsage
+	models.DB.Find(&rows)
+	if len(rows) != 2 || rows[0].UserID != nil || rows[1].ClientIP != "203.0.113.7" {
+		t.Errorf("Expected the anonymous usage to be charged to the client address, got %+v", rows)
+	}
+	var accounts int64
+	models.DB.Model(&models.User{}).Count(&accounts)
+	if accounts != 0 {
+		t.Errorf("Expected no account to be created, got %d", accounts)
+	}
+
+	// Un utilisateur connecté depuis la même adresse garde son propre quota
+	token := loginToken(t, router, "alice", "s3cret-passphrase")
+	if resp := sendJSON(router, "POST", "/chat-ai", token, map[string]string{"text": "Une idée de week-end ?"}); resp.Code != http.StatusOK {
+		t.Errorf("Expected the account quota to apply, got %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestModerationUsage(t *testing.T) {
+	setupTestDB()
+	gin.SetMode(gin.TestMode)
+	classifier := &fakeLLM{
+		replies:      []string{`{"flagged": false}`, `{"flagged": false}`, `{"flagged": true, "category": "violence"}`},
+		promptTokens: 60, completionTokens: 10,
+	}
+	ctrl := &Controller{
+		DB: models.DB, LLM: &fakeLLM{promptTokens: 400, completionTokens: 100},
+		Moderation: &moderation.Pipeline{
+			Input:  []moderation.Rule{{Check: &moderation.Classifier{LLM: classifier}, Action: moderation.ActionBlock}},
+			Output: []moderation.Rule{{Check: &moderation.Classifier{LLM: classifier}, Action: moderation.ActionFlag}},
+		},
+		Usage: &usage.Policy{Prices: map[string]usage.Price{"fake": {Prompt: 1, Completion: 2}}},
+	}
+	router := gin.New()
+	router.POST("/chat-ai", asUser("alice"), ctrl.ChatAI)
+
+	// La classification de la question et de la réponse est décomptée avec la génération
+	if resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Un week-end à Annecy ?"}); resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", resp.Code, resp.Body.String())
+	}
+	var recorded models.AIUsage
+	models.DB.First(&recorded)
+	if recorded.Calls != 3 || recorded.PromptTokens != 520 || recorded.CompletionTokens != 120 || math.Abs(recorded.Cost-0.76) > 1e-9 {
+		t.Errorf("Unexpected usage: %+v", recorded)
+	}
+
+	// Une question refusée a tout de même consommé les tokens du classificateur
+	if resp := sendJSON(router, "POST", "/chat-ai", "", map[string]string{"text": "Bonjour"}); resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, got %d %s", resp.Code, resp.Body.String())
+	}
+	recorded = models.AIUsage{}
+	models.DB.Last(&recorded)
+	if recorded.Calls != 1 || recorded.PromptTokens != 60 || recorded.CompletionTokens != 10 || recorded.MessageID != nil {
+		t.Errorf("Unexpected usage of the blocked question: %+v", recorded)
+	}
+}
@@ -0,0 +1,199 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// check évalue une assertion déterministe sur la réponse (les assertions judge sont notées par le Runner)
+func check(a Assertion, answer string, latency time.Duration) AssertionResult {
+	result := AssertionResult{Type: a.Type, Label: a.Label(), Passed: true}
+	fail := func(format string, args ...interface{}) AssertionResult {
+		result.Passed, result.Detail = false, fmt.Sprintf(format, args...)
+		return result
+	}
+	switch a.Type {
+	case AssertContains:
+		if !strings.Contains(strings.ToLower(answer), strings.ToLower(a.Value)) {
+			return fail("the answer does not contain %q", a.Value)
+		}
+	case AssertNotContains:
+		if strings.Contains(strings.ToLower(answer), strings.ToLower(a.Value)) {
+			return fail("the answer contains %q", a.Value)
+		}
+	case AssertRegex:
+		if !regexp.MustCompile(a.Value).MatchString(answer) {
+			return fail("the answer does not match %s", a.Value)
+		}
+	case AssertMaxLatency:
+		if latency > a.Max {
+			return fail("answered in %s", latency.Round(time.Millisecond))
+		}
+	case AssertJSONSchema:
+		var value interface{}
+		if err := json.Unmarshal([]byte(jsonPayload(answer)), &value); err != nil {
+			return fail("the answer is not valid JSON: %v", err)
+		}
+		if errs := validateSchema(a.Schema, value, "$"); len(errs) > 0 {
+			return fail("%s", strings.Join(errs, "; "))
+		}
+	}
+	return result
+}
+
+// jsonPayload extrait le JSON d'une réponse, éventuellement placé dans un bloc de code Markdown
+func jsonPayload(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if start := strings.Index(answer, "```"); start >= 0 {
+		body := answer[start+3:]
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+			// Langue du bloc (```json)
+			if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.ContainsAny(body[:nl], "{[") {
+				body = body[nl+1:]
+			}
+			return strings.TrimSpace(body)
+		}
+	}
+	return answer
+}
+
+// validateSchema vérifie une valeur JSON décodée contre un sous-ensemble de JSON Schema :
+// type, enum, required, properties, additionalProperties (false), items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum et maximum. Les autres mots-clés sont ignorés.
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	var errs []string
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, v := range t {
+				types = append(types, fmt.Sprint(v))
+			}
+		}
+		if !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeName(value))}
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		if !slices.ContainsFunc(enum, func(v interface{}) bool { return equal(v, value) }) {
+			errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := value[fmt.Sprint(name)]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: missing property %v", path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				errs = append(errs, validateSchema(sub, value[name], path+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				errs = append(errs, fmt.Sprintf("%s: unexpected property %s", path, name))
+			}
+		}
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(value)) < n {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %v items, got %d", path, n, len(value)))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(value)) > n {
+			errs = append(errs, fmt.Sprintf("%s: expected at most %v items, got %d", path, n, len(value)))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				errs = append(errs, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(value)))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			errs = append(errs, fmt.Sprintf("%s: shorter than %v characters", path, n))
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			errs = append(errs, fmt.Sprintf("%s: longer than %v characters", path, n))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil || !re.MatchString(value) {
+				errs = append(errs, fmt.Sprintf("%s: %q does not match %s", path, value, pattern))
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && value < n {
+			errs = append(errs, fmt.Sprintf("%s: %v is less than %v", path, value, n))
+		}
+		if n, ok := number(schema["maximum"]); ok && value > n {
+			errs = append(errs, fmt.Sprintf("%s: %v is greater than %v", path, value, n))
+		}
+	}
+	return errs
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeName(value) == t
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// number convertit un nombre du schéma (entier ou décimal selon le décodage YAML)
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equal compare une valeur de l'enum (décodée du YAML) à une valeur JSON
+func equal(a, b interface{}) bool {
+	if n, ok := number(a); ok {
+		m, ok := b.(float64)
+		return ok && n == m
+	}
+	return reflect.DeepEqual(a, b)
+}
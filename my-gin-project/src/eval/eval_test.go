@@ -0,0 +1,252 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"my-gin-project/src/controllers"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// scriptedLLM répond selon la dernière question et note 5 les réponses qui citent Annecy, 2 les autres
+type scriptedLLM struct {
+	replies  map[string]string
+	requests []llm.Request
+	// interrupt, s'il est renseigné, est appelé à chaque requête (Ctrl+C pendant l'évaluation)
+	interrupt func()
+}
+
+func (s *scriptedLLM) Chat(ctx context.Context, req llm.Request) (llm.Response, error) {
+	s.requests = append(s.requests, req)
+	if s.interrupt != nil {
+		s.interrupt()
+	}
+	last := req.Messages[len(req.Messages)-1].Content
+	if strings.HasPrefix(req.Messages[0].Content, "Tu évalues") {
+		if strings.Contains(last, "Annecy") {
+			return llm.Response{Message: llm.Message{Content: "```json\n{\"score\": 5, \"reason\": \"Destination précise\"}\n```"}}, nil
+		}
+		return llm.Response{Message: llm.Message{Content: `{"score": 2, "reason": "Trop vague"}`}}, nil
+	}
+	return llm.Response{Model: "scripted", Message: llm.Message{Role: llm.RoleAssistant, Content: s.replies[last]}}, nil
+}
+
+const testSuite = `name: test
+cases:
+  - id: lac
+    input: Une idée de lac ?
+    assert:
+      - {type: contains, value: annecy}
+      - {type: not_contains, value: désolé}
+      - {type: max_latency, max: 10s}
+      - {type: judge, rubric: Propose une destination précise.}
+  - id: suite
+    history:
+      - {role: user, content: Je pars à Annecy.}
+      - {role: assistant, content: Super !}
+    input: Et s'il pleut ?
+    assert:
+      - {type: regex, value: "(?i)musée"}
+  - id: json
+    input: En JSON
+    assert:
+      - type: json_schema
+        schema:
+          type: object
+          required: [days]
+          properties:
+            days: {type: array, minItems: 2, items: {type: integer}}
+`
+
+func setup(t *testing.T) *gorm.DB {
+	gin.SetMode(gin.TestMode)
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	models.DB = db
+	return db
+}
+
+func loadSuite(t *testing.T, body string) Suite {
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	os.WriteFile(path, []byte(body), 0o644)
+	suite, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return suite
+}
+
+func TestLoad(t *testing.T) {
+	suite := loadSuite(t, testSuite)
+	if len(suite.Cases) != 3 || suite.Cases[0].Assert[2].Max != 10*time.Second || suite.Cases[0].Assert[3].MinScore != defaultMinScore {
+		t.Errorf("Unexpected suite: %+v", suite)
+	}
+	// La suite livrée avec le projet reste valide
+	if _, err := Load("../evals/travel.yaml"); err != nil {
+		t.Error(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "invalid.yaml")
+	for _, body := range []string{
+		"cases: []",
+		"cases: [{id: a, input: x}, {id: a, input: y}]",
+		"cases: [{id: a, input: x, assert: [{type: regex, value: '('}]}]",
+		"cases: [{id: a, input: x, assert: [{type: judge}]}]",
+		"cases: [{id: a, input: x, assert: [{type: spelling}]}]",
+		"cases: [{id: a, input: x, history: [{role: system, content: y}]}]",
+	} {
+		os.WriteFile(path, []byte(body), 0o644)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected an error for %s", body)
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"required":             []interface{}{"city", "days"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"city": map[string]interface{}{"type": "string", "pattern": "^[A-Z]", "maxLength": 20},
+			"days": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 14},
+			"mode": map[string]interface{}{"enum": []interface{}{"train", "avion"}},
+		},
+	}
+	tests := []struct {
+		answer string
+		errors int
+	}{
+		{`{"city": "Lisbonne", "days": 3, "mode": "train"}`, 0},
+		{"Voici :\n```json\n{\"city\": \"Lisbonne\", \"days\": 3}\n```", 0},
+		{`{"city": "lisbonne", "days": 3.5, "mode": "bus", "budget": 900}`, 4},
+		{`{"days": 30}`, 2},
+		{`[]`, 1},
+	}
+	for _, tt := range tests {
+		res := check(Assertion{Type: AssertJSONSchema, Schema: schema}, tt.answer, 0)
+		if tt.errors == 0 && !res.Passed {
+			t.Errorf("%s: unexpected failure %s", tt.answer, res.Detail)
+		}
+		if tt.errors > 0 && (res.Passed || strings.Count(res.Detail, ";")+1 != tt.errors) {
+			t.Errorf("%s: expected %d errors, got %q", tt.answer, tt.errors, res.Detail)
+		}
+	}
+	if res := check(Assertion{Type: AssertJSONSchema, Schema: schema}, "Pas de JSON ici", 0); res.Passed {
+		t.Error("Expected a failure for an answer without JSON")
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := setup(t)
+	model := &scriptedLLM{replies: map[string]string{
+		"Une idée de lac ?": "Essaie Annecy",
+		"Et s'il pleut ?":   "Le musée-château d'Annecy",
+		"En JSON":           `{"days": [1]}`,
+	}}
+	runner := &Runner{Controller: &controllers.Controller{DB: db, LLM: model}, Judge: Judge{LLM: model, Model: "judge"}}
+	report, err := runner.Run(context.Background(), loadSuite(t, testSuite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed != 2 || report.Failed != 1 || len(report.Cases) != 3 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	lac := report.Cases[0]
+	if !lac.Passed || lac.Model != "scripted" || lac.Persona != "travel" || lac.PromptVersion == nil || lac.Assertions[3].Score != 5 {
+		t.Errorf("Unexpected case: %+v", lac)
+	}
+	// Le juge est interrogé avec son propre modèle
+	if judged := model.requests[1]; judged.Model != "judge" || !strings.Contains(judged.Messages[1].Content, "Propose une destination précise.") {
+		t.Errorf("Unexpected judge request: %+v", judged)
+	}
+	// L'historique du cas précède la question
+	messages := model.requests[2].Messages
+	if len(messages) != 4 || messages[1].Content != "Je pars à Annecy." || messages[2].Role != llm.RoleAssistant {
+		t.Errorf("Expected the case history in the prompt, got %+v", messages)
+	}
+	if c := report.Cases[2]; c.Passed || !strings.Contains(c.Assertions[0].Detail, "at least 2 items") {
+		t.Errorf("Expected the JSON case to fail, got %+v", c)
+	}
+
+	// Les comptes et conversations d'évaluation sont supprimés
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the eval users to be deleted, %d left", count)
+	}
+	db.Model(&models.ConversationHistory{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the eval conversations to be deleted, %d left", count)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	db := setup(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	model := &scriptedLLM{replies: map[string]string{"Une idée de lac ?": "Essaie Annecy"}, interrupt: cancel}
+	runner := &Runner{Controller: &controllers.Controller{DB: db, LLM: model}, Judge: Judge{LLM: model, Model: "judge"}}
+	if _, err := runner.Run(ctx, loadSuite(t, testSuite)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the run to be interrupted, got %v", err)
+	}
+	// Les comptes des cas déjà lancés sont supprimés malgré l'interruption
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the eval users to be deleted, %d left", count)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{StartedAt: time.Now().Add(-time.Hour), Cases: []CaseResult{
+		{ID: "a", Passed: true, Answer: "x", LatencyMs: 100, Assertions: []AssertionResult{{Label: "contains \"x\"", Passed: true}}},
+		{ID: "b", Passed: false, Answer: "y"},
+		{ID: "c", Passed: true},
+		{ID: "gone", Passed: true},
+	}}
+	report := &Report{Suite: "test", StartedAt: time.Now(), Cases: []CaseResult{
+		{ID: "a", Passed: false, Answer: "z", LatencyMs: 250, Assertions: []AssertionResult{{Label: "contains \"x\"", Passed: false}}},
+		{ID: "b", Passed: true, Answer: "y"},
+		{ID: "c", Passed: true},
+		{ID: "new", Passed: true},
+	}}
+	report.Compare(baseline)
+	statuses := []string{}
+	for _, c := range report.Diff.Cases {
+		statuses = append(statuses, c.Status)
+	}
+	if strings.Join(statuses, ",") != "regressed,fixed,unchanged,new,removed" || report.Diff.Regressed != 1 || report.Diff.Fixed != 1 {
+		t.Fatalf("Unexpected diff: %+v", report.Diff)
+	}
+	a := report.Diff.Cases[0]
+	if a.LatencyDeltaMs != 150 || !a.AnswerChanged || len(a.NewFailures) != 1 {
+		t.Errorf("Unexpected case diff: %+v", a)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.WriteJSON(path); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ReadReport(path); err != nil || read.Diff.Regressed != 1 || len(read.Cases) != 4 {
+		t.Errorf("Unexpected report read back: %+v %v", read, err)
+	}
+	var html strings.Builder
+	if err := report.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), `class="regressed"`) || !strings.Contains(html.String(), "1 régression(s)") {
+		t.Errorf("Unexpected HTML report: %s", html.String())
+	}
+}
@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"my-gin-project/src/llm"
+)
+
+const judgePrompt = `Tu évalues les réponses d'un assistant de voyage.
+Note la réponse de 1 (inacceptable) à 5 (excellente) en suivant uniquement la grille d'évaluation fournie.
+Réponds uniquement avec un objet JSON de la forme {"score": <1-5>, "reason": "<justification en une phrase>"}.`
+
+// Judge note une réponse selon une grille d'évaluation en interrogeant un modèle de langage
+type Judge struct {
+	LLM llm.Client
+	// Model remplace le modèle par défaut du client s'il est renseigné
+	Model string
+}
+
+type verdict struct {
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Grade demande au juge la note de la réponse à la question
+func (j Judge) Grade(ctx context.Context, question, answer, rubric string) (int, string, error) {
+	resp, err := j.LLM.Chat(ctx, llm.Request{
+		Model: j.Model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: judgePrompt},
+			{Role: llm.RoleUser, Content: fmt.Sprintf("Question :\n%s\n\nRéponse de l'assistant :\n%s\n\nGrille d'évaluation :\n%s", question, answer, rubric)},
+		},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	// Le modèle entoure parfois l'objet de texte ou d'un bloc de code
+	content := resp.Message.Content
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	var v verdict
+	if start < 0 || end < start || json.Unmarshal([]byte(content[start:end+1]), &v) != nil {
+		return 0, "", fmt.Errorf("unexpected judge answer: %q", content)
+	}
+	if v.Score < 1 || v.Score > 5 {
+		return 0, "", fmt.Errorf("judge score out of range: %d", v.Score)
+	}
+	return v.Score, v.Reason, nil
+}
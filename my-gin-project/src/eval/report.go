@@ -0,0 +1,201 @@
+package eval
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"time"
+)
+
+// Évolution d'un cas par rapport au rapport de référence
+const (
+	DiffRegressed = "regressed"
+	DiffFixed     = "fixed"
+	DiffUnchanged = "unchanged"
+	DiffNew       = "new"
+	DiffRemoved   = "removed"
+)
+
+// Report est le résultat d'une exécution de suite, enregistré en JSON pour servir de référence
+type Report struct {
+	Suite      string       `json:"suite"`
+	StartedAt  time.Time    `json:"started_at"`
+	DurationMs int64        `json:"duration_ms"`
+	Passed     int          `json:"passed"`
+	Failed     int          `json:"failed"`
+	Cases      []CaseResult `json:"cases"`
+	// Diff compare l'exécution au rapport passé avec -baseline
+	Diff *Diff `json:"diff,omitempty"`
+}
+
+type CaseResult struct {
+	ID            string `json:"id"`
+	Input         string `json:"input"`
+	Persona       string `json:"persona,omitempty"`
+	PromptVersion *int   `json:"prompt_version,omitempty"`
+	Model         string `json:"model,omitempty"`
+	Answer        string `json:"answer"`
+	LatencyMs     int64  `json:"latency_ms"`
+	Passed        bool   `json:"passed"`
+	// Error est l'erreur renvoyée par l'API à la place d'une réponse
+	Error      string            `json:"error,omitempty"`
+	Assertions []AssertionResult `json:"assertions"`
+}
+
+type AssertionResult struct {
+	Type   string `json:"type"`
+	Label  string `json:"label"`
+	Passed bool   `json:"passed"`
+	// Detail explique l'échec, ou reprend la justification du juge
+	Detail string `json:"detail,omitempty"`
+	Score  int    `json:"score,omitempty"`
+}
+
+type Diff struct {
+	// Baseline est la date de l'exécution de référence
+	Baseline  time.Time  `json:"baseline"`
+	Regressed int        `json:"regressed"`
+	Fixed     int        `json:"fixed"`
+	Cases     []CaseDiff `json:"cases"`
+}
+
+type CaseDiff struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Écart de durée avec la référence, en millisecondes (positif : plus lent)
+	LatencyDeltaMs int64 `json:"latency_delta_ms"`
+	AnswerChanged  bool  `json:"answer_changed"`
+	// NewFailures sont les assertions réussies dans la référence qui échouent désormais
+	NewFailures []string `json:"new_failures,omitempty"`
+}
+
+// ReadReport charge un rapport JSON enregistré par une exécution précédente
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Compare renseigne r.Diff avec l'évolution de chaque cas depuis baseline, dans l'ordre de la suite
+func (r *Report) Compare(baseline *Report) {
+	before := map[string]CaseResult{}
+	for _, c := range baseline.Cases {
+		before[c.ID] = c
+	}
+	diff := &Diff{Baseline: baseline.StartedAt, Cases: []CaseDiff{}}
+	seen := map[string]bool{}
+	for _, c := range r.Cases {
+		seen[c.ID] = true
+		old, ok := before[c.ID]
+		d := CaseDiff{ID: c.ID, Status: DiffNew}
+		if ok {
+			d.LatencyDeltaMs = c.LatencyMs - old.LatencyMs
+			d.AnswerChanged = c.Answer != old.Answer
+			d.NewFailures = newFailures(old, c)
+			switch {
+			case old.Passed && !c.Passed:
+				d.Status = DiffRegressed
+				diff.Regressed++
+			case !old.Passed && c.Passed:
+				d.Status = DiffFixed
+				diff.Fixed++
+			default:
+				d.Status = DiffUnchanged
+			}
+		}
+		diff.Cases = append(diff.Cases, d)
+	}
+	for _, c := range baseline.Cases {
+		if !seen[c.ID] {
+			diff.Cases = append(diff.Cases, CaseDiff{ID: c.ID, Status: DiffRemoved})
+		}
+	}
+	r.Diff = diff
+}
+
+func newFailures(old, now CaseResult) []string {
+	passed := map[string]bool{}
+	for _, a := range old.Assertions {
+		passed[a.Label] = a.Passed
+	}
+	var out []string
+	for _, a := range now.Assertions {
+		if !a.Passed && passed[a.Label] {
+			out = append(out, a.Label)
+		}
+	}
+	return out
+}
+
+// WriteJSON enregistre le rapport, réutilisable comme référence d'une prochaine exécution
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// WriteHTML écrit le rapport lisible, avec les réponses et le détail des assertions
+func (r *Report) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"diffOf": func(r *Report, id string) *CaseDiff {
+		if r.Diff == nil {
+			return nil
+		}
+		for i := range r.Diff.Cases {
+			if r.Diff.Cases[i].ID == id {
+				return &r.Diff.Cases[i]
+			}
+		}
+		return nil
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="fr">
+<head>
+<meta charset="utf-8">
+<title>Évaluation {{.Suite}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.pass { color: #1a7f37; } .fail { color: #cf222e; }
+.regressed { background: #ffebe9; } .fixed { background: #dafbe1; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { white-space: pre-wrap; background: #f6f8fa; padding: 8px; margin: 0; }
+</style>
+</head>
+<body>
+<h1>Évaluation {{.Suite}}</h1>
+<p>{{.StartedAt.Format "2006-01-02 15:04:05"}} · {{.DurationMs}} ms ·
+<span class="pass">{{.Passed}} réussi(s)</span> · <span class="fail">{{.Failed}} échoué(s)</span></p>
+{{with .Diff}}
+<h2>Comparaison avec l'exécution du {{.Baseline.Format "2006-01-02 15:04:05"}}</h2>
+<p><span class="fail">{{.Regressed}} régression(s)</span> · <span class="pass">{{.Fixed}} correction(s)</span></p>
+<table>
+<tr><th>Cas</th><th>Évolution</th><th>Écart de durée</th><th>Réponse modifiée</th><th>Nouveaux échecs</th></tr>
+{{range .Cases}}<tr class="{{.Status}}"><td>{{.ID}}</td><td>{{.Status}}</td><td>{{.LatencyDeltaMs}} ms</td><td>{{if .AnswerChanged}}oui{{else}}non{{end}}</td><td>{{range .NewFailures}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Cas</h2>
+{{range .Cases}}{{$diff := diffOf $ .ID}}
+<h3 class="{{if .Passed}}pass{{else}}fail{{end}}">{{if .Passed}}✔{{else}}✘{{end}} {{.ID}}{{with $diff}} ({{.Status}}){{end}}</h3>
+<table>
+<tr><th>Question</th><td><pre>{{.Input}}</pre></td></tr>
+<tr><th>Réponse</th><td>{{if .Error}}<span class="fail">{{.Error}}</span>{{else}}<pre>{{.Answer}}</pre>{{end}}</td></tr>
+<tr><th>Modèle</th><td>{{.Model}} · {{.Persona}}{{with .PromptVersion}} v{{.}}{{end}} · {{.LatencyMs}} ms</td></tr>
+{{range .Assertions}}<tr><th class="{{if .Passed}}pass{{else}}fail{{end}}">{{.Label}}</th><td>{{if .Score}}{{.Score}}/5 {{end}}{{.Detail}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
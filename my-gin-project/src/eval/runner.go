@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"my-gin-project/src/controllers"
+	"my-gin-project/src/models"
+	"my-gin-project/src/password"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Runner rejoue les cas d'une suite dans le handler ChatAI du contrôleur, comme un utilisateur
+// connecté : chaque cas a son propre compte temporaire, supprimé avec ses messages à la fin.
+type Runner struct {
+	Controller *controllers.Controller
+	Judge      Judge
+}
+
+// evalUser est la clé de contexte du compte temporaire du cas en cours
+type evalUser struct{}
+
+// Run exécute les cas dans l'ordre et renvoie le rapport. Un cas dont l'appel échoue est en échec ;
+// seules les erreurs de base de données et l'annulation de ctx interrompent l'exécution. Les comptes
+// temporaires sont supprimés dans tous les cas.
+func (r *Runner) Run(ctx context.Context, suite Suite) (*Report, error) {
+	db := r.Controller.DB
+	report := &Report{Suite: suite.Name, StartedAt: time.Now(), Cases: []CaseResult{}}
+
+	router := gin.New()
+	router.POST("/chat-ai", func(c *gin.Context) {
+		user := c.Request.Context().Value(evalUser{}).(models.User)
+		c.Set(controllers.ContextUsername, user.Username)
+		c.Set(controllers.ContextUserID, user.ID)
+	}, r.Controller.ChatAI)
+
+	run := make([]byte, 4)
+	rand.Read(run)
+	var users []uint
+	defer cleanup(db, &users)
+
+	for i, tc := range suite.Cases {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		user, err := createUser(db, fmt.Sprintf("eval-%s-%d", hex.EncodeToString(run), i+1))
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user.ID)
+		if err := seedHistory(db, user, tc.History); err != nil {
+			return nil, err
+		}
+		persona := tc.Persona
+		if persona == "" {
+			persona = suite.Persona
+		}
+		result, err := r.runCase(context.WithValue(ctx, evalUser{}, user), router, db, tc, persona)
+		if err != nil {
+			return nil, err
+		}
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, result)
+		fmt.Printf("[INFO] Cas %s : %s\n", tc.ID, map[bool]string{true: "réussi", false: "échoué"}[result.Passed])
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, router *gin.Engine, db *gorm.DB, tc Case, persona string) (CaseResult, error) {
+	result := CaseResult{ID: tc.ID, Input: tc.Input, Persona: persona, Assertions: []AssertionResult{}}
+	body, _ := json.Marshal(controllers.AIMessage{Text: tc.Input, Persona: persona})
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/chat-ai", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	start := time.Now()
+	router.ServeHTTP(w, req)
+	latency := time.Since(start)
+	result.LatencyMs = latency.Milliseconds()
+
+	if w.Code != http.StatusOK {
+		var out struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		result.Error = fmt.Sprintf("%d %s", w.Code, out.Error)
+		return result, nil
+	}
+	var out controllers.AIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Answer = out.Bot
+	var reply models.ConversationHistory
+	if err := db.First(&reply, out.MessageID).Error; err != nil {
+		return result, err
+	}
+	result.Persona, result.PromptVersion, result.Model = reply.Persona, reply.PromptVersion, reply.Model
+
+	result.Passed = true
+	for _, a := range tc.Assert {
+		var res AssertionResult
+		if a.Type == AssertJudge {
+			res = r.grade(ctx, a, tc.Input, result.Answer)
+		} else {
+			res = check(a, result.Answer, latency)
+		}
+		result.Passed = result.Passed && res.Passed
+		result.Assertions = append(result.Assertions, res)
+	}
+	return result, nil
+}
+
+// grade fait noter la réponse par le juge ; une erreur du juge fait échouer l'assertion
+func (r *Runner) grade(ctx context.Context, a Assertion, question, answer string) AssertionResult {
+	res := AssertionResult{Type: a.Type, Label: a.Label()}
+	score, reason, err := r.Judge.Grade(ctx, question, answer, a.Rubric)
+	if err != nil {
+		res.Detail = "judge error: " + err.Error()
+		return res
+	}
+	res.Score, res.Detail, res.Passed = score, reason, score >= a.MinScore
+	return res
+}
+
+// createUser crée le compte d'un cas, avec un mot de passe aléatoire jamais communiqué
+func createUser(db *gorm.DB, username string) (models.User, error) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	hash, err := password.DefaultHasher().Hash(hex.EncodeToString(secret))
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{Username: username, Password: hash, Role: models.RoleUser}
+	return user, db.Create(&user).Error
+}
+
+// seedHistory enregistre l'historique du cas comme une branche active d'échanges terminés
+func seedHistory(db *gorm.DB, user models.User, history []Turn) error {
+	var parent *uint
+	turnID := ""
+	for i, t := range history {
+		if t.Role == models.MessageRoleUser || turnID == "" {
+			turnID = fmt.Sprintf("%s-%d", user.Username, i+1)
+		}
+		sender := user.Username
+		if t.Role == models.MessageRoleAssistant {
+			sender = "bot"
+		}
+		row := models.ConversationHistory{
+			UserID: user.ID, TurnID: turnID, Seq: i + 1, Role: t.Role, Sender: sender,
+			Message: t.Content, Status: models.MessageStatusComplete, ParentID: parent, Active: true,
+		}
+		if err := db.Create(&row).Error; err != nil {
+			return err
+		}
+		parent = &row.ID
+	}
+	return nil
+}
+
+// cleanup supprime les comptes temporaires et tout ce que leurs conversations ont enregistré
+func cleanup(db *gorm.DB, users *[]uint) {
+	if len(*users) == 0 {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.ToolInvocation{}, &models.MessageFeedback{}, &models.ModerationFlag{}, &models.AIUsage{}, &models.ConversationHistory{}} {
+			if err := tx.Where("user_id IN ?", *users).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id IN ?", *users).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		fmt.Println("[ERROR] Impossible de supprimer les comptes d'évaluation:", err)
+	}
+}
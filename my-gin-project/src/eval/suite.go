@@ -0,0 +1,164 @@
+// Package eval rejoue une suite de questions de référence dans le pipeline de l'assistant IA
+// (prompt système, historique, outils, recherche documentaire) et vérifie les réponses par des
+// assertions, pour détecter les régressions d'un prompt ou d'un modèle avant le déploiement.
+package eval
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Types d'assertions
+const (
+	AssertContains    = "contains"
+	AssertNotContains = "not_contains"
+	AssertRegex       = "regex"
+	AssertJSONSchema  = "json_schema"
+	AssertMaxLatency  = "max_latency"
+	AssertJudge       = "judge"
+)
+
+// Note minimale par défaut d'une assertion judge, sur une échelle de 1 à 5
+const defaultMinScore = 4
+
+// Suite est un fichier YAML de cas d'évaluation
+type Suite struct {
+	Name string `yaml:"name"`
+	// Persona utilisée par défaut par les cas (AI_DEFAULT_PERSONA si vide)
+	Persona string `yaml:"persona"`
+	// JudgeModel est le modèle qui note les assertions judge (EVAL_JUDGE_MODEL, sinon le modèle par défaut)
+	JudgeModel string `yaml:"judge_model"`
+	Cases      []Case `yaml:"cases"`
+}
+
+type Case struct {
+	ID      string `yaml:"id"`
+	Persona string `yaml:"persona"`
+	// History sont les messages déjà échangés avant la question, sur la branche active
+	History []Turn      `yaml:"history"`
+	Input   string      `yaml:"input"`
+	Assert  []Assertion `yaml:"assert"`
+}
+
+// Turn est un message de l'historique d'un cas
+type Turn struct {
+	Role    string `yaml:"role"` // user ou assistant
+	Content string `yaml:"content"`
+}
+
+// Assertion porte sur la réponse à la question d'un cas. Seuls les champs de son type sont lus.
+type Assertion struct {
+	Type string `yaml:"type"`
+	// Value est le texte cherché (contains, not_contains, insensible à la casse) ou l'expression régulière (regex)
+	Value string `yaml:"value"`
+	// Schema est le schéma JSON que doit respecter la réponse (json_schema)
+	Schema map[string]interface{} `yaml:"schema"`
+	// Max est la durée maximale de la réponse (max_latency), par exemple 5s
+	Max time.Duration `yaml:"max"`
+	// Rubric est la grille d'évaluation donnée au juge, MinScore la note minimale attendue (judge)
+	Rubric   string `yaml:"rubric"`
+	MinScore int    `yaml:"min_score"`
+}
+
+// Load lit et valide une suite d'évaluation
+func Load(path string) (Suite, error) {
+	var suite Suite
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return suite, err
+	}
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return suite, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := suite.Validate(); err != nil {
+		return suite, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite, nil
+}
+
+// Validate vérifie les cas et complète les valeurs par défaut des assertions
+func (s *Suite) Validate() error {
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("the suite has no cases")
+	}
+	ids := map[string]bool{}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.ID == "" {
+			return fmt.Errorf("case %d has no id", i+1)
+		}
+		if ids[c.ID] {
+			return fmt.Errorf("duplicate case id %q", c.ID)
+		}
+		ids[c.ID] = true
+		if c.Input == "" {
+			return fmt.Errorf("case %s has no input", c.ID)
+		}
+		for _, turn := range c.History {
+			if turn.Role != "user" && turn.Role != "assistant" {
+				return fmt.Errorf("case %s: history role must be user or assistant, got %q", c.ID, turn.Role)
+			}
+		}
+		for j := range c.Assert {
+			if err := c.Assert[j].validate(); err != nil {
+				return fmt.Errorf("case %s, assertion %d: %w", c.ID, j+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Assertion) validate() error {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		if a.Value == "" {
+			return fmt.Errorf("%s requires a value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case AssertJSONSchema:
+		if a.Schema == nil {
+			return fmt.Errorf("json_schema requires a schema")
+		}
+	case AssertMaxLatency:
+		if a.Max <= 0 {
+			return fmt.Errorf("max_latency requires a positive max")
+		}
+	case AssertJudge:
+		if a.Rubric == "" {
+			return fmt.Errorf("judge requires a rubric")
+		}
+		if a.MinScore == 0 {
+			a.MinScore = defaultMinScore
+		}
+		if a.MinScore < 1 || a.MinScore > 5 {
+			return fmt.Errorf("min_score must be between 1 and 5")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+	return nil
+}
+
+// Label décrit brièvement l'assertion dans les rapports
+func (a Assertion) Label() string {
+	switch a.Type {
+	case AssertContains, AssertNotContains, AssertRegex:
+		return fmt.Sprintf("%s %q", a.Type, a.Value)
+	case AssertMaxLatency:
+		return fmt.Sprintf("%s %s", a.Type, a.Max)
+	case AssertJudge:
+		rubric := []rune(a.Rubric)
+		if len(rubric) > 40 {
+			rubric = append(rubric[:40], '…')
+		}
+		return fmt.Sprintf("%s >= %d %q", a.Type, a.MinScore, string(rubric))
+	}
+	return a.Type
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/controllers"
+	"my-gin-project/src/eval"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+	"my-gin-project/src/prompts"
+	"my-gin-project/src/usage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runEval exécute la sous-commande eval et renvoie le code de sortie :
+// 0 si tout réussit, 1 en cas d'échec (ou de régression avec -fail-on regressions), 2 si la configuration est invalide.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	suitePath := fs.String("suite", "", "suite YAML à exécuter (obligatoire)")
+	jsonPath := fs.String("json", "", "fichier du rapport JSON, réutilisable avec -baseline")
+	htmlPath := fs.String("html", "", "fichier du rapport HTML")
+	baselinePath := fs.String("baseline", "", "rapport JSON d'une exécution précédente à comparer")
+	failOn := fs.String("fail-on", "failures", "échec de la commande sur les cas en échec (failures) ou seulement les régressions (regressions)")
+	dbDSN := fs.String("db", config.String("EVAL_DATABASE_DSN", ""), "chaîne de connexion MySQL de la base d'évaluation, distincte de celle de l'application (EVAL_DATABASE_DSN par défaut)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *suitePath == "" || (*failOn != "failures" && *failOn != "regressions") {
+		fs.Usage()
+		return 2
+	}
+	if *failOn == "regressions" && *baselinePath == "" {
+		fmt.Fprintln(os.Stderr, "-fail-on regressions requires -baseline")
+		return 2
+	}
+
+	suite, err := eval.Load(*suitePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid suite:", err)
+		return 2
+	}
+	var baseline *eval.Report
+	if *baselinePath != "" {
+		if baseline, err = eval.ReadReport(*baselinePath); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid baseline:", err)
+			return 2
+		}
+	}
+
+	// L'évaluation crée et supprime des comptes : elle ne tourne jamais sur la base de l'application
+	if *dbDSN == "" {
+		fmt.Fprintln(os.Stderr, "eval requires a scratch database: set -db or EVAL_DATABASE_DSN")
+		return 2
+	}
+	if *dbDSN == models.DSNFromEnv() {
+		fmt.Fprintln(os.Stderr, "Refusing to run the evaluation against the application database (DB_*)")
+		return 2
+	}
+	db, err := models.OpenDB(*dbDSN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 2
+	}
+	promptLibrary, err := prompts.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid prompt templates:", err)
+		return 2
+	}
+	model := llm.FromEnv()
+	moderationPipeline, err := moderation.FromEnv(model)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid moderation configuration:", err)
+		return 2
+	}
+	usagePolicy, err := usage.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid usage configuration:", err)
+		return 2
+	}
+	judgeModel := suite.JudgeModel
+	if judgeModel == "" {
+		judgeModel = config.String("EVAL_JUDGE_MODEL", "")
+	}
+
+	// Ctrl+C interrompt l'évaluation, qui supprime ses comptes temporaires avant de quitter ;
+	// un second Ctrl+C quitte immédiatement
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	gin.SetMode(gin.ReleaseMode)
+	runner := &eval.Runner{
+		Controller: &controllers.Controller{DB: db, LLM: model, Prompts: promptLibrary, Moderation: moderationPipeline, Usage: usagePolicy},
+		Judge:      eval.Judge{LLM: model, Model: judgeModel},
+	}
+	report, err := runner.Run(ctx, suite)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Evaluation failed:", err)
+		return 2
+	}
+	if baseline != nil {
+		report.Compare(baseline)
+	}
+
+	if *jsonPath != "" {
+		if err := report.WriteJSON(*jsonPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot write JSON report:", err)
+			return 2
+		}
+	}
+	if *htmlPath != "" {
+		f, err := os.Create(*htmlPath)
+		if err == nil {
+			err = report.WriteHTML(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot write HTML report:", err)
+			return 2
+		}
+	}
+
+	fmt.Printf("%s: %d passed, %d failed\n", suite.Name, report.Passed, report.Failed)
+	if report.Diff != nil {
+		fmt.Printf("Compared with %s: %d regressed, %d fixed\n", report.Diff.Baseline.Format("2006-01-02 15:04:05"), report.Diff.Regressed, report.Diff.Fixed)
+	}
+	if (*failOn == "regressions" && report.Diff.Regressed > 0) || (*failOn == "failures" && report.Failed > 0) {
+		return 1
+	}
+	return 0
+}
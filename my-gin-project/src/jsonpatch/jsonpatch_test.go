@@ -0,0 +1,63 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	json.Unmarshal(got, &g)
+	json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := `{"a": "b", "c": {"d": "e", "f": "g"}}`
+	out, err := ApplyMergePatch([]byte(doc), []byte(`{"a": "z", "c": {"f": null}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, out, `{"a": "z", "c": {"d": "e"}}`)
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"add", `{"a": 1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a": 1, "b": 2}`, nil},
+		{"add array", `{"a": [1, 3]}`, `[{"op":"add","path":"/a/1","value":2},{"op":"add","path":"/a/-","value":4}]`, `{"a": [1, 2, 3, 4]}`, nil},
+		{"remove", `{"a": 1, "b": 2}`, `[{"op":"remove","path":"/b"}]`, `{"a": 1}`, nil},
+		{"replace", `{"a": 1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a": "x"}`, nil},
+		{"move", `{"a": {"b": 1}}`, `[{"op":"move","from":"/a/b","path":"/c"}]`, `{"a": {}, "c": 1}`, nil},
+		{"copy", `{"a": [1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a": [1], "b": [1]}`, nil},
+		{"escaped pointer", `{"a/b": 1, "m~n": 2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`, `{}`, nil},
+		{"test ok", `{"a": [1]}`, `[{"op":"test","path":"/a","value":[1]}]`, `{"a": [1]}`, nil},
+		{"test failed", `{"a": 1}`, `[{"op":"test","path":"/a","value":2}]`, "", ErrTestFailed},
+		{"replace missing", `{"a": 1}`, `[{"op":"replace","path":"/b","value":2}]`, "", ErrInvalidPath},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a"}]`, "", ErrInvalidPatch},
+		{"not an array", `{}`, `{"op":"add"}`, "", ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ApplyPatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
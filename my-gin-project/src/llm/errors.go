@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Catégories d'erreurs du fournisseur, à tester avec errors.Is
+var (
+	// ErrUnavailable : serveur injoignable, surchargé (5xx, 429) ou circuit ouvert ; l'appel peut être retenté
+	ErrUnavailable = errors.New("llm: backend unavailable")
+	// ErrTimeout : pas de premier token ou pas de réponse complète dans les délais
+	ErrTimeout = errors.New("llm: timeout")
+	// ErrBadResponse : requête refusée (modèle inconnu...) ou réponse inexploitable ; inutile de retenter
+	ErrBadResponse = errors.New("llm: bad response")
+)
+
+var (
+	ErrCircuitOpen   = fmt.Errorf("%w: circuit open", ErrUnavailable)
+	ErrEmptyResponse = fmt.Errorf("%w: empty response", ErrBadResponse)
+)
+
+// Error rattache l'erreur d'un appel à sa catégorie Kind
+type Error struct {
+	Kind error
+	Err  error
+	// RetryAfter, pour un fournisseur indisponible dont le disjoncteur est ouvert, est le délai
+	// avant que le disjoncteur laisse passer un nouvel appel (0 si inconnu)
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// retryable indique si l'appel peut être retenté : les délais dépassés ne le sont pas,
+// pour ne pas multiplier le temps d'attente de l'utilisateur
+func retryable(err error) bool {
+	return errors.Is(err, ErrUnavailable) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// backendFailure indique une panne du fournisseur, comptée par le disjoncteur
+func backendFailure(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout)
+}
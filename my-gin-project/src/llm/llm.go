@@ -0,0 +1,84 @@
+// Package llm appelle le modèle de langage de l'assistant avec une liste de messages structurée
+// (system, user, assistant) plutôt qu'un prompt aplati, et calcule les embeddings des documents.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Rôles des messages envoyés au modèle
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool porte le résultat d'un appel d'outil demandé par le modèle
+	RoleTool = "tool"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls sont les outils que le modèle demande d'exécuter (rôle assistant)
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolName est l'outil dont le message contient le résultat (rôle tool)
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+type ToolCall struct {
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name string `json:"name"`
+	// Arguments est un objet JSON (certains fournisseurs l'envoient sous forme de chaîne JSON)
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Tool décrit un outil proposé au modèle, au format des function calls
+type Tool struct {
+	Type     string       `json:"type"` // toujours "function"
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parameters est le schéma JSON des arguments
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+type Request struct {
+	// Model remplace le modèle par défaut du client s'il est renseigné
+	Model    string
+	Messages []Message
+	// Tools sont les outils que le modèle peut demander d'exécuter
+	Tools       []Tool
+	Temperature float64
+	// MaxTokens limite la longueur de la réponse (0 : pas de limite)
+	MaxTokens int
+}
+
+type Response struct {
+	Model   string
+	Message Message
+	// Nombre de tokens du prompt et de la réponse, tels que comptés par le fournisseur
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Client est un fournisseur de modèle de langage
+type Client interface {
+	Chat(ctx context.Context, req Request) (Response, error)
+}
+
+// Embeddings sont les vecteurs calculés pour une liste de textes, dans le même ordre
+type Embeddings struct {
+	Model   string
+	Vectors [][]float32
+}
+
+// Embedder calcule les embeddings de textes (recherche de documents par similarité)
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) (Embeddings, error)
+}
@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"my-gin-project/src/config"
+)
+
+// Ollama appelle les endpoints /api/chat et /api/embed d'un serveur Ollama
+type Ollama struct {
+	BaseURL string
+	Model   string
+	// EmbedModel est le modèle utilisé par Embed
+	EmbedModel string
+	HTTP       *http.Client
+
+	// FirstTokenTimeout borne l'attente du premier morceau de réponse (chargement du modèle compris),
+	// Timeout la durée totale d'un appel ; 0 : pas de limite
+	FirstTokenTimeout time.Duration
+	Timeout           time.Duration
+}
+
+// NewOllama crée un client dont la connexion au serveur est limitée à 5 secondes
+func NewOllama(baseURL, model string) *Ollama {
+	return &Ollama{
+		BaseURL:           strings.TrimRight(baseURL, "/"),
+		Model:             model,
+		EmbedModel:        "nomic-embed-text",
+		HTTP:              newHTTPClient(5 * time.Second),
+		FirstTokenTimeout: time.Minute,
+		Timeout:           2 * time.Minute,
+	}
+}
+
+func newHTTPClient(connectTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	return &http.Client{Transport: transport}
+}
+
+// OllamaFromEnv lit OLLAMA_URL, OLLAMA_MODEL et OLLAMA_EMBED_MODEL ; par défaut le conteneur "ia"
+// de docker-compose, mistral et nomic-embed-text. Les délais sont lus dans OLLAMA_CONNECT_TIMEOUT,
+// OLLAMA_FIRST_TOKEN_TIMEOUT et OLLAMA_TIMEOUT.
+func OllamaFromEnv() *Ollama {
+	o := NewOllama(config.String("OLLAMA_URL", "http://ia:11434"), config.String("OLLAMA_MODEL", "mistral"))
+	o.EmbedModel = config.String("OLLAMA_EMBED_MODEL", o.EmbedModel)
+	o.HTTP = newHTTPClient(config.Duration("OLLAMA_CONNECT_TIMEOUT", 5*time.Second))
+	o.FirstTokenTimeout = config.Duration("OLLAMA_FIRST_TOKEN_TIMEOUT", o.FirstTokenTimeout)
+	o.Timeout = config.Duration("OLLAMA_TIMEOUT", o.Timeout)
+	return o
+}
+
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []Message              `json:"messages"`
+	Tools    []Tool                 `json:"tools,omitempty"`
+	Stream   bool                   `json:"stream"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaChunk est une ligne de la réponse en streaming
+type ollamaChunk struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+var errFirstToken = errors.New("no response before the first token timeout")
+
+// post envoie body à path et renvoie la réponse si le statut est 200, sinon une erreur classée
+func (o *Ollama) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.HTTP.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		kind := ErrBadResponse
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			kind = ErrUnavailable
+		}
+		return nil, newError(kind, "ollama: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// classify rattache l'erreur d'un appel interrompu à sa catégorie. L'annulation de la requête
+// de l'appelant (client parti) est renvoyée telle quelle.
+func classify(parent, ctx context.Context, err error) error {
+	var llmErr *Error
+	switch {
+	case err == nil || errors.As(err, &llmErr):
+		return err
+	case parent.Err() != nil:
+		return parent.Err()
+	case errors.Is(context.Cause(ctx), errFirstToken):
+		return newError(ErrTimeout, "ollama: %v", errFirstToken)
+	case ctx.Err() != nil:
+		return newError(ErrTimeout, "ollama: %v", ctx.Err())
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return newError(ErrTimeout, "ollama: %v", err)
+	}
+	// Connexion refusée ou coupée, résolution DNS...
+	return newError(ErrUnavailable, "ollama: %v", err)
+}
+
+// withTimeouts borne l'appel par Timeout ; stop arrête le délai du premier token
+func (o *Ollama) withTimeouts(parent context.Context) (ctx context.Context, stop func(), cancel func()) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	cancelTotal := func() {}
+	if o.Timeout > 0 {
+		ctx, cancelTotal = context.WithTimeout(ctx, o.Timeout)
+	}
+	stop = func() {}
+	if o.FirstTokenTimeout > 0 {
+		timer := time.AfterFunc(o.FirstTokenTimeout, func() { cancelCause(errFirstToken) })
+		stop = func() { timer.Stop() }
+	}
+	return ctx, stop, func() {
+		stop()
+		cancelTotal()
+		cancelCause(nil)
+	}
+}
+
+// Chat implémente Client avec l'endpoint /api/chat, en streaming pour détecter l'absence de premier token
+func (o *Ollama) Chat(parent context.Context, req Request) (Response, error) {
+	ctx, firstToken, cancel := o.withTimeouts(parent)
+	defer cancel()
+	resp, err := o.chat(ctx, firstToken, req)
+	return resp, classify(parent, ctx, err)
+}
+
+func (o *Ollama) chat(ctx context.Context, firstToken func(), req Request) (Response, error) {
+	model := req.Model
+	if model == "" {
+		model = o.Model
+	}
+	options := map[string]interface{}{"temperature": req.Temperature}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	resp, err := o.post(ctx, "/api/chat", ollamaRequest{Model: model, Messages: req.Messages, Tools: req.Tools, Stream: true, Options: options})
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	out := Response{Model: model, Message: Message{Role: RoleAssistant}}
+	var content strings.Builder
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		firstToken()
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return Response{}, newError(ErrBadResponse, "ollama: invalid response: %v", err)
+		}
+		if chunk.Error != "" {
+			return Response{}, newError(ErrBadResponse, "ollama: %s", chunk.Error)
+		}
+		content.WriteString(chunk.Message.Content)
+		out.Message.ToolCalls = append(out.Message.ToolCalls, chunk.Message.ToolCalls...)
+		if chunk.Done {
+			done = true
+			out.PromptTokens, out.CompletionTokens = chunk.PromptEvalCount, chunk.EvalCount
+			if chunk.Model != "" {
+				out.Model = chunk.Model
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, err
+	}
+	if !done {
+		return Response{}, newError(ErrUnavailable, "ollama: response interrupted")
+	}
+	out.Message.Content = content.String()
+	if strings.TrimSpace(out.Message.Content) == "" && len(out.Message.ToolCalls) == 0 {
+		return Response{}, &Error{Kind: ErrEmptyResponse, Err: errors.New("ollama: no content")}
+	}
+	return out, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+	Error      string      `json:"error"`
+}
+
+// Embed implémente Embedder avec l'endpoint /api/embed
+func (o *Ollama) Embed(parent context.Context, inputs []string) (Embeddings, error) {
+	ctx, firstToken, cancel := o.withTimeouts(parent)
+	defer cancel()
+	out, err := o.embed(ctx, firstToken, inputs)
+	return out, classify(parent, ctx, err)
+}
+
+func (o *Ollama) embed(ctx context.Context, firstToken func(), inputs []string) (Embeddings, error) {
+	resp, err := o.post(ctx, "/api/embed", ollamaEmbedRequest{Model: o.EmbedModel, Input: inputs})
+	if err != nil {
+		return Embeddings{}, err
+	}
+	defer resp.Body.Close()
+	// La réponse n'est pas diffusée en continu : le serveur a répondu, seul le délai total s'applique
+	firstToken()
+
+	var out ollamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Embeddings{}, newError(ErrBadResponse, "ollama: invalid response: %v", err)
+	}
+	if out.Error != "" {
+		return Embeddings{}, newError(ErrBadResponse, "ollama: %s", out.Error)
+	}
+	if len(out.Embeddings) != len(inputs) {
+		return Embeddings{}, newError(ErrBadResponse, "ollama: %d embeddings for %d inputs", len(out.Embeddings), len(inputs))
+	}
+	// Le modèle est conservé sous le nom demandé pour comparer les vecteurs d'un même modèle
+	return Embeddings{Model: o.EmbedModel, Vectors: out.Embeddings}, nil
+}
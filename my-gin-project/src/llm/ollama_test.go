@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOllamaChat(t *testing.T) {
+	var got ollamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		// Réponse en streaming : le client doit concaténer les morceaux
+		w.Write([]byte(`{"model":"mistral","message":{"role":"assistant","content":"Bon"},"done":false}` + "\n"))
+		w.Write([]byte(`{"model":"mistral","message":{"role":"assistant","content":"jour"},"done":true,"prompt_eval_count":12,"eval_count":3}` + "\n"))
+	}))
+	defer server.Close()
+
+	resp, err := NewOllama(server.URL+"/", "mistral").Chat(context.Background(), Request{
+		Messages:  []Message{{Role: RoleSystem, Content: "Tu es un assistant"}, {Role: RoleUser, Content: "Salut"}},
+		MaxTokens: 300,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "Bonjour" || resp.Message.Role != RoleAssistant || resp.PromptTokens != 12 || resp.CompletionTokens != 3 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if got.Model != "mistral" || len(got.Messages) != 2 || got.Messages[0].Role != RoleSystem || got.Options["num_predict"] != float64(300) {
+		t.Errorf("Unexpected request: %+v", got)
+	}
+}
+
+func TestOllamaError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"model 'mistral' not found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, err := NewOllama(server.URL, "mistral").Chat(context.Background(), Request{}); !errors.Is(err, ErrBadResponse) {
+		t.Errorf("Expected ErrBadResponse for an unknown model, got %v", err)
+	}
+}
+
+func TestOllamaEmbed(t *testing.T) {
+	var got ollamaEmbedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[0.1,0.2],[0.3,0.4]]}`))
+	}))
+	defer server.Close()
+
+	out, err := NewOllama(server.URL, "mistral").Embed(context.Background(), []string{"Annecy", "Lyon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "nomic-embed-text" || len(got.Input) != 2 {
+		t.Errorf("Unexpected request: %+v", got)
+	}
+	if out.Model != "nomic-embed-text" || len(out.Vectors) != 2 || out.Vectors[1][0] != 0.3 {
+		t.Errorf("Unexpected embeddings: %+v", out)
+	}
+
+	if _, err := NewOllama(server.URL, "mistral").Embed(context.Background(), []string{"Annecy"}); err == nil {
+		t.Error("Expected an error when the number of embeddings does not match")
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Test") {
+		case "overloaded":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case "empty":
+			w.Write([]byte(`{"model":"mistral","message":{"role":"assistant","content":""},"done":true}` + "\n"))
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"model":"mistral","message":{"role":"assistant","content":"Bonjour"},"done":true}` + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		want error
+	}{
+		{"overloaded", ErrUnavailable},
+		{"empty", ErrEmptyResponse},
+		{"slow", ErrTimeout},
+	}
+	for _, tt := range tests {
+		o := NewOllama(server.URL, "mistral")
+		o.FirstTokenTimeout = 50 * time.Millisecond
+		o.HTTP.Transport = headerTransport{"X-Test", tt.name, o.HTTP.Transport}
+		if _, err := o.Chat(context.Background(), Request{}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Serveur injoignable
+	if _, err := NewOllama("http://127.0.0.1:1", "mistral").Chat(context.Background(), Request{}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+	// Requête de l'appelant annulée : l'erreur n'est pas celle du fournisseur
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewOllama(server.URL, "mistral").Chat(ctx, Request{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// headerTransport ajoute un en-tête à chaque requête
+type headerTransport struct {
+	key, value string
+	next       http.RoundTripper
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set(h.key, h.value)
+	return h.next.RoundTrip(req)
+}
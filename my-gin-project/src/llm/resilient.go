@@ -0,0 +1,195 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"my-gin-project/src/config"
+)
+
+// Breaker est un disjoncteur : après Threshold pannes consécutives, les appels échouent
+// immédiatement pendant Cooldown, puis un seul appel d'essai est autorisé pour vérifier
+// que le fournisseur est revenu.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow indique si un appel peut être tenté
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.Cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// RetryIn renvoie le délai avant que le disjoncteur ouvert autorise un appel d'essai, 0 s'il est fermé.
+// Si un appel d'essai est déjà en cours, son résultat sera connu sous peu : le délai est d'une seconde.
+func (b *Breaker) RetryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return 0
+	}
+	if d := b.openedAt.Add(b.Cooldown).Sub(b.now()); d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+// Record enregistre le résultat d'un appel autorisé
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch {
+	case err == nil:
+		b.failures = 0
+	case backendFailure(err):
+		b.failures++
+		if b.failures >= b.Threshold {
+			b.openedAt = b.now()
+		}
+	case errors.Is(err, context.Canceled):
+		// L'appelant est parti : l'appel ne dit rien de l'état du fournisseur
+	default:
+		// Le fournisseur a répondu, même par une erreur
+		b.failures = 0
+	}
+}
+
+// Resilient protège un client : nouvelles tentatives avec backoff exponentiel sur les erreurs
+// transitoires, disjoncteur, puis repli éventuel sur un second modèle.
+type Resilient struct {
+	Primary Client
+	// Fallback, s'il est renseigné, répond quand Primary échoue (sauf annulation de la requête)
+	Fallback Client
+	// Retries est le nombre de nouvelles tentatives après un premier échec transitoire
+	Retries int
+	Backoff time.Duration
+
+	breaker         *Breaker
+	fallbackBreaker *Breaker
+	sleep           func(ctx context.Context, d time.Duration) error
+}
+
+func NewResilient(primary, fallback Client, retries int, backoff time.Duration, breaker func() *Breaker) *Resilient {
+	return &Resilient{
+		Primary: primary, Fallback: fallback, Retries: retries, Backoff: backoff,
+		breaker: breaker(), fallbackBreaker: breaker(), sleep: sleep,
+	}
+}
+
+// FromEnv crée le client Ollama protégé par LLM_RETRIES, LLM_RETRY_BACKOFF, LLM_BREAKER_THRESHOLD
+// et LLM_BREAKER_COOLDOWN, avec repli sur OLLAMA_FALLBACK_MODEL s'il est défini
+func FromEnv() *Resilient {
+	var fallback Client
+	if model := config.String("OLLAMA_FALLBACK_MODEL", ""); model != "" {
+		o := OllamaFromEnv()
+		o.Model = model
+		fallback = o
+	}
+	threshold := config.Int("LLM_BREAKER_THRESHOLD", 5)
+	cooldown := config.Duration("LLM_BREAKER_COOLDOWN", 30*time.Second)
+	return NewResilient(OllamaFromEnv(), fallback,
+		config.Int("LLM_RETRIES", 2), config.Duration("LLM_RETRY_BACKOFF", 500*time.Millisecond),
+		func() *Breaker { return NewBreaker(threshold, cooldown) })
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// call exécute fn avec nouvelles tentatives, sous la protection de breaker. Une erreur
+// d'indisponibilité indique dans RetryAfter quand le disjoncteur laissera passer un nouvel appel.
+func (r *Resilient) call(ctx context.Context, breaker *Breaker, fn func() error) (err error) {
+	defer func() {
+		var e *Error
+		if errors.As(err, &e) && errors.Is(err, ErrUnavailable) {
+			e.RetryAfter = breaker.RetryIn()
+		}
+	}()
+	for attempt := 0; ; attempt++ {
+		if !breaker.Allow() {
+			if err != nil {
+				return err
+			}
+			return &Error{Kind: ErrCircuitOpen, Err: errors.New("too many recent failures")}
+		}
+		err = fn()
+		breaker.Record(err)
+		if err == nil || !retryable(err) || attempt >= r.Retries || ctx.Err() != nil {
+			return err
+		}
+		// Backoff exponentiel avec gigue : Backoff, 2×Backoff... ± 25 %
+		d := r.Backoff << attempt
+		d += time.Duration((rand.Float64() - 0.5) * 0.5 * float64(d))
+		fmt.Println("[INFO] Nouvel essai du modèle IA après erreur:", err)
+		if err := r.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// Chat implémente Client
+func (r *Resilient) Chat(ctx context.Context, req Request) (Response, error) {
+	var resp Response
+	err := r.call(ctx, r.breaker, func() (err error) {
+		resp, err = r.Primary.Chat(ctx, req)
+		return err
+	})
+	if err == nil || r.Fallback == nil || ctx.Err() != nil {
+		return resp, err
+	}
+
+	fmt.Println("[ERROR] Modèle IA principal en échec, repli sur le modèle de secours:", err)
+	// Le modèle de secours est celui du client Fallback
+	req.Model = ""
+	err = r.call(ctx, r.fallbackBreaker, func() (err error) {
+		resp, err = r.Fallback.Chat(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Embed implémente Embedder si le client principal calcule des embeddings. Il n'y a pas de repli :
+// les vecteurs de deux modèles différents ne sont pas comparables.
+func (r *Resilient) Embed(ctx context.Context, inputs []string) (Embeddings, error) {
+	embedder, ok := r.Primary.(Embedder)
+	if !ok {
+		return Embeddings{}, &Error{Kind: ErrBadResponse, Err: errors.New("embeddings not supported")}
+	}
+	var out Embeddings
+	err := r.call(ctx, r.breaker, func() (err error) {
+		out, err = embedder.Embed(ctx, inputs)
+		return err
+	})
+	return out, err
+}
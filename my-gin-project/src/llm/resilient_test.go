@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// scripted renvoie les erreurs de errs dans l'ordre, puis une réponse
+type scripted struct {
+	name  string
+	errs  []error
+	calls int
+}
+
+func (s *scripted) Chat(ctx context.Context, req Request) (Response, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return Response{}, err
+		}
+	}
+	return Response{Model: s.name, Message: Message{Role: RoleAssistant, Content: "OK"}}, nil
+}
+
+var (
+	unavailable = &Error{Kind: ErrUnavailable, Err: errors.New("503")}
+	notFound    = &Error{Kind: ErrBadResponse, Err: errors.New("model not found")}
+	timeout     = &Error{Kind: ErrTimeout, Err: errors.New("no first token")}
+)
+
+func newTestResilient(primary, fallback Client, retries, threshold int) (*Resilient, *time.Time) {
+	now := time.Now()
+	r := NewResilient(primary, fallback, retries, time.Millisecond, func() *Breaker {
+		b := NewBreaker(threshold, time.Minute)
+		b.now = func() time.Time { return now }
+		return b
+	})
+	r.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return r, &now
+}
+
+func TestResilientRetries(t *testing.T) {
+	primary := &scripted{errs: []error{unavailable, unavailable}}
+	r, _ := newTestResilient(primary, nil, 2, 0)
+	if _, err := r.Chat(context.Background(), Request{}); err != nil || primary.calls != 3 {
+		t.Errorf("Expected success after 2 retries, got %v after %d calls", err, primary.calls)
+	}
+
+	// Ni les requêtes refusées ni les délais dépassés ne sont retentés
+	for _, want := range []*Error{notFound, timeout} {
+		primary = &scripted{errs: []error{want}}
+		r, _ = newTestResilient(primary, nil, 2, 0)
+		if _, err := r.Chat(context.Background(), Request{}); !errors.Is(err, want.Kind) || primary.calls != 1 {
+			t.Errorf("Expected %v without retry, got %v after %d calls", want, err, primary.calls)
+		}
+	}
+}
+
+func TestResilientBreaker(t *testing.T) {
+	primary := &scripted{errs: []error{unavailable, timeout, unavailable}}
+	r, now := newTestResilient(primary, nil, 0, 3)
+	for range 3 {
+		r.Chat(context.Background(), Request{})
+	}
+	// Le disjoncteur est ouvert : l'appel échoue sans joindre le fournisseur
+	_, err := r.Chat(context.Background(), Request{})
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) || primary.calls != 3 {
+		t.Fatalf("Expected the circuit to be open, got %v after %d calls", err, primary.calls)
+	}
+	// L'appelant sait quand réessayer
+	*now = now.Add(20 * time.Second)
+	_, err = r.Chat(context.Background(), Request{})
+	var llmErr *Error
+	if !errors.As(err, &llmErr) || llmErr.RetryAfter != 40*time.Second {
+		t.Errorf("Expected to retry when the cooldown ends, got %v", err)
+	}
+
+	// Après le délai, un appel d'essai réussi referme le disjoncteur
+	*now = now.Add(2 * time.Minute)
+	if _, err := r.Chat(context.Background(), Request{}); err != nil || primary.calls != 4 {
+		t.Fatalf("Expected a successful probe, got %v", err)
+	}
+	if _, err := r.Chat(context.Background(), Request{}); err != nil {
+		t.Errorf("Expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestResilientFallback(t *testing.T) {
+	primary := &scripted{name: "mistral", errs: []error{notFound}}
+	fallback := &scripted{name: "llama3"}
+	r, _ := newTestResilient(primary, fallback, 2, 0)
+	resp, err := r.Chat(context.Background(), Request{Model: "mistral"})
+	if err != nil || resp.Model != "llama3" || fallback.calls != 1 {
+		t.Errorf("Expected the fallback model to answer, got %+v %v", resp, err)
+	}
+
+	// Pas de repli quand l'appelant est parti
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary.errs = []error{context.Canceled}
+	if _, err := r.Chat(ctx, Request{}); !errors.Is(err, context.Canceled) || fallback.calls != 1 {
+		t.Errorf("Expected no fallback after cancellation, got %v", err)
+	}
+}
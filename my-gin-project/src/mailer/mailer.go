@@ -0,0 +1,95 @@
+// Package mailer envoie les emails transactionnels (vérification d'adresse, mot de passe oublié).
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"my-gin-project/src/config"
+)
+
+// Message est un email en texte brut
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envoie des emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer envoie les emails via un serveur SMTP
+type SMTPMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+// Send implémente Mailer
+func (m *SMTPMailer) Send(msg Message) error {
+	var data strings.Builder
+	fmt.Fprintf(&data, "From: %s\r\n", m.From)
+	fmt.Fprintf(&data, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&data, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&data, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	data.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, []byte(data.String()))
+}
+
+// LogMailer écrit les emails dans un fichier ou sur la sortie standard au lieu de les envoyer.
+// Destiné au développement local et aux tests.
+type LogMailer struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// NewLogMailer crée un LogMailer écrivant dans w
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{W: w}
+}
+
+// Send implémente Mailer
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.W, "To: %s\nSubject: %s\n\n%s\n---\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// NewFromEnv crée le mailer choisi par MAILER : "log" (par défaut, sortie standard ou MAILER_LOG_FILE)
+// ou "smtp" (SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM)
+func NewFromEnv() (Mailer, error) {
+	switch kind := config.String("MAILER", "log"); kind {
+	case "log":
+		path := config.String("MAILER_LOG_FILE", "")
+		if path == "" {
+			return NewLogMailer(os.Stdout), nil
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogMailer(f), nil
+	case "smtp":
+		host := config.String("SMTP_HOST", "localhost")
+		m := &SMTPMailer{
+			Addr: fmt.Sprintf("%s:%d", host, config.Int("SMTP_PORT", 587)),
+			From: config.String("SMTP_FROM", "no-reply@localhost"),
+		}
+		if user := config.String("SMTP_USERNAME", ""); user != "" {
+			m.Auth = smtp.PlainAuth("", user, config.String("SMTP_PASSWORD", ""), host)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
@@ -3,11 +3,20 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"my-gin-project/src/controllers"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/mailer"
 	"my-gin-project/src/models"
+	"my-gin-project/src/moderation"
+	"my-gin-project/src/password"
+	"my-gin-project/src/prompts"
+	"my-gin-project/src/ratelimit"
 	"my-gin-project/src/routes"
+	"my-gin-project/src/sso"
+	"my-gin-project/src/usage"
 
 	sentry "github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
@@ -24,7 +33,19 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey APIKey
+// @in header
+// @name X-API-Key
 func main() {
+	// Évaluation hors ligne de l'assistant IA : go run . eval -suite evals/travel.yaml
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEval(os.Args[2:]))
+	}
+	// Nomination du premier administrateur : go run . bootstrap-admin -user alice
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		os.Exit(runBootstrapAdmin(os.Args[2:]))
+	}
+
 	// Initialisation de Sentry
 	err := sentry.Init(sentry.ClientOptions{
 		Dsn:              "https://2f1167ff3d20366cfa3695b14e6cb581@o4510114747121664.ingest.de.sentry.io/4510114754592848",
@@ -36,17 +57,88 @@ func main() {
 
 	defer sentry.Flush(2 * time.Second) // s'assure que les événements sont envoyés avant la fin du programme
 
+	// Clé de signature des tokens : pas de valeur par défaut, qui permettrait de forger des tokens
+	if err := controllers.SetJWTSecret(os.Getenv("JWT_SECRET")); err != nil {
+		log.Fatal("Invalid JWT configuration:", err)
+	}
+
 	db, err := models.InitDB()
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// Limitation de débit et verrouillage des connexions
+	rateLimitStore, err := ratelimit.NewStoreFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to create rate limit store:", err)
+	}
+
+	// Envoi des emails transactionnels
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to create mailer:", err)
+	}
+
+	// Hachage et politique des mots de passe
+	passwordHasher, err := password.HasherFromEnv()
+	if err != nil {
+		log.Fatal("Invalid password hashing configuration:", err)
+	}
+	passwordPolicy, err := password.PolicyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid password policy:", err)
+	}
+
+	// Fournisseurs de connexion OpenID Connect
+	ssoProviders, err := sso.ProvidersFromEnv()
+	if err != nil {
+		log.Fatal("Invalid OIDC configuration:", err)
+	}
+
+	// Limites des opérations groupées sur les items
+	bulkLimits, err := controllers.BulkLimitsFromEnv()
+	if err != nil {
+		log.Fatal("Invalid bulk configuration:", err)
+	}
+
+	// Prompts système de l'assistant IA
+	promptLibrary, err := prompts.FromEnv()
+	if err != nil {
+		log.Fatal("Invalid prompt templates:", err)
+	}
+
+	// Modèle de langage de l'assistant, modération de ses messages et quotas de tokens
+	model := llm.FromEnv()
+	moderationPipeline, err := moderation.FromEnv(model)
+	if err != nil {
+		log.Fatal("Invalid moderation configuration:", err)
+	}
+	usagePolicy, err := usage.FromEnv()
+	if err != nil {
+		log.Fatal("Invalid usage configuration:", err)
+	}
+
 	// Créer le controller avec la DB
 	chatController := &controllers.Controller{
-		DB: db,
+		DB:             db,
+		RateLimitStore: rateLimitStore,
+		LoginLockout:   ratelimit.LockoutFromEnv(rateLimitStore),
+		Mailer:         mail,
+		PasswordHasher: passwordHasher,
+		PasswordPolicy: passwordPolicy,
+		SSOProviders:   ssoProviders,
+		LLM:            model,
+		Prompts:        promptLibrary,
+		Moderation:     moderationPipeline,
+		Usage:          usagePolicy,
+		Bulk:           bulkLimits,
 	}
 
 	r := gin.Default()
+	// Seuls les proxys listés peuvent indiquer l'adresse du client (limitation de débit, audit)
+	if err := r.SetTrustedProxies(ratelimit.TrustedProxiesFromEnv()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// Ajout du middleware Sentry
 	r.Use(sentrygin.New(sentrygin.Options{}))
@@ -0,0 +1,114 @@
+// Package mfa implémente la double authentification TOTP (RFC 6238) et les codes de secours.
+package mfa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Period est la durée de validité d'un code TOTP
+const Period = 30 * time.Second
+
+// Skew est le nombre de périodes tolérées avant et après l'heure courante (décalage d'horloge)
+const Skew = 1
+
+var validateOpts = totp.ValidateOpts{
+	Period:    uint(Period / time.Second),
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// Enrollment est un secret TOTP nouvellement généré
+type Enrollment struct {
+	Secret string
+	URL    string // URI otpauth:// à importer dans l'application d'authentification
+	QRCode []byte // URL encodée en QR code PNG
+}
+
+// Enroll génère un secret TOTP pour le compte account
+func Enroll(issuer, account string) (Enrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      validateOpts.Period,
+		Digits:      validateOpts.Digits,
+		Algorithm:   validateOpts.Algorithm,
+	})
+	if err != nil {
+		return Enrollment{}, err
+	}
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Enrollment{}, err
+	}
+	return Enrollment{Secret: key.Secret(), URL: key.URL(), QRCode: buf.Bytes()}, nil
+}
+
+// Step renvoie le numéro de période TOTP de t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Validate vérifie code pour secret à l'instant now et renvoie la période correspondante.
+// Les périodes inférieures ou égales à lastStep sont refusées : un code ne sert qu'une fois.
+func Validate(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != validateOpts.Digits.Length() {
+		return 0, false
+	}
+	current := Step(now)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*int64(Period/time.Second), 0), validateOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Code renvoie le code TOTP de secret à l'instant t (utile aux tests)
+func Code(secret string, t time.Time) (string, error) {
+	return totp.GenerateCodeCustom(secret, t, validateOpts)
+}
+
+// RecoveryCodes génère n codes de secours de 80 bits, au format xxxx-xxxx-xxxx-xxxx
+func RecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode ignore la casse, les espaces et les tirets saisis par l'utilisateur
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
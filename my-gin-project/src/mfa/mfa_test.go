@@ -0,0 +1,49 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	enrollment, err := Enroll("Travel API", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := Code(enrollment.Secret, now)
+
+	step, ok := Validate(enrollment.Secret, code, 0, now)
+	if !ok || step != Step(now) {
+		t.Fatalf("Expected code to be valid at step %d, got %d %v", Step(now), step, ok)
+	}
+	if _, ok := Validate(enrollment.Secret, code, 0, now.Add(Period)); !ok {
+		t.Errorf("Expected clock skew of one period to be tolerated")
+	}
+	if _, ok := Validate(enrollment.Secret, code, 0, now.Add(3*Period)); ok {
+		t.Errorf("Expected an old code to be refused")
+	}
+	if _, ok := Validate(enrollment.Secret, code, step, now); ok {
+		t.Errorf("Expected a replayed code to be refused")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := RecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("Unexpected codes: %v %v", codes, err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 19 || seen[c] {
+			t.Errorf("Unexpected code %q", c)
+		}
+		seen[c] = true
+		if NormalizeRecoveryCode(" "+c[:9]+c[10:]+" ") != c {
+			t.Errorf("Normalization changed %q", c)
+		}
+	}
+	if got := NormalizeRecoveryCode("ABCD EFGH-IJKL MNOP"); got != "abcd-efgh-ijkl-mnop" {
+		t.Errorf("Unexpected normalized code %q", got)
+	}
+}
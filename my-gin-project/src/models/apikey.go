@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Portées (scopes) attribuables aux clés d'API
+const (
+	ScopeItemsRead         = "items:read"
+	ScopeItemsWrite        = "items:write"
+	ScopeDestinationsRead  = "destinations:read"
+	ScopeDestinationsWrite = "destinations:write"
+	ScopeSearch            = "search"
+	ScopeAuditRead         = "audit:read"
+)
+
+// APIKeyScopes liste les portées valides
+var APIKeyScopes = []string{
+	ScopeItemsRead, ScopeItemsWrite,
+	ScopeDestinationsRead, ScopeDestinationsWrite,
+	ScopeSearch, ScopeAuditRead,
+}
+
+// APIKey est une clé d'accès pour les intégrations machine à machine.
+// La clé agit au nom de l'utilisateur UserID, limitée à ses portées.
+// Seul le hash SHA-256 de la clé est conservé ; Prefix permet de l'identifier.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"size:255"`
+	Prefix     string     `json:"prefix" gorm:"size:16;uniqueIndex"`
+	KeyHash    string     `json:"-" gorm:"size:64"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Scopes     string     `json:"scopes" gorm:"size:512"` // séparées par des espaces
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedBy  uint       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// HasScope indique si la clé possède la portée scope
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(k.Scopes), scope)
+}
+
+// Active indique si la clé est utilisable à l'instant now
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
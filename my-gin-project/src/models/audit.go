@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions enregistrées dans le journal d'audit
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	// AuditActionRead trace la consultation de données personnelles par un administrateur
+	AuditActionRead = "read"
+)
+
+// AuditLog trace une modification de données : qui, quoi, quand et le diff avant/après
+type AuditLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+	ActorID      uint      `json:"actor_id"`
+	Actor        string    `json:"actor" gorm:"size:255;index" example:"thomas"`
+	Action       string    `json:"action" gorm:"size:32" example:"update"`
+	ResourceType string    `json:"resource_type" gorm:"size:64;index:idx_audit_resource" example:"item"`
+	ResourceID   string    `json:"resource_id" gorm:"size:64;index:idx_audit_resource" example:"42"`
+	// Changes contient, par champ modifié, les valeurs {"before": ..., "after": ...}
+	Changes   json.RawMessage `json:"changes" gorm:"type:text" swaggertype:"object"`
+	RequestID string          `json:"request_id" gorm:"size:64"`
+	IP        string          `json:"ip" gorm:"size:64"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
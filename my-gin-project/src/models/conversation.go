@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rôles des messages de conversation
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Statuts des messages : un échange dont la génération a échoué ne conserve que la question
+const (
+	MessageStatusComplete = "complete"
+	MessageStatusFailed   = "failed"
+	// MessageStatusBlocked est une question refusée par la modération, jamais envoyée au modèle
+	MessageStatusBlocked = "blocked"
+)
+
+// ConversationHistory est un message échangé avec l'assistant IA
+type ConversationHistory struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	// Role est le rôle normalisé du message (user ou assistant) ; Sender n'est que le libellé affiché
+	Role      string `gorm:"size:16"`
+	Sender    string `gorm:"size:255"` // nom de l'utilisateur ou "bot"
+	Message   string `gorm:"type:text"`
+	CreatedAt time.Time
+
+	// TurnID relie la question et la réponse d'un même échange, enregistrées ensemble
+	TurnID string `gorm:"size:32;index"`
+	// Seq ordonne les messages de l'utilisateur ; unique par utilisateur (idx_conversation_history_user_seq)
+	Seq    int
+	Status string `gorm:"size:16"`
+	// Error est la cause de l'échec de la génération (statut failed) ou du refus (statut blocked)
+	Error string `gorm:"size:255"`
+
+	// Les messages forment un arbre : ParentID est le message précédent (nil pour le premier).
+	// Une question modifiée ou une réponse régénérée est un nouvel enfant du même parent ;
+	// Active marque les messages de la branche suivie, seule envoyée au modèle.
+	ParentID *uint `gorm:"index"`
+	Active   bool
+
+	// Persona et version du prompt système utilisés pour générer un message du bot
+	Persona       string `gorm:"size:64"`
+	PromptVersion *int
+	// Model est le modèle qui a répondu (modèle de secours compris), LatencyMs la durée de génération
+	// en millisecondes, appels d'outils compris
+	Model     string `gorm:"size:128"`
+	LatencyMs int64
+}
+
+func (ConversationHistory) TableName() string {
+	return "conversation_history"
+}
+
+// migrateConversationTurns numérote les messages enregistrés avant l'introduction des échanges
+// (une question et la réponse qui la suit forment un échange), puis crée l'index unique (user_id, seq)
+// qui garantit l'ordre des messages quand plusieurs requêtes d'un utilisateur se terminent ensemble.
+func migrateConversationTurns(db *gorm.DB) error {
+	var rows []ConversationHistory
+	if err := db.Where("seq = 0 OR seq IS NULL").Order("user_id, id").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		next := map[uint]int{}
+		var last []struct {
+			UserID uint
+			Seq    int
+		}
+		if err := db.Model(&ConversationHistory{}).Select("user_id, MAX(seq) AS seq").Group("user_id").Scan(&last).Error; err != nil {
+			return err
+		}
+		for _, l := range last {
+			next[l.UserID] = l.Seq
+		}
+		turns := map[uint]string{}
+		for _, row := range rows {
+			next[row.UserID]++
+			turn := turns[row.UserID]
+			if row.Role != MessageRoleAssistant || turn == "" {
+				turn = fmt.Sprintf("legacy-%d", row.ID)
+			}
+			turns[row.UserID] = turn
+			if row.Role == MessageRoleAssistant {
+				turns[row.UserID] = ""
+			}
+			if err := db.Model(&row).UpdateColumns(map[string]interface{}{"seq": next[row.UserID], "turn_id": turn}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if err := db.Model(&ConversationHistory{}).Where("status IS NULL OR status = ''").
+		Update("status", MessageStatusComplete).Error; err != nil {
+		return err
+	}
+	if !db.Migrator().HasIndex(&ConversationHistory{}, "idx_conversation_history_user_seq") {
+		return db.Exec("CREATE UNIQUE INDEX idx_conversation_history_user_seq ON conversation_history (user_id, seq)").Error
+	}
+	return nil
+}
+
+// migrateConversationTree chaîne les messages enregistrés avant l'introduction des branches
+// (active encore NULL) : chacun a pour parent le message précédent de l'utilisateur et
+// tous forment la branche active.
+func migrateConversationTree(db *gorm.DB) error {
+	var rows []ConversationHistory
+	if err := db.Where("active IS NULL").Order("user_id, seq").Find(&rows).Error; err != nil {
+		return err
+	}
+	previous := map[uint]uint{}
+	for _, row := range rows {
+		var parent *uint
+		if id, ok := previous[row.UserID]; ok {
+			parent = &id
+		}
+		if err := db.Model(&row).UpdateColumns(map[string]interface{}{"parent_id": parent, "active": true}).Error; err != nil {
+			return err
+		}
+		previous[row.UserID] = row.ID
+	}
+	return nil
+}
+
+// migrateConversationRoles renseigne le rôle des messages enregistrés avant son introduction.
+// Seul l'expéditeur "bot" désignait l'assistant ; pour un utilisateur nommé "bot", les messages
+// de l'utilisateur et du bot, enregistrés par paires, sont distingués par leur ordre.
+func migrateConversationRoles(db *gorm.DB) error {
+	pending := "role IS NULL OR role = ''"
+	if err := db.Model(&ConversationHistory{}).Where(pending).Where("sender <> ?", "bot").
+		Update("role", MessageRoleUser).Error; err != nil {
+		return err
+	}
+	ambiguous := db.Model(&User{}).Select("id").Where("username = ?", "bot")
+	if err := db.Model(&ConversationHistory{}).Where(pending).Where("sender = ? AND user_id NOT IN (?)", "bot", ambiguous).
+		Update("role", MessageRoleAssistant).Error; err != nil {
+		return err
+	}
+
+	var rows []ConversationHistory
+	if err := db.Where(pending).Order("user_id, id").Find(&rows).Error; err != nil {
+		return err
+	}
+	next := map[uint]string{}
+	for _, row := range rows {
+		role := next[row.UserID]
+		if role != MessageRoleAssistant {
+			role = MessageRoleUser
+		}
+		if err := db.Model(&row).UpdateColumn("role", role).Error; err != nil {
+			return err
+		}
+		if role == MessageRoleUser {
+			next[row.UserID] = MessageRoleAssistant
+		} else {
+			next[row.UserID] = MessageRoleUser
+		}
+	}
+	return nil
+}
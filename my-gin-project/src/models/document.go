@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Formats des documents de la base de connaissances
+const (
+	DocumentFormatMarkdown = "markdown"
+	DocumentFormatText     = "text"
+)
+
+// Document est un guide ou une FAQ interne que l'assistant IA consulte pour répondre (RAG)
+type Document struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Title string `json:"title" gorm:"size:255" example:"Guide d'Annecy"`
+	// Source est l'origine citée dans les réponses (URL, nom du fichier...)
+	Source  string `json:"source" gorm:"size:512" example:"guides/annecy.md"`
+	Format  string `json:"format" gorm:"size:16" example:"markdown"`
+	Content string `json:"content,omitempty" gorm:"type:mediumtext"`
+	// Checksum (SHA-256 du contenu) évite d'indexer deux fois le même document
+	Checksum string `json:"checksum" gorm:"size:64;uniqueIndex"`
+	Chunks   int    `json:"chunks" example:"12"`
+	// EmbeddingModel est le modèle qui a calculé les vecteurs des extraits
+	EmbeddingModel string    `json:"embedding_model" gorm:"size:128" example:"nomic-embed-text"`
+	CreatedBy      uint      `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DocumentChunk est un extrait d'un document avec son embedding
+type DocumentChunk struct {
+	ID         uint `gorm:"primaryKey"`
+	DocumentID uint `gorm:"index"`
+	Position   int
+	Content    string `gorm:"type:text"`
+	Model      string `gorm:"size:128;index"`
+	Embedding  Vector `gorm:"type:blob"`
+}
+
+// Vector est un embedding, stocké en float32 little-endian
+type Vector []float32
+
+func (v Vector) Value() (driver.Value, error) {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf, nil
+}
+
+func (v *Vector) Scan(src interface{}) error {
+	var buf []byte
+	switch s := src.(type) {
+	case []byte:
+		buf = s
+	case string:
+		buf = []byte(s)
+	case nil:
+		*v = nil
+		return nil
+	default:
+		return errors.New("vector: unsupported type")
+	}
+	if len(buf)%4 != 0 {
+		return errors.New("vector: invalid length")
+	}
+	out := make(Vector, len(buf)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	*v = out
+	return nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Appréciations d'une réponse de l'assistant IA
+const (
+	FeedbackUp   = "up"
+	FeedbackDown = "down"
+)
+
+// MessageFeedback est l'avis de l'utilisateur sur une réponse de l'assistant IA (un seul par réponse)
+type MessageFeedback struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MessageID uint      `json:"message_id" gorm:"uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Rating    string    `json:"rating" gorm:"size:8" example:"up"`
+	Comment   string    `json:"comment" gorm:"type:text" example:"Bonne idée, mais le train de nuit n'existe plus"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (MessageFeedback) TableName() string {
+	return "message_feedback"
+}
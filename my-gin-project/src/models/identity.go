@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity relie un utilisateur à son compte chez un fournisseur OpenID Connect externe
+type UserIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Provider  string `gorm:"size:64;uniqueIndex:idx_user_identities_subject"`
+	Subject   string `gorm:"size:255;uniqueIndex:idx_user_identities_subject"`
+	Email     string `gorm:"size:255"`
+	CreatedAt time.Time
+}
@@ -1,40 +1,90 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 type Item struct {
-	ID    int     `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description" gorm:"type:text"`
+	Price       float64 `json:"price"`
 }
 
+type Destination struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name" example:"Annecy"`
+	Country     string `json:"country" example:"France"`
+	Description string `json:"description" gorm:"type:text" example:"Le lac le plus pur d'Europe, au pied des Alpes."`
+}
+
+// Rôles des utilisateurs
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles liste les rôles valides
+var Roles = []string{RoleUser, RoleAdmin}
+
 type User struct {
-	ID       uint   `gorm:"primaryKey"`
-	Username string `gorm:"unique"`
-	Password string
+	ID              uint    `gorm:"primaryKey"`
+	Username        string  `gorm:"unique"`
+	Email           *string `gorm:"uniqueIndex;size:255"`
+	Password        string
+	Role            string `gorm:"size:32;default:user"`
+	EmailVerifiedAt *time.Time
+	DeactivatedAt   *time.Time
+	CreatedAt       time.Time
+	LastLoginAt     *time.Time
+
+	// Compte suspendu par un administrateur (DeactivatedAt correspond à une désactivation par l'utilisateur)
+	DisabledAt     *time.Time
+	DisabledReason string `gorm:"size:255"`
+
+	// Double authentification TOTP : le secret est en attente de confirmation tant que TOTPEnabledAt est nil
+	TOTPSecret    string `gorm:"size:64"`
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep est la dernière période TOTP utilisée, pour refuser le rejeu d'un code
+	TOTPLastStep int64
+
+	// Quotas de tokens de l'assistant IA propres au compte (nil : quotas du rôle, 0 : pas de limite)
+	DailyTokenQuota   *int64
+	MonthlyTokenQuota *int64
 }
 
 var DB *gorm.DB
 
-func InitDB() (*gorm.DB, error) {
-	dsn := os.Getenv("DB_USER") + ":" +
+// DSNFromEnv renvoie la chaîne de connexion MySQL de l'application (DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, DB_NAME)
+func DSNFromEnv() string {
+	return os.Getenv("DB_USER") + ":" +
 		os.Getenv("DB_PASSWORD") + "@tcp(" +
 		os.Getenv("DB_HOST") + ":" +
 		os.Getenv("DB_PORT") + ")/" +
 		os.Getenv("DB_NAME") + "?charset=utf8mb4&parseTime=True&loc=Local"
+}
+
+func InitDB() (*gorm.DB, error) {
+	return OpenDB(DSNFromEnv())
+}
 
+// OpenDB se connecte à la base MySQL dsn, met à jour son schéma et la conserve dans DB
+func OpenDB(dsn string) (*gorm.DB, error) {
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
 
-	// Migrer les modèles
-	db.AutoMigrate(&User{}, &Item{})
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
 
 	// Conserver la DB globale
 	DB = db
@@ -42,6 +92,67 @@ func InitDB() (*gorm.DB, error) {
 	return db, nil
 }
 
+// Migrate crée ou met à jour le schéma de la base
+func Migrate(db *gorm.DB) error {
+	// Migrer les modèles
+	err := db.AutoMigrate(
+		&User{}, &Item{}, &Destination{}, &AuditLog{},
+		&UserToken{}, &RecoveryCode{}, &UserIdentity{}, &APIKey{}, &Session{},
+		&UserProfile{}, &ConversationHistory{}, &PromptTemplate{}, &ToolInvocation{},
+		&Document{}, &DocumentChunk{}, &MessageFeedback{}, &ModerationFlag{}, &AIUsage{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := createFullTextIndexes(db); err != nil {
+		return err
+	}
+	if err := migrateConversationRoles(db); err != nil {
+		return err
+	}
+	if err := migrateConversationTurns(db); err != nil {
+		return err
+	}
+	if err := migrateConversationTree(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// createFullTextIndexes crée les index FULLTEXT utilisés par la recherche.
+// Le parser ngram tolère les fautes de frappe et la collation utf8mb4 par défaut ignore les accents.
+func createFullTextIndexes(db *gorm.DB) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+	indexes := []struct{ table, name, columns string }{
+		{"items", "ft_items", "name, description"},
+		{"destinations", "ft_destinations", "name, country, description"},
+		{"conversation_history", "ft_conversation_history", "message"},
+	}
+	for _, idx := range indexes {
+		if db.Migrator().HasIndex(idx.table, idx.name) {
+			continue
+		}
+		sql := fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s) WITH PARSER ngram", idx.table, idx.name, idx.columns)
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (item *Item) UpdatePrice(newPrice float64) {
 	item.Price = newPrice
 }
+
+// Validate vérifie qu'un item peut être enregistré
+func (item *Item) Validate() error {
+	if strings.TrimSpace(item.Name) == "" {
+		return errors.New("name is required")
+	}
+	if item.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ModerationFlag est une détection de la modération sur un message de conversation. Elle ne contient
+// pas le texte détecté : le message enregistré est déjà masqué ou remplacé selon l'action.
+type ModerationFlag struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// UserID est nil pour un appel anonyme de /chat-ai, dont l'échange n'est pas enregistré :
+	// la détection garde alors l'adresse du client et l'identifiant de la requête
+	UserID    *uint  `json:"user_id" gorm:"index"`
+	ClientIP  string `json:"client_ip,omitempty" gorm:"size:45" example:"203.0.113.7"`
+	RequestID string `json:"request_id,omitempty" gorm:"size:64"`
+	// MessageID est la question ou la réponse concernée
+	MessageID *uint `json:"message_id" gorm:"index"`
+	// Direction vaut input (question) ou output (réponse du modèle)
+	Direction string `json:"direction" gorm:"size:8" example:"input"`
+	// Check est le contrôle à l'origine de la détection (colonne check_name : CHECK est un mot réservé de MySQL)
+	Check     string    `json:"check" gorm:"column:check_name;size:32" example:"pii"`
+	Category  string    `json:"category" gorm:"size:64" example:"email"`
+	Action    string    `json:"action" gorm:"size:8" example:"mask"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Styles de voyage proposés dans le profil
+var TravelStyles = []string{"backpacker", "comfort", "luxury", "adventure", "family", "business", "romantic", "cultural"}
+
+var (
+	currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)               // ISO 4217
+	airportRe  = regexp.MustCompile(`^[A-Z]{3}$`)               // code IATA
+	languageRe = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`) // fr, en-GB...
+)
+
+// UserProfile contient les informations et préférences de voyage d'un utilisateur,
+// utilisées pour personnaliser les réponses de l'assistant. Tous les champs sont facultatifs.
+type UserProfile struct {
+	UserID      uint   `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	DisplayName string `json:"display_name" gorm:"size:100" example:"Thomas"`
+	HomeCity    string `json:"home_city" gorm:"size:100" example:"Lyon"`
+	HomeAirport string `json:"home_airport" gorm:"size:3" example:"LYS"`
+	Currency    string `json:"currency" gorm:"size:3" example:"EUR"`
+	Language    string `json:"language" gorm:"size:16" example:"fr"`
+	// Besoins alimentaires et d'accessibilité, en texte libre
+	DietaryNeeds       []string `json:"dietary_needs" gorm:"type:text;serializer:json" example:"végétarien"`
+	AccessibilityNeeds []string `json:"accessibility_needs" gorm:"type:text;serializer:json" example:"fauteuil roulant"`
+	TravelStyle        string   `json:"travel_style" gorm:"size:32" example:"comfort"`
+	// Budget par personne et par voyage, dans Currency
+	BudgetMin *float64  `json:"budget_min" example:"500"`
+	BudgetMax *float64  `json:"budget_max" example:"1500"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Normalize nettoie les valeurs saisies (espaces, casse des codes, listes vides)
+func (p *UserProfile) Normalize() {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	p.HomeCity = strings.TrimSpace(p.HomeCity)
+	p.HomeAirport = strings.ToUpper(strings.TrimSpace(p.HomeAirport))
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+	p.Language = strings.TrimSpace(p.Language)
+	p.TravelStyle = strings.ToLower(strings.TrimSpace(p.TravelStyle))
+	p.DietaryNeeds = cleanList(p.DietaryNeeds)
+	p.AccessibilityNeeds = cleanList(p.AccessibilityNeeds)
+}
+
+func cleanList(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Validate vérifie un profil normalisé
+func (p *UserProfile) Validate() error {
+	switch {
+	case len([]rune(p.DisplayName)) > 100:
+		return errors.New("display_name is too long")
+	case len([]rune(p.HomeCity)) > 100:
+		return errors.New("home_city is too long")
+	case p.HomeAirport != "" && !airportRe.MatchString(p.HomeAirport):
+		return errors.New("home_airport must be a 3-letter IATA code")
+	case p.Currency != "" && !currencyRe.MatchString(p.Currency):
+		return errors.New("currency must be a 3-letter ISO 4217 code")
+	case p.Language != "" && !languageRe.MatchString(p.Language):
+		return errors.New("language must be a language code such as fr or en-GB")
+	case p.TravelStyle != "" && !slices.Contains(TravelStyles, p.TravelStyle):
+		return fmt.Errorf("travel_style must be one of %s", strings.Join(TravelStyles, ", "))
+	case len(p.DietaryNeeds) > 20 || len(p.AccessibilityNeeds) > 20:
+		return errors.New("too many dietary or accessibility needs")
+	case p.BudgetMin != nil && *p.BudgetMin < 0, p.BudgetMax != nil && *p.BudgetMax < 0:
+		return errors.New("budget must not be negative")
+	case p.BudgetMin != nil && p.BudgetMax != nil && *p.BudgetMin > *p.BudgetMax:
+		return errors.New("budget_min must not exceed budget_max")
+	}
+	for _, v := range append(slices.Clone(p.DietaryNeeds), p.AccessibilityNeeds...) {
+		if len([]rune(v)) > 100 {
+			return errors.New("dietary and accessibility needs are limited to 100 characters each")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PromptTemplate est une version du prompt système d'une persona de l'assistant IA.
+// Les versions ne sont jamais modifiées : une modification crée une nouvelle version,
+// et la plus récente est celle utilisée.
+type PromptTemplate struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Persona     string    `json:"persona" gorm:"size:64;uniqueIndex:idx_prompt_templates_version" example:"travel"`
+	Version     int       `json:"version" gorm:"uniqueIndex:idx_prompt_templates_version" example:"3"`
+	Description string    `json:"description" gorm:"size:255" example:"Assistant de voyage généraliste"`
+	Body        string    `json:"body" gorm:"type:text"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session est une connexion d'un utilisateur, créée à chaque délivrance d'un token d'accès
+// (mot de passe, double authentification ou OpenID Connect). Le token porte l'identifiant
+// de sa session (claim sid) : une session révoquée rend le token inutilisable.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Method     string     `json:"method" gorm:"size:64" example:"password"`
+	IP         string     `json:"ip" gorm:"size:64"`
+	UserAgent  string     `json:"user_agent" gorm:"size:255"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Active indique si la session est utilisable à l'instant now
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
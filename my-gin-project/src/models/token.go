@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Usages des jetons envoyés par email
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+// UserToken est un jeton à usage unique (vérification d'email, réinitialisation de mot de passe).
+// Seul le hash SHA-256 du jeton est conservé.
+type UserToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"size:32"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RecoveryCode est un code de secours à usage unique pour la double authentification.
+// Seul le hash SHA-256 du code est conservé.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	CodeHash  string `gorm:"size:64;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ToolInvocation trace un outil exécuté à la demande de l'assistant IA pendant une conversation
+type ToolInvocation struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID uint `json:"user_id" gorm:"index"`
+	// MessageID est la réponse du bot produite avec ce résultat (nil si la génération a échoué)
+	MessageID *uint  `json:"message_id" gorm:"index"`
+	Round     int    `json:"round"`
+	Tool      string `json:"tool" gorm:"size:64" example:"search_items"`
+	Arguments string `json:"arguments" gorm:"type:text" example:"{\"query\":\"annecy\"}"`
+	Result    string `json:"result" gorm:"type:text"`
+	Error     string `json:"error" gorm:"size:255"`
+	// DurationMs est la durée d'exécution de l'outil en millisecondes
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
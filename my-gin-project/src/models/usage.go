@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AIUsage est la consommation d'une génération de l'assistant IA : les tokens de tous les appels au
+// modèle (tours d'outils compris) et leur coût au prix en vigueur. Elle est conservée quand la
+// conversation est effacée, pour que les quotas ne puissent pas être remis à zéro.
+type AIUsage struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// UserID est l'utilisateur connecté (nil pour un appel anonyme, décompté de l'adresse ClientIP)
+	UserID   *uint  `json:"user_id" gorm:"index:idx_ai_usage_user_created,priority:1"`
+	ClientIP string `json:"client_ip,omitempty" gorm:"size:45;index:idx_ai_usage_client_created,priority:1"`
+	// MessageID est la réponse produite (nil si la génération a échoué ou si le message a été effacé)
+	MessageID        *uint     `json:"message_id" gorm:"index"`
+	Model            string    `json:"model" gorm:"size:64" example:"mistral"`
+	Calls            int       `json:"calls" example:"2"`
+	PromptTokens     int       `json:"prompt_tokens" example:"812"`
+	CompletionTokens int       `json:"completion_tokens" example:"145"`
+	Cost             float64   `json:"cost" example:"0.0021"`
+	CreatedAt        time.Time `json:"created_at" gorm:"index:idx_ai_usage_user_created,priority:2;index:idx_ai_usage_client_created,priority:2;index"`
+}
+
+func (AIUsage) TableName() string {
+	return "ai_usage"
+}
@@ -0,0 +1,177 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"my-gin-project/src/config"
+)
+
+// Length détecte les messages de plus de Max caractères
+type Length struct {
+	Max int
+}
+
+func (Length) Name() string { return CheckLength }
+
+func (l Length) Find(ctx context.Context, text string) ([]Match, error) {
+	if utf8.RuneCountInString(text) > l.Max {
+		return []Match{{Category: "too_long"}}, nil
+	}
+	return nil, nil
+}
+
+// Terms détecte des mots ou expressions interdits, sans tenir compte de la casse
+type Terms struct {
+	Terms   []string
+	pattern *regexp.Regexp
+}
+
+// NewTerms prépare la recherche des termes (les termes vides sont ignorés)
+func NewTerms(terms []string) *Terms {
+	t := &Terms{}
+	quoted := []string{}
+	for _, term := range terms {
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			t.Terms = append(t.Terms, term)
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+	if len(quoted) > 0 {
+		// Un terme n'est reconnu qu'entre deux séparateurs : "arme" ne correspond pas à "armée"
+		t.pattern = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])(` + strings.Join(quoted, "|") + `)(?:$|[^\p{L}\p{N}])`)
+	}
+	return t
+}
+
+// TermsFromEnv lit les termes de MODERATION_BLOCKED_TERMS (séparés par des virgules)
+// et de MODERATION_BLOCKED_TERMS_FILE (un par ligne, # pour les commentaires)
+func TermsFromEnv() (*Terms, error) {
+	terms := strings.Split(config.String("MODERATION_BLOCKED_TERMS", ""), ",")
+	if path := config.String("MODERATION_BLOCKED_TERMS_FILE", ""); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); !strings.HasPrefix(line, "#") {
+				terms = append(terms, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return NewTerms(terms), nil
+}
+
+func (*Terms) Name() string { return CheckBlockedTerms }
+
+func (t *Terms) Find(ctx context.Context, text string) ([]Match, error) {
+	if t.pattern == nil {
+		return nil, nil
+	}
+	var matches []Match
+	// Les séparateurs font partie de la correspondance : on reprend juste après le terme trouvé
+	for pos := 0; pos < len(text); {
+		loc := t.pattern.FindStringSubmatchIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[2], pos+loc[3]
+		matches = append(matches, Match{Category: strings.ToLower(text[start:end]), Start: start, End: end})
+		pos = end
+	}
+	return matches, nil
+}
+
+// PII détecte les adresses email, les numéros de carte bancaire (vérifiés par la clé de Luhn)
+// et les numéros de passeport
+type PII struct{}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// Passeport français (2 chiffres, 2 lettres, 5 chiffres), ou numéro annoncé comme tel
+	passportPattern        = regexp.MustCompile(`\b\d{2}[A-Z]{2}\d{5}\b`)
+	passportKeywordPattern = regexp.MustCompile(`(?i)\b(?:passeport|passport)\b[^A-Za-z0-9]{0,5}(?:(?:n°|no\.?|num[ée]ro|number)[^A-Za-z0-9]{0,3})?([A-Z0-9]{6,9})\b`)
+)
+
+func (PII) Name() string { return CheckPII }
+
+func (PII) Find(ctx context.Context, text string) ([]Match, error) {
+	var matches []Match
+	for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+		matches = append(matches, Match{Category: "email", Start: loc[0], End: loc[1]})
+	}
+	for _, loc := range cardPattern.FindAllStringIndex(text, -1) {
+		if luhn(text[loc[0]:loc[1]]) {
+			matches = append(matches, Match{Category: "card", Start: loc[0], End: loc[1]})
+		}
+	}
+	passports := map[int]bool{}
+	for _, loc := range passportPattern.FindAllStringIndex(text, -1) {
+		matches = append(matches, Match{Category: "passport", Start: loc[0], End: loc[1]})
+		passports[loc[0]] = true
+	}
+	for _, loc := range passportKeywordPattern.FindAllStringSubmatchIndex(text, -1) {
+		// Un numéro contient au moins un chiffre : "passeport valide" n'en est pas un
+		if number := text[loc[2]:loc[3]]; strings.ContainsAny(number, "0123456789") && !passports[loc[2]] {
+			matches = append(matches, Match{Category: "passport", Start: loc[2], End: loc[3]})
+		}
+	}
+	return matches, nil
+}
+
+// luhn vérifie la clé d'un numéro de carte (les espaces et tirets sont ignorés)
+func luhn(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Injection repère les formulations courantes des tentatives d'injection de prompt. C'est une
+// heuristique : elle signale par défaut plutôt que de bloquer.
+type Injection struct{}
+
+var injectionPatterns = []struct {
+	category string
+	pattern  *regexp.Regexp
+}{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignore[rsz]?|oublie[rsz]?|forget|disregard)\b.{0,40}\b(instructions?|consignes?|règles|rules|prompt|précédent|previous|above)`)},
+	{"reveal_prompt", regexp.MustCompile(`(?i)\b(révèle|affiche|montre|répète|donne[- ]moi|reveal|print|show|repeat)\b.{0,30}\b(ton|tes|votre|vos|your|the)\b.{0,20}\b(prompt|instructions|consignes)`)},
+	{"role_override", regexp.MustCompile(`(?i)(\btu es maintenant\b|\bdésormais,? tu es\b|\byou are now\b|\bact as\b|\bfais comme si\b|\bpretend (to be|you are)\b)`)},
+	{"fake_role", regexp.MustCompile(`(?im)(^\s*(system|assistant)\s*:|<\|im_start\|>|\[/?INST\]|<</?SYS>>)`)},
+	{"jailbreak", regexp.MustCompile(`(?i)\b(jailbreak|DAN mode|developer mode|mode développeur)\b`)},
+}
+
+func (Injection) Name() string { return CheckInjection }
+
+func (Injection) Find(ctx context.Context, text string) ([]Match, error) {
+	var matches []Match
+	for _, p := range injectionPatterns {
+		if p.pattern.MatchString(text) {
+			matches = append(matches, Match{Category: p.category})
+		}
+	}
+	return matches, nil
+}
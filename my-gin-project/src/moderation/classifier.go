@@ -0,0 +1,59 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"my-gin-project/src/llm"
+)
+
+const classifierPrompt = `Tu es un modérateur de contenu pour un assistant de voyage.
+Classe le message fourni. Catégories interdites : hate (haine, harcèlement), violence (menaces, armes),
+sexual (contenu sexuel), self_harm (automutilation), illegal (activités illégales, fraude, trafic).
+Réponds uniquement avec un objet JSON de la forme {"flagged": true|false, "category": "<catégorie ou none>"}.`
+
+// Classifier fait classer le message par un modèle de langage (MODERATION_CLASSIFIER_MODEL)
+type Classifier struct {
+	LLM   llm.Client
+	Model string
+}
+
+func (*Classifier) Name() string { return CheckClassifier }
+
+func (c *Classifier) Find(ctx context.Context, text string) ([]Match, error) {
+	matches, _, err := c.FindMetered(ctx, text)
+	return matches, err
+}
+
+// FindMetered classe text et renvoie aussi la réponse du modèle, dont les tokens sont à la charge de l'appelant
+func (c *Classifier) FindMetered(ctx context.Context, text string) ([]Match, llm.Response, error) {
+	resp, err := c.LLM.Chat(ctx, llm.Request{
+		Model: c.Model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: classifierPrompt},
+			{Role: llm.RoleUser, Content: text},
+		},
+		MaxTokens: 50,
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	content := resp.Message.Content
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	var out struct {
+		Flagged  bool   `json:"flagged"`
+		Category string `json:"category"`
+	}
+	if start < 0 || end < start || json.Unmarshal([]byte(content[start:end+1]), &out) != nil {
+		return nil, resp, fmt.Errorf("unexpected classifier answer: %q", content)
+	}
+	if !out.Flagged {
+		return nil, resp, nil
+	}
+	if out.Category == "" || out.Category == "none" {
+		out.Category = "unsafe"
+	}
+	return []Match{{Category: out.Category}}, resp, nil
+}
@@ -0,0 +1,260 @@
+// Package moderation contrôle les messages échangés avec l'assistant IA : longueur, termes interdits,
+// données personnelles, tentatives d'injection de prompt et classification par un modèle. Chaque contrôle
+// est associé, pour les questions et pour les réponses, à une action : bloquer, masquer ou signaler.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/llm"
+)
+
+// Sens du message contrôlé
+const (
+	Input  = "input"
+	Output = "output"
+)
+
+// Actions possibles quand un contrôle détecte un problème
+const (
+	// ActionBlock refuse la question, ou remplace la réponse par BlockedReply
+	ActionBlock = "block"
+	// ActionMask remplace les passages détectés ; une détection portant sur tout le message est signalée
+	ActionMask = "mask"
+	// ActionFlag laisse passer le message et le signale aux administrateurs
+	ActionFlag = "flag"
+	// ActionOff désactive le contrôle
+	ActionOff = "off"
+)
+
+// DefaultBlockedReply remplace une réponse bloquée
+const DefaultBlockedReply = "Désolé, je ne peux pas répondre à cette demande."
+
+// Match est un passage détecté par un contrôle
+type Match struct {
+	Category string
+	// Start et End délimitent le passage (octets) ; End vaut 0 quand la détection porte sur tout le message
+	Start, End int
+}
+
+// Check est un contrôle de modération
+type Check interface {
+	Name() string
+	Find(ctx context.Context, text string) ([]Match, error)
+}
+
+// MeteredCheck est un contrôle qui appelle un modèle de langage : la réponse de chaque appel est
+// renvoyée, même en cas d'erreur, pour que ses tokens soient décomptés avec ceux de la génération
+type MeteredCheck interface {
+	Check
+	FindMetered(ctx context.Context, text string) ([]Match, llm.Response, error)
+}
+
+// Rule associe un contrôle à l'action à appliquer
+type Rule struct {
+	Check  Check
+	Action string
+}
+
+// Finding est une détection, enregistrée sans le texte concerné
+type Finding struct {
+	Check    string `json:"check" example:"pii"`
+	Category string `json:"category" example:"email"`
+	Action   string `json:"action" example:"mask"`
+}
+
+// Verdict est le résultat du contrôle d'un message
+type Verdict struct {
+	// Text est le message après masquage
+	Text     string
+	Blocked  bool
+	Findings []Finding
+	// Calls sont les appels au modèle faits par les contrôles (classificateur), à décompter des quotas
+	Calls []llm.Response
+}
+
+// BlockedError est renvoyée quand une question est refusée
+type BlockedError struct {
+	Findings []Finding
+}
+
+func (e *BlockedError) Error() string {
+	checks := []string{}
+	for _, f := range e.Findings {
+		if f.Action == ActionBlock {
+			checks = append(checks, f.Check+":"+f.Category)
+		}
+	}
+	return "blocked by moderation (" + strings.Join(checks, ", ") + ")"
+}
+
+// Pipeline applique dans l'ordre les règles des questions (Input) ou des réponses (Output)
+type Pipeline struct {
+	Input  []Rule
+	Output []Rule
+	// BlockedReply remplace une réponse bloquée
+	BlockedReply string
+}
+
+// Moderate contrôle text dans le sens direction. Un passage masqué l'est aussi pour les contrôles suivants.
+// Un contrôle en erreur (classificateur indisponible) est ignoré : la modération ne bloque pas le service.
+func (p *Pipeline) Moderate(ctx context.Context, direction, text string) Verdict {
+	rules := p.Input
+	if direction == Output {
+		rules = p.Output
+	}
+	v := Verdict{Text: text, Findings: []Finding{}}
+	for _, rule := range rules {
+		if rule.Action == ActionOff {
+			continue
+		}
+		matches, call, err := find(ctx, rule.Check, v.Text)
+		if call.Model != "" || call.PromptTokens+call.CompletionTokens > 0 {
+			v.Calls = append(v.Calls, call)
+		}
+		if err != nil {
+			fmt.Println("[ERROR] Contrôle de modération", rule.Check.Name(), "en échec:", err)
+			continue
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		spans := []Match{}
+		for _, m := range matches {
+			action := rule.Action
+			if action == ActionMask {
+				if m.End == 0 {
+					action = ActionFlag
+				} else {
+					spans = append(spans, m)
+				}
+			}
+			if action == ActionBlock {
+				v.Blocked = true
+			}
+			v.Findings = append(v.Findings, Finding{Check: rule.Check.Name(), Category: m.Category, Action: action})
+		}
+		v.Text = mask(v.Text, spans)
+	}
+	return v
+}
+
+// find applique check à text, avec la réponse du modèle appelé s'il s'agit d'un MeteredCheck
+func find(ctx context.Context, check Check, text string) ([]Match, llm.Response, error) {
+	if metered, ok := check.(MeteredCheck); ok {
+		return metered.FindMetered(ctx, text)
+	}
+	matches, err := check.Find(ctx, text)
+	return matches, llm.Response{}, err
+}
+
+// mask remplace chaque passage par sa catégorie entre crochets ; les passages qui se chevauchent sont fusionnés
+func mask(text string, spans []Match) string {
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	var out strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.Start < pos {
+			if s.End > pos {
+				pos = s.End
+			}
+			continue
+		}
+		out.WriteString(text[pos:s.Start])
+		out.WriteString("[" + s.Category + "]")
+		pos = s.End
+	}
+	out.WriteString(text[pos:])
+	return out.String()
+}
+
+// Noms des contrôles, utilisés dans les variables MODERATION_<NOM>_INPUT et MODERATION_<NOM>_OUTPUT
+const (
+	CheckLength       = "length"
+	CheckBlockedTerms = "blocked_terms"
+	CheckPII          = "pii"
+	CheckInjection    = "injection"
+	CheckClassifier   = "classifier"
+)
+
+// defaultActions sont les actions par défaut de chaque contrôle, pour les questions puis pour les réponses
+var defaultActions = map[string][2]string{
+	CheckLength:       {ActionBlock, ActionFlag},
+	CheckBlockedTerms: {ActionBlock, ActionMask},
+	CheckPII:          {ActionMask, ActionMask},
+	CheckInjection:    {ActionFlag, ActionOff},
+	CheckClassifier:   {ActionBlock, ActionBlock},
+}
+
+// Default contrôle la longueur des questions (4000 caractères), masque les données personnelles
+// des questions et des réponses et signale les tentatives d'injection, sans configuration
+func Default() *Pipeline {
+	return &Pipeline{
+		Input: []Rule{
+			{Check: Length{Max: 4000}, Action: ActionBlock},
+			{Check: PII{}, Action: ActionMask},
+			{Check: Injection{}, Action: ActionFlag},
+		},
+		Output:       []Rule{{Check: PII{}, Action: ActionMask}},
+		BlockedReply: DefaultBlockedReply,
+	}
+}
+
+// FromEnv construit le pipeline configuré par les variables MODERATION_* ; client sert au
+// classificateur (MODERATION_CLASSIFIER_MODEL)
+func FromEnv(client llm.Client) (*Pipeline, error) {
+	p := &Pipeline{BlockedReply: config.String("MODERATION_BLOCKED_REPLY", DefaultBlockedReply)}
+	if !config.Bool("MODERATION_ENABLED", true) {
+		return p, nil
+	}
+	terms, err := TermsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	checks := []struct {
+		name          string
+		input, output Check
+	}{
+		{CheckLength, Length{Max: config.Int("MODERATION_MAX_INPUT_LENGTH", 4000)}, Length{Max: config.Int("MODERATION_MAX_OUTPUT_LENGTH", 0)}},
+		{CheckBlockedTerms, terms, terms},
+		{CheckPII, PII{}, PII{}},
+		{CheckInjection, Injection{}, Injection{}},
+		{CheckClassifier, nil, nil},
+	}
+	if model := config.String("MODERATION_CLASSIFIER_MODEL", ""); model != "" {
+		classifier := &Classifier{LLM: client, Model: model}
+		checks[4].input, checks[4].output = classifier, classifier
+	}
+	for _, c := range checks {
+		defaults := defaultActions[c.name]
+		for i, direction := range []string{Input, Output} {
+			check := []Check{c.input, c.output}[i]
+			if check == nil || (c.name == CheckLength && check.(Length).Max <= 0) || (c.name == CheckBlockedTerms && len(terms.Terms) == 0) {
+				continue
+			}
+			key := "MODERATION_" + strings.ToUpper(c.name) + "_" + strings.ToUpper(direction)
+			action := config.String(key, defaults[i])
+			switch action {
+			case ActionBlock, ActionMask, ActionFlag:
+			case ActionOff:
+				continue
+			default:
+				return nil, fmt.Errorf("invalid %s: %q (block, mask, flag or off)", key, action)
+			}
+			rule := Rule{Check: check, Action: action}
+			if direction == Input {
+				p.Input = append(p.Input, rule)
+			} else {
+				p.Output = append(p.Output, rule)
+			}
+		}
+	}
+	return p, nil
+}
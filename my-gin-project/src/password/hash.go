@@ -0,0 +1,146 @@
+// Package password hache et vérifie les mots de passe (argon2id ou bcrypt) et applique
+// la politique de mots de passe (longueur, mots de passe compromis, nom d'utilisateur).
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"my-gin-project/src/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithmes de hachage
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// ErrUnknownHash est renvoyée pour un hash dont le format n'est pas reconnu
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params sont les paramètres de coût d'argon2id
+type Argon2Params struct {
+	Memory      uint32 // en Kio
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher hache les nouveaux mots de passe avec Algorithm.
+// Les hashs existants d'un autre algorithme ou d'un autre coût restent vérifiables
+// et sont signalés comme à rehacher.
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultHasher utilise argon2id avec les paramètres minimaux recommandés par l'OWASP
+func DefaultHasher() *Hasher {
+	return &Hasher{
+		Algorithm:  Argon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2:     Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	}
+}
+
+// HasherFromEnv lit PASSWORD_HASH, BCRYPT_COST, ARGON2_MEMORY, ARGON2_ITERATIONS et ARGON2_PARALLELISM
+func HasherFromEnv() (*Hasher, error) {
+	h := DefaultHasher()
+	h.Algorithm = config.String("PASSWORD_HASH", h.Algorithm)
+	h.BcryptCost = config.Int("BCRYPT_COST", h.BcryptCost)
+	h.Argon2.Memory = uint32(config.Int("ARGON2_MEMORY", int(h.Argon2.Memory)))
+	h.Argon2.Iterations = uint32(config.Int("ARGON2_ITERATIONS", int(h.Argon2.Iterations)))
+	h.Argon2.Parallelism = uint8(config.Int("ARGON2_PARALLELISM", int(h.Argon2.Parallelism)))
+
+	switch {
+	case h.Algorithm != Argon2id && h.Algorithm != Bcrypt:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH %q", h.Algorithm)
+	case h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost:
+		return nil, fmt.Errorf("invalid BCRYPT_COST %d", h.BcryptCost)
+	case h.Argon2.Memory < 8*uint32(h.Argon2.Parallelism) || h.Argon2.Iterations < 1 || h.Argon2.Parallelism < 1:
+		return nil, errors.New("invalid argon2 parameters")
+	}
+	return h, nil
+}
+
+// Hash hache password avec l'algorithme et les paramètres courants
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	}
+
+	p := h.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	// Format PHC, comme la bibliothèque de référence : $argon2id$v=19$m=...,t=...,p=...$sel$hash
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify vérifie password contre hash. rehash indique que le hash utilise un algorithme
+// ou des paramètres dépassés et doit être recalculé maintenant que le mot de passe est connu.
+// Un hash vide (compte sans mot de passe) ne correspond à aucun mot de passe.
+func (h *Hasher) Verify(hash, password string) (ok bool, rehash bool, err error) {
+	switch {
+	case hash == "":
+		return false, false, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return h.verifyArgon2(hash, password)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, h.Algorithm != Bcrypt || cost != h.BcryptCost, err
+	}
+	return false, false, ErrUnknownHash
+}
+
+func (h *Hasher) verifyArgon2(hash, password string) (bool, bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownHash
+	}
+	var version int
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, false, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return false, false, nil
+	}
+	cur := h.Argon2
+	rehash := h.Algorithm != Argon2id || version != argon2.Version ||
+		p.Memory != cur.Memory || p.Iterations != cur.Iterations || p.Parallelism != cur.Parallelism ||
+		uint32(len(salt)) != cur.SaltLength || uint32(len(expected)) != cur.KeyLength
+	return true, rehash, nil
+}
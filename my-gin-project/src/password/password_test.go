@@ -0,0 +1,116 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func fastHasher(algorithm string) *Hasher {
+	h := DefaultHasher()
+	h.Algorithm = algorithm
+	h.BcryptCost = bcrypt.MinCost
+	h.Argon2.Memory, h.Argon2.Iterations = 1024, 1
+	return h
+}
+
+func TestHashVerify(t *testing.T) {
+	for _, algorithm := range []string{Argon2id, Bcrypt} {
+		h := fastHasher(algorithm)
+		hash, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, rehash, err := h.Verify(hash, "correct horse"); !ok || rehash || err != nil {
+			t.Errorf("%s: expected a valid, current hash, got %v %v %v", algorithm, ok, rehash, err)
+		}
+		if ok, _, _ := h.Verify(hash, "wrong horse"); ok {
+			t.Errorf("%s: expected a wrong password to be refused", algorithm)
+		}
+	}
+	if ok, _, err := DefaultHasher().Verify("", ""); ok || err != nil {
+		t.Errorf("Expected an empty hash to match nothing")
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	old := fastHasher(Bcrypt)
+	hash, _ := old.Hash("correct horse")
+
+	// Changement d'algorithme
+	if ok, rehash, _ := fastHasher(Argon2id).Verify(hash, "correct horse"); !ok || !rehash {
+		t.Errorf("Expected a bcrypt hash to need a rehash with argon2id, got %v %v", ok, rehash)
+	}
+	// Changement de coût
+	stronger := fastHasher(Bcrypt)
+	stronger.BcryptCost++
+	if _, rehash, _ := stronger.Verify(hash, "correct horse"); !rehash {
+		t.Errorf("Expected a rehash after a cost change")
+	}
+	argon := fastHasher(Argon2id)
+	hash, _ = argon.Hash("correct horse")
+	argon.Argon2.Iterations++
+	if _, rehash, _ := argon.Verify(hash, "correct horse"); !rehash {
+		t.Errorf("Expected a rehash after an argon2 parameter change")
+	}
+}
+
+func writeBreachedFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+	var lines []string
+	for i, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	// Des hashs voisins pour que la recherche traverse le fichier
+	for i := 0; i < 500; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprintf("filler-%d", i)))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":1")
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPolicy(t *testing.T) {
+	list, err := OpenBreachedList(writeBreachedFile(t, "password123", "letmein!!", "filler-0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	p := DefaultPolicy()
+	p.Breached = list
+
+	cases := []struct {
+		password, username string
+		want               error
+	}{
+		{"", "alice", ErrTooShort},
+		{"short", "alice", ErrTooShort},
+		{strings.Repeat("x", 129), "alice", ErrTooLong},
+		{"xxAlice2024", "alice", ErrContainsUsername},
+		{"password123", "alice", ErrBreached},
+		{"letmein!!", "alice", ErrBreached},
+		{"filler-0", "alice", ErrBreached},
+		{"filler-499", "alice", ErrBreached},
+		{"a perfectly fine passphrase", "alice", nil},
+		{"bobbybobby", "bo", nil},
+	}
+	for _, c := range cases {
+		err := p.Validate(c.password, c.username)
+		if !errors.Is(err, c.want) || (c.want != nil) != IsPolicyError(err) {
+			t.Errorf("Validate(%q, %q) = %v, want %v", c.password, c.username, err, c.want)
+		}
+	}
+}
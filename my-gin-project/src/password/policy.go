@@ -0,0 +1,205 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"my-gin-project/src/config"
+)
+
+// Erreurs de politique ; les messages sont destinés à l'utilisateur
+var (
+	ErrTooShort         = errors.New("password is too short")
+	ErrTooLong          = errors.New("password is too long")
+	ErrBreached         = errors.New("password appears in a list of breached passwords")
+	ErrContainsUsername = errors.New("password must not contain the username")
+)
+
+// IsPolicyError indique si err est un refus de la politique (et non une erreur technique)
+func IsPolicyError(err error) bool {
+	for _, e := range []error{ErrTooShort, ErrTooLong, ErrBreached, ErrContainsUsername} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy est la politique appliquée aux nouveaux mots de passe
+type Policy struct {
+	MinLength int // en caractères
+	MaxLength int
+	// Breached, si renseigné, est la liste locale des mots de passe compromis
+	Breached *BreachedList
+}
+
+// DefaultPolicy exige au moins 8 caractères, sans liste de mots de passe compromis
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8, MaxLength: 128}
+}
+
+// PolicyFromEnv lit PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH et PASSWORD_BREACHED_FILE
+func PolicyFromEnv() (*Policy, error) {
+	p := DefaultPolicy()
+	p.MinLength = config.Int("PASSWORD_MIN_LENGTH", p.MinLength)
+	p.MaxLength = config.Int("PASSWORD_MAX_LENGTH", p.MaxLength)
+	if p.MinLength < 1 || p.MaxLength < p.MinLength {
+		return nil, fmt.Errorf("invalid password length bounds %d-%d", p.MinLength, p.MaxLength)
+	}
+	if path := config.String("PASSWORD_BREACHED_FILE", ""); path != "" {
+		list, err := OpenBreachedList(path)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = list
+	}
+	return p, nil
+}
+
+// Validate vérifie password, choisi par l'utilisateur username
+func (p *Policy) Validate(password, username string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("%w (minimum %d characters)", ErrTooShort, p.MinLength)
+	}
+	if n > p.MaxLength {
+		return fmt.Errorf("%w (maximum %d characters)", ErrTooLong, p.MaxLength)
+	}
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrContainsUsername
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrBreached
+		}
+	}
+	return nil
+}
+
+// BreachedList recherche un mot de passe dans un fichier local de hashs SHA-1 de mots de passe
+// compromis, au format des téléchargements de Have I Been Pwned : une ligne "HASH:COMPTEUR"
+// par mot de passe, triée par hash. Le fichier n'est pas chargé en mémoire : la recherche est
+// dichotomique, comme l'API k-anonymity, par préfixe de 5 caractères puis dans la plage obtenue.
+type BreachedList struct {
+	f    *os.File
+	size int64
+}
+
+// OpenBreachedList ouvre le fichier path
+func OpenBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &BreachedList{f: f, size: info.Size()}, nil
+}
+
+// Close ferme le fichier
+func (l *BreachedList) Close() error {
+	return l.f.Close()
+}
+
+// Contains indique si password figure dans la liste
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	lines, err := l.rangeOf(hash[:5])
+	if err != nil {
+		return false, err
+	}
+	for _, line := range lines {
+		h, _, _ := bytes.Cut(line, []byte(":"))
+		if bytes.EqualFold(bytes.TrimSpace(h), hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rangeOf renvoie les lignes dont le hash commence par prefix
+func (l *BreachedList) rangeOf(prefix []byte) ([][]byte, error) {
+	// Recherche dichotomique de la première ligne >= prefix
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := (lo + hi) / 2
+		start, line, err := l.lineAfter(mid)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil || bytes.Compare(bytes.ToUpper(line[:min(len(line), len(prefix))]), prefix) >= 0 {
+			hi = mid
+		} else {
+			lo = min(start+int64(len(line))+1, l.size)
+		}
+	}
+
+	start, _, err := l.lineAfter(lo)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(l.f, start, l.size-start))
+	var lines [][]byte
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) >= len(prefix) && bytes.Equal(bytes.ToUpper(line[:len(prefix)]), prefix) {
+			lines = append(lines, line)
+		} else if len(line) > 0 {
+			break
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// lineAfter renvoie la première ligne complète commençant à off ou après, et sa position (nil en fin de fichier)
+func (l *BreachedList) lineAfter(off int64) (int64, []byte, error) {
+	start := off
+	if off > 0 {
+		// off peut tomber au milieu d'une ligne : on repart du caractère précédent
+		// et on saute jusqu'au prochain saut de ligne
+		start--
+	}
+	r := bufio.NewReader(io.NewSectionReader(l.f, start, l.size-start))
+	if off > 0 {
+		skipped, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return l.size, nil, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if len(line) == 0 {
+		return l.size, nil, nil
+	}
+	return start, bytes.TrimRight(line, "\n"), nil
+}
@@ -0,0 +1,276 @@
+// Package prompts gère les prompts système de l'assistant IA : un modèle text/template par persona,
+// fourni par des fichiers (intégrés au binaire ou lus dans PROMPT_TEMPLATES_DIR, version 0)
+// puis versionné en base par les administrateurs.
+package prompts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+//go:embed templates/*.tmpl
+var builtinFS embed.FS
+
+// DefaultPersona est la persona utilisée quand la requête n'en choisit pas
+const DefaultPersona = "travel"
+
+var ErrUnknownPersona = errors.New("unknown persona")
+
+var personaRe = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// ValidPersona indique si name peut nommer une persona
+func ValidPersona(name string) bool {
+	return personaRe.MatchString(name)
+}
+
+// Data sont les variables disponibles dans les modèles
+type Data struct {
+	Username string
+	// Name est le nom d'affichage du profil, ou à défaut le nom d'utilisateur
+	Name    string
+	Profile models.UserProfile
+	// Preferences décrit les préférences renseignées du profil ("" si aucune)
+	Preferences string
+	Date        time.Time
+	// Language est la langue du profil, "fr" par défaut
+	Language string
+}
+
+// NewData prépare les variables d'un utilisateur ; preferences est la description de son profil
+func NewData(username string, profile models.UserProfile, preferences string, now time.Time) Data {
+	data := Data{Username: username, Name: profile.DisplayName, Profile: profile, Preferences: preferences, Date: now, Language: profile.Language}
+	if data.Name == "" {
+		data.Name = username
+	}
+	if data.Language == "" {
+		data.Language = "fr"
+	}
+	return data
+}
+
+// AnonymousData sont les variables d'un visiteur non authentifié, sans nom ni profil
+func AnonymousData(now time.Time) Data {
+	data := NewData("", models.UserProfile{}, "", now)
+	data.Name = "l'utilisateur"
+	return data
+}
+
+// SampleData sert à valider et prévisualiser un modèle sans utilisateur réel
+func SampleData() Data {
+	budget := 1500.0
+	profile := models.UserProfile{
+		DisplayName: "Camille", HomeCity: "Lyon", HomeAirport: "LYS", Currency: "EUR", Language: "fr",
+		DietaryNeeds: []string{"végétarien"}, AccessibilityNeeds: []string{}, TravelStyle: "comfort", BudgetMax: &budget,
+	}
+	return NewData("camille", profile, "Préférences de voyage de l'utilisateur :\n- Ville de départ : Lyon (aéroport LYS)", time.Now())
+}
+
+// Template est une version du prompt d'une persona ; la version 0 est celle des fichiers
+type Template struct {
+	Persona     string `json:"persona" example:"travel"`
+	Version     int    `json:"version" example:"3"`
+	Description string `json:"description" example:"Assistant de voyage généraliste"`
+	Body        string `json:"body"`
+}
+
+var funcs = template.FuncMap{"join": strings.Join}
+
+// Parse vérifie la syntaxe de body
+func Parse(body string) (*template.Template, error) {
+	return template.New("prompt").Funcs(funcs).Option("missingkey=error").Parse(body)
+}
+
+// Render exécute le modèle avec data
+func (t Template) Render(data Data) (string, error) {
+	tmpl, err := Parse(t.Body)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Validate vérifie que body se compile et s'exécute avec des données d'exemple
+func Validate(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("template is empty")
+	}
+	_, err := Template{Body: body}.Render(SampleData())
+	return err
+}
+
+// Library donne accès aux modèles des fichiers et aux versions enregistrées en base
+type Library struct {
+	files map[string]Template
+}
+
+// NewLibrary charge les modèles intégrés, puis ceux de dir (*.tmpl, qui remplacent les modèles intégrés de même nom)
+func NewLibrary(dir string) (*Library, error) {
+	l := &Library{files: map[string]Template{}}
+	sub, _ := fs.Sub(builtinFS, "templates")
+	if err := l.load(sub); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := l.load(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// FromEnv charge la bibliothèque avec les fichiers de PROMPT_TEMPLATES_DIR
+func FromEnv() (*Library, error) {
+	return NewLibrary(config.String("PROMPT_TEMPLATES_DIR", ""))
+}
+
+// Default ne contient que les modèles intégrés
+func Default() *Library {
+	l, err := NewLibrary("")
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+func (l *Library) load(fsys fs.FS) error {
+	names, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		persona := strings.TrimSuffix(path.Base(name), ".tmpl")
+		if !ValidPersona(persona) {
+			return fmt.Errorf("invalid persona name %q", name)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := Validate(string(data)); err != nil {
+			return fmt.Errorf("prompt template %s: %w", name, err)
+		}
+		l.files[persona] = Template{Persona: persona, Body: string(data), Description: description(string(data))}
+	}
+	return nil
+}
+
+// description reprend le commentaire {{/* ... */}} placé en tête du fichier
+func description(body string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(body), "{{/*")
+	if !ok {
+		return ""
+	}
+	desc, _, _ := strings.Cut(rest, "*/")
+	return strings.TrimSpace(desc)
+}
+
+// Active renvoie la version utilisée de persona : la plus récente en base, sinon celle des fichiers
+func (l *Library) Active(db *gorm.DB, persona string) (Template, error) {
+	var row models.PromptTemplate
+	err := db.Where("persona = ?", persona).Order("version desc").Limit(1).Find(&row).Error
+	if err != nil {
+		return Template{}, err
+	}
+	if row.ID != 0 {
+		return fromModel(row), nil
+	}
+	if t, ok := l.files[persona]; ok {
+		return t, nil
+	}
+	return Template{}, ErrUnknownPersona
+}
+
+// Version renvoie une version précise de persona
+func (l *Library) Version(db *gorm.DB, persona string, version int) (Template, error) {
+	if version == 0 {
+		if t, ok := l.files[persona]; ok {
+			return t, nil
+		}
+		return Template{}, ErrUnknownPersona
+	}
+	var row models.PromptTemplate
+	if err := db.Where("persona = ? AND version = ?", persona, version).Limit(1).Find(&row).Error; err != nil {
+		return Template{}, err
+	}
+	if row.ID == 0 {
+		return Template{}, ErrUnknownPersona
+	}
+	return fromModel(row), nil
+}
+
+// Versions renvoie toutes les versions de persona, la plus récente en premier
+func (l *Library) Versions(db *gorm.DB, persona string) ([]Template, error) {
+	var rows []models.PromptTemplate
+	if err := db.Where("persona = ?", persona).Order("version desc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]Template, 0, len(rows)+1)
+	for _, row := range rows {
+		versions = append(versions, fromModel(row))
+	}
+	if t, ok := l.files[persona]; ok {
+		versions = append(versions, t)
+	}
+	if len(versions) == 0 {
+		return nil, ErrUnknownPersona
+	}
+	return versions, nil
+}
+
+// Personas renvoie la version active de chaque persona, par nom
+func (l *Library) Personas(db *gorm.DB) ([]Template, error) {
+	var names []string
+	if err := db.Model(&models.PromptTemplate{}).Distinct().Pluck("persona", &names).Error; err != nil {
+		return nil, err
+	}
+	for name := range l.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var personas []Template
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		t, err := l.Active(db, name)
+		if err != nil {
+			return nil, err
+		}
+		personas = append(personas, t)
+	}
+	return personas, nil
+}
+
+// Save enregistre une nouvelle version de persona, qui devient la version active
+func (l *Library) Save(tx *gorm.DB, row *models.PromptTemplate) error {
+	var last int
+	if err := tx.Model(&models.PromptTemplate{}).Where("persona = ?", row.Persona).
+		Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	row.Version = last + 1
+	return tx.Create(row).Error
+}
+
+func fromModel(row models.PromptTemplate) Template {
+	return Template{Persona: row.Persona, Version: row.Version, Description: row.Description, Body: row.Body}
+}
@@ -0,0 +1,78 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	l := Default()
+	for _, persona := range []string{"travel", "concierge", "backpacker"} {
+		tmpl, ok := l.files[persona]
+		if !ok || tmpl.Description == "" {
+			t.Fatalf("Expected a described builtin template for %s", persona)
+		}
+		prompt, err := tmpl.Render(NewData("alice", models.UserProfile{}, "", time.Date(2026, 7, 14, 0, 0, 0, 0, time.UTC)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(prompt, "alice") || !strings.Contains(prompt, "14/07/2026") || !strings.Contains(prompt, "code fr") {
+			t.Errorf("%s: unexpected prompt:\n%s", persona, prompt)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, body := range []string{"", "{{.Nope}}", "{{if .Name}}"} {
+		if err := Validate(body); err == nil {
+			t.Errorf("Expected %q to be refused", body)
+		}
+	}
+	if err := Validate(`Bonjour {{.Name}} {{join .Profile.DietaryNeeds ", "}}`); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLibraryVersions(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.PromptTemplate{})
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "travel.tmpl"), []byte("{{/* Fichier */}}Depuis un fichier, {{.Name}}"), 0o600)
+	l, err := NewLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := l.Active(db, "travel"); active.Version != 0 || active.Description != "Fichier" {
+		t.Errorf("Expected the file to override the builtin template, got %+v", active)
+	}
+
+	for _, body := range []string{"v1 {{.Name}}", "v2 {{.Name}}"} {
+		if err := l.Save(db, &models.PromptTemplate{Persona: "travel", Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	active, _ := l.Active(db, "travel")
+	if active.Version != 2 || active.Body != "v2 {{.Name}}" {
+		t.Errorf("Expected the latest version to be active, got %+v", active)
+	}
+	versions, _ := l.Versions(db, "travel")
+	if len(versions) != 3 || versions[0].Version != 2 || versions[2].Version != 0 {
+		t.Errorf("Unexpected versions: %+v", versions)
+	}
+	if _, err := l.Active(db, "pirate"); err != ErrUnknownPersona {
+		t.Errorf("Expected ErrUnknownPersona, got %v", err)
+	}
+	personas, _ := l.Personas(db)
+	if len(personas) != 3 || personas[0].Persona != "backpacker" {
+		t.Errorf("Unexpected personas: %+v", personas)
+	}
+}
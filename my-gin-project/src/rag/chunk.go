@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Split découpe text en extraits d'au plus size caractères, en suivant les paragraphes.
+// En Markdown, chaque titre commence un nouvel extrait. Un extrait coupé faute de place
+// reprend la fin du précédent (au plus overlap caractères) pour ne pas perdre le contexte.
+func Split(text, format string, size, overlap int) []string {
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\f", "\n\n").Replace(text)
+	markdown := format != "text"
+
+	var chunks []string
+	var current []string
+	length := 0
+	flush := func(withOverlap bool) {
+		if len(current) == 0 {
+			return
+		}
+		chunk := strings.Join(current, "\n\n")
+		chunks = append(chunks, chunk)
+		current, length = nil, 0
+		if withOverlap && overlap > 0 {
+			if prev := tail(chunk, overlap); prev != "" {
+				current, length = []string{prev}, runeLen(prev)+2
+			}
+		}
+	}
+
+	for _, para := range paragraphs(text) {
+		if markdown && strings.HasPrefix(para, "#") {
+			flush(false)
+		}
+		for _, piece := range pieces(para, size) {
+			n := runeLen(piece)
+			if length > 0 && length+n > size {
+				flush(true)
+				// La reprise du contexte ne doit pas faire dépasser la taille
+				if length+n > size {
+					current, length = nil, 0
+				}
+			}
+			current = append(current, piece)
+			length += n + 2
+		}
+	}
+	flush(false)
+	return chunks
+}
+
+func paragraphs(text string) []string {
+	var out []string
+	for _, block := range strings.Split(text, "\n\n") {
+		if block = strings.TrimSpace(block); block != "" {
+			out = append(out, block)
+		}
+	}
+	return out
+}
+
+// pieces coupe un paragraphe trop long entre deux mots
+func pieces(para string, size int) []string {
+	var out []string
+	for runeLen(para) > size {
+		runes := []rune(para)
+		cut := size
+		for i := size; i > size/2; i-- {
+			if unicode.IsSpace(runes[i]) {
+				cut = i
+				break
+			}
+		}
+		out = append(out, strings.TrimSpace(string(runes[:cut])))
+		para = strings.TrimSpace(string(runes[cut:]))
+	}
+	if para != "" {
+		out = append(out, para)
+	}
+	return out
+}
+
+// tail renvoie la fin de s (au plus n caractères), en commençant sur un mot entier
+func tail(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return ""
+	}
+	rest := runes[len(runes)-n:]
+	if i := strings.IndexFunc(string(rest), unicode.IsSpace); i >= 0 {
+		return strings.TrimSpace(string(rest)[i:])
+	}
+	return ""
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
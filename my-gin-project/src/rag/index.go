@@ -0,0 +1,141 @@
+package rag
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// index garde en mémoire les vecteurs normalisés des extraits, comparés par force brute.
+// Avant chaque recherche, il compare la version de la table document_chunks à celle qu'il a chargée
+// et se recharge si elle a changé : les modifications ne sont vues qu'une fois validées, y compris
+// celles faites par une autre instance de l'API.
+type index struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	loaded  bool
+	version version
+	entries []entry
+}
+
+// version résume le contenu de document_chunks. Les extraits ne sont jamais modifiés, seulement
+// ajoutés ou supprimés : un ajout augmente l'identifiant maximal, une suppression réduit le nombre.
+type version struct {
+	Count int64
+	MaxID uint
+}
+
+type entry struct {
+	chunkID uint
+	model   string
+	vector  []float32
+}
+
+var (
+	indexesMu sync.Mutex
+	indexes   = map[*gorm.DB]*index{}
+)
+
+// indexFor renvoie l'index partagé de la connexion db
+func indexFor(db *gorm.DB) *index {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	if idx, ok := indexes[db]; ok {
+		return idx
+	}
+	idx := &index{db: db}
+	indexes[db] = idx
+	return idx
+}
+
+// load recharge les extraits si la table a changé depuis le dernier chargement. La version est lue
+// avant les extraits : une modification validée entre les deux sera rechargée à la recherche suivante.
+func (idx *index) load() error {
+	var current version
+	if err := idx.db.Model(&models.DocumentChunk{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(id), 0) AS max_id").Scan(&current).Error; err != nil {
+		return err
+	}
+	if idx.loaded && current == idx.version {
+		return nil
+	}
+	var entries []entry
+	var chunks []models.DocumentChunk
+	err := idx.db.Select("id", "model", "embedding").FindInBatches(&chunks, 500, func(tx *gorm.DB, batch int) error {
+		for _, c := range chunks {
+			entries = append(entries, entry{chunkID: c.ID, model: c.Model, vector: normalize(c.Embedding)})
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	idx.entries, idx.version, idx.loaded = entries, current, true
+	return nil
+}
+
+// empty indique qu'aucun extrait n'est indexé : inutile alors de calculer l'embedding de la requête
+func (idx *index) empty() (bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.load(); err != nil {
+		return false, err
+	}
+	return len(idx.entries) == 0, nil
+}
+
+type scored struct {
+	chunkID uint
+	score   float64
+}
+
+// search renvoie les k extraits du modèle model les plus proches de query (similarité cosinus)
+func (idx *index) search(model string, query []float32, k int, minScore float64) ([]scored, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+
+	query = normalize(query)
+	var results []scored
+	for _, e := range idx.entries {
+		if e.model != model || len(e.vector) != len(query) {
+			continue
+		}
+		var dot float64
+		for i, x := range e.vector {
+			dot += float64(x) * float64(query[i])
+		}
+		if dot >= minScore {
+			results = append(results, scored{e.chunkID, dot})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+// Package rag fournit à l'assistant IA les extraits pertinents de nos guides et FAQ
+// (retrieval-augmented generation) : les documents sont découpés en extraits, dont les
+// embeddings sont calculés par le modèle configuré et stockés en base ; un index en
+// mémoire retrouve les extraits les plus proches de chaque question.
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Nombre de textes envoyés par appel au modèle d'embeddings
+const embedBatch = 32
+
+var ErrEmptyDocument = errors.New("document has no text")
+
+// Hit est un extrait retrouvé pour une question
+type Hit struct {
+	ChunkID    uint    `json:"chunk_id" example:"42"`
+	DocumentID uint    `json:"document_id" example:"3"`
+	Title      string  `json:"title" example:"Guide d'Annecy"`
+	Source     string  `json:"source" example:"guides/annecy.md"`
+	Position   int     `json:"position" example:"2"`
+	Content    string  `json:"content"`
+	Score      float64 `json:"score" example:"0.82"`
+}
+
+// Store indexe les documents et retrouve leurs extraits
+type Store struct {
+	db       *gorm.DB
+	embedder llm.Embedder
+
+	// Taille des extraits et reprise entre deux extraits, en caractères
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+// New crée un Store sur db ; la taille des extraits est lue dans RAG_CHUNK_SIZE et RAG_CHUNK_OVERLAP
+func New(db *gorm.DB, embedder llm.Embedder) *Store {
+	return &Store{
+		db:           db,
+		embedder:     embedder,
+		ChunkSize:    config.Int("RAG_CHUNK_SIZE", 1000),
+		ChunkOverlap: config.Int("RAG_CHUNK_OVERLAP", 150),
+	}
+}
+
+// Checksum identifie le contenu d'un document
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prepare découpe doc et calcule les embeddings de ses extraits, sans rien enregistrer :
+// les appels au modèle se font hors transaction. Renseigne Checksum, Chunks et EmbeddingModel.
+func (s *Store) Prepare(ctx context.Context, doc *models.Document) ([]models.DocumentChunk, error) {
+	texts := Split(doc.Content, doc.Format, s.ChunkSize, s.ChunkOverlap)
+	if len(texts) == 0 {
+		return nil, ErrEmptyDocument
+	}
+
+	chunks := make([]models.DocumentChunk, 0, len(texts))
+	var model string
+	for start := 0; start < len(texts); start += embedBatch {
+		batch := texts[start:min(start+embedBatch, len(texts))]
+		// Le titre accompagne chaque extrait pour situer les passages qui ne le répètent pas
+		inputs := make([]string, len(batch))
+		for i, text := range batch {
+			inputs[i] = doc.Title + "\n\n" + text
+		}
+		out, err := s.embedder.Embed(ctx, inputs)
+		if err != nil {
+			return nil, fmt.Errorf("embeddings: %w", err)
+		}
+		if len(out.Vectors) != len(batch) {
+			return nil, fmt.Errorf("embeddings: %d vectors for %d texts", len(out.Vectors), len(batch))
+		}
+		model = out.Model
+		for i, text := range batch {
+			chunks = append(chunks, models.DocumentChunk{
+				Position:  start + i,
+				Content:   text,
+				Model:     out.Model,
+				Embedding: out.Vectors[i],
+			})
+		}
+	}
+	doc.Checksum = Checksum(doc.Content)
+	doc.Chunks = len(chunks)
+	doc.EmbeddingModel = model
+	return chunks, nil
+}
+
+// Save enregistre doc et ses extraits préparés dans la transaction tx
+func Save(tx *gorm.DB, doc *models.Document, chunks []models.DocumentChunk) error {
+	if err := tx.Create(doc).Error; err != nil {
+		return err
+	}
+	for i := range chunks {
+		chunks[i].DocumentID = doc.ID
+	}
+	return tx.CreateInBatches(&chunks, 100).Error
+}
+
+// Delete supprime doc et ses extraits dans la transaction tx
+func Delete(tx *gorm.DB, doc *models.Document) error {
+	if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentChunk{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(doc).Error
+}
+
+// Retrieve renvoie les k extraits les plus proches de query dont la similarité atteint minScore
+func (s *Store) Retrieve(ctx context.Context, query string, k int, minScore float64) ([]Hit, error) {
+	idx := indexFor(s.db)
+	if empty, err := idx.empty(); err != nil || empty {
+		return nil, err
+	}
+
+	out, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if len(out.Vectors) != 1 {
+		return nil, errors.New("embeddings: no vector for the query")
+	}
+	results, err := idx.search(out.Model, out.Vectors[0], k, minScore)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, len(results))
+	for i, r := range results {
+		ids[i] = r.chunkID
+	}
+	var rows []struct {
+		models.DocumentChunk
+		Title  string
+		Source string
+	}
+	err = s.db.Model(&models.DocumentChunk{}).
+		Select("document_chunks.id, document_chunks.document_id, document_chunks.position, document_chunks.content, documents.title, documents.source").
+		Joins("JOIN documents ON documents.id = document_chunks.document_id").
+		Where("document_chunks.id IN ?", ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	byID := map[uint]Hit{}
+	for _, row := range rows {
+		byID[row.ID] = Hit{
+			ChunkID: row.ID, DocumentID: row.DocumentID, Title: row.Title, Source: row.Source,
+			Position: row.Position, Content: row.Content,
+		}
+	}
+	hits := make([]Hit, 0, len(results))
+	for _, r := range results {
+		// Un extrait supprimé entre-temps est ignoré
+		if hit, ok := byID[r.chunkID]; ok {
+			hit.Score = math.Round(r.score*1000) / 1000
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// Prompt présente les extraits au modèle, numérotés à partir de 1 pour qu'il cite ses sources
+func Prompt(hits []Hit) string {
+	var b strings.Builder
+	b.WriteString("Extraits des guides et de la FAQ de Travel API. Appuie-toi dessus en priorité, ")
+	b.WriteString("cite les extraits utilisés par leur numéro entre crochets, par exemple [1], ")
+	b.WriteString("et ignore ceux qui ne répondent pas à la question.")
+	for i, hit := range hits {
+		fmt.Fprintf(&b, "\n\n[%d] %s", i+1, hit.Title)
+		if hit.Source != "" {
+			fmt.Fprintf(&b, " (%s)", hit.Source)
+		}
+		b.WriteString("\n" + hit.Content)
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"my-gin-project/src/llm"
+	"my-gin-project/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// keywordEmbedder compte quelques mots-clés : des textes sur le même sujet ont des vecteurs proches
+type keywordEmbedder struct {
+	calls int
+}
+
+var keywords = []string{"annecy", "lac", "vélo", "paris", "musée", "bagage"}
+
+func (e *keywordEmbedder) Embed(ctx context.Context, inputs []string) (llm.Embeddings, error) {
+	e.calls++
+	out := llm.Embeddings{Model: "keywords"}
+	for _, input := range inputs {
+		v := make([]float32, len(keywords))
+		for i, k := range keywords {
+			v[i] = float32(strings.Count(strings.ToLower(input), k))
+		}
+		out.Vectors = append(out.Vectors, v)
+	}
+	return out, nil
+}
+
+func TestSplit(t *testing.T) {
+	text := "# Annecy\n\nLe lac est superbe.\n\nLe vieux centre est piéton.\n\n## Activités\n\nTour du lac à vélo."
+	chunks := Split(text, models.DocumentFormatMarkdown, 1000, 0)
+	if len(chunks) != 2 || !strings.HasPrefix(chunks[1], "## Activités") {
+		t.Fatalf("Expected a chunk per section, got %q", chunks)
+	}
+	if got := Split(text, models.DocumentFormatText, 1000, 0); len(got) != 1 {
+		t.Errorf("Expected headings to be ignored in plain text, got %q", got)
+	}
+
+	long := strings.Repeat("Le tour du lac d'Annecy se fait à vélo en une journée. ", 40)
+	chunks = Split(long+"\n\nFin du guide.", models.DocumentFormatText, 300, 60)
+	for i, chunk := range chunks {
+		if n := len([]rune(chunk)); n > 300 {
+			t.Errorf("Chunk %d has %d characters", i, n)
+		}
+	}
+	if len(chunks) < 8 || !strings.HasSuffix(chunks[len(chunks)-1], "Fin du guide.") {
+		t.Errorf("Unexpected chunks: %q", chunks)
+	}
+	// La reprise commence par la fin de l'extrait précédent
+	if prev := chunks[0]; !strings.Contains(prev[len(prev)-80:], chunks[1][:20]) {
+		t.Errorf("Expected chunk 1 to start with the end of chunk 0:\n%q\n%q", prev, chunks[1])
+	}
+}
+
+func TestVectorRoundTrip(t *testing.T) {
+	v := models.Vector{0.5, -1.25, 3}
+	data, _ := v.Value()
+	var out models.Vector
+	if err := out.Scan(data); err != nil || len(out) != 3 || out[1] != -1.25 {
+		t.Errorf("Unexpected vector: %v %v", out, err)
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	models.Migrate(db)
+	embedder := &keywordEmbedder{}
+	store := New(db, embedder)
+
+	// Sans document, la question n'est pas envoyée au modèle d'embeddings
+	if hits, err := store.Retrieve(context.Background(), "annecy", 3, 0.5); err != nil || len(hits) != 0 || embedder.calls != 0 {
+		t.Fatalf("Expected no hits and no embedding call, got %v %v (%d calls)", hits, err, embedder.calls)
+	}
+
+	for _, doc := range []models.Document{
+		{Title: "Guide d'Annecy", Source: "guides/annecy.md", Format: models.DocumentFormatMarkdown,
+			Content: "# Le lac\n\nLe lac d'Annecy se découvre à vélo.\n\n# Musées\n\nLe musée-château domine la ville."},
+		{Title: "FAQ bagages", Source: "faq.md", Format: models.DocumentFormatText, Content: "Un bagage cabine est inclus."},
+	} {
+		chunks, err := store.Prepare(context.Background(), &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Save(db, &doc, chunks); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, err := store.Retrieve(context.Background(), "Faire le tour du lac à vélo ?", 3, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Guide d'Annecy" || !strings.Contains(hits[0].Content, "vélo") || hits[0].Score < 0.5 {
+		t.Fatalf("Unexpected hits: %+v", hits)
+	}
+	if prompt := Prompt(hits); !strings.Contains(prompt, "[1] Guide d'Annecy (guides/annecy.md)") {
+		t.Errorf("Unexpected prompt: %s", prompt)
+	}
+
+	// Les extraits supprimés ne sont plus retrouvés
+	var doc models.Document
+	db.First(&doc, hits[0].DocumentID)
+	if err := Delete(db, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := store.Retrieve(context.Background(), "lac vélo", 3, 0.5); len(hits) != 0 {
+		t.Errorf("Expected no hits after deletion, got %+v", hits)
+	}
+}
+
+func TestRetrieveAcrossInstances(t *testing.T) {
+	// Deux instances de l'API partagent la base, chacune avec son propre index
+	path := t.TempDir() + "/rag.db"
+	db, _ := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	models.Migrate(db)
+	other, _ := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	store, otherStore := New(db, &keywordEmbedder{}), New(other, &keywordEmbedder{})
+	if hits, err := store.Retrieve(context.Background(), "Le lac d'Annecy", 3, 0.5); err != nil || len(hits) != 0 {
+		t.Fatalf("Expected no hits, got %v %v", hits, err)
+	}
+
+	doc := models.Document{Title: "Guide d'Annecy", Source: "annecy.md", Format: models.DocumentFormatText, Content: "Le lac d'Annecy."}
+	chunks, _ := otherStore.Prepare(context.Background(), &doc)
+	// Une transaction annulée ne laisse rien dans l'index
+	other.Transaction(func(tx *gorm.DB) error {
+		Save(tx, &doc, chunks)
+		return errors.New("rollback")
+	})
+	if hits, _ := store.Retrieve(context.Background(), "Le lac d'Annecy", 3, 0.5); len(hits) != 0 {
+		t.Fatalf("Expected no hits after a rollback, got %+v", hits)
+	}
+
+	doc.ID = 0
+	if err := Save(other, &doc, chunks); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := store.Retrieve(context.Background(), "Le lac d'Annecy", 3, 0.5); len(hits) != 1 {
+		t.Fatalf("Expected the other instance's document to be found, got %+v", hits)
+	}
+	if err := Delete(other, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := store.Retrieve(context.Background(), "Le lac d'Annecy", 3, 0.5); len(hits) != 0 {
+		t.Errorf("Expected no hits after the other instance's deletion, got %+v", hits)
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+
+	"my-gin-project/src/config"
+
+	"gorm.io/gorm"
+)
+
+// NewStoreFromEnv crée le store choisi par RATE_LIMIT_STORE : "memory" (par défaut)
+// ou "database" pour partager les limites entre instances
+func NewStoreFromEnv(db *gorm.DB) (Store, error) {
+	switch kind := config.String("RATE_LIMIT_STORE", "memory"); kind {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "database":
+		return NewGormStore(db)
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", kind)
+	}
+}
+
+// FromEnv renvoie la limite et la clé du groupe de routes name, lues dans
+// RATE_LIMIT_<NAME> (ex: "10/m") et RATE_LIMIT_<NAME>_KEY ("ip", "user" ou "api_key")
+func FromEnv(name string, def Limit, defKey string) (Limit, KeyFunc, error) {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(name)
+
+	limit := def
+	if v := config.String(prefix, ""); v != "" {
+		var err error
+		if limit, err = ParseLimit(v); err != nil {
+			return Limit{}, nil, err
+		}
+	}
+	key, err := KeyFuncByName(config.String(prefix+"_KEY", defKey))
+	if err != nil {
+		return Limit{}, nil, err
+	}
+	return limit, key, nil
+}
+
+// AnonymousFromEnv est FromEnv pour un groupe de routes appelées sans authentification : seule la clé
+// "ip" y distingue les clients, une autre clé est refusée plutôt que de retomber silencieusement sur l'IP
+func AnonymousFromEnv(name string, def Limit) (Limit, KeyFunc, error) {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(name)
+	if key := config.String(prefix+"_KEY", "ip"); key != "ip" {
+		return Limit{}, nil, fmt.Errorf("%s_KEY must be ip for unauthenticated routes, got %q", prefix, key)
+	}
+	return FromEnv(name, def, "ip")
+}
+
+// LockoutFromEnv crée le verrouillage des connexions, réglable par LOGIN_LOCKOUT_THRESHOLD,
+// LOGIN_LOCKOUT_BASE, LOGIN_LOCKOUT_MAX et LOGIN_LOCKOUT_WINDOW
+func LockoutFromEnv(store Store) *Lockout {
+	l := NewLockout(store)
+	l.Threshold = config.Int("LOGIN_LOCKOUT_THRESHOLD", l.Threshold)
+	l.Base = config.Duration("LOGIN_LOCKOUT_BASE", l.Base)
+	l.Max = config.Duration("LOGIN_LOCKOUT_MAX", l.Max)
+	l.Window = config.Duration("LOGIN_LOCKOUT_WINDOW", l.Window)
+	return l
+}
+
+// TrustedProxiesFromEnv renvoie les proxys (adresses ou plages CIDR, séparées par des virgules)
+// dont l'en-tête X-Forwarded-For est lu dans TRUSTED_PROXIES. Sans proxy (nil), seule l'adresse de
+// connexion identifie le client : un en-tête choisi par le client ne peut pas lui donner un autre seau.
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, p := range strings.Split(config.String("TRUSTED_PROXIES", ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
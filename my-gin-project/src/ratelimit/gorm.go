@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitEntry est l'état d'un seau ou d'un compteur partagé en base
+type RateLimitEntry struct {
+	BucketKey string `gorm:"primaryKey;size:191"`
+	Tokens    float64
+	Count     int
+	Last      time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// GormStore partage les seaux entre plusieurs instances de l'API via la base de données.
+// Chaque opération verrouille la ligne du seau (SELECT ... FOR UPDATE) le temps de la mise à jour.
+type GormStore struct {
+	db  *gorm.DB
+	ops atomic.Int64
+}
+
+// NewGormStore crée la table rate_limit_entries si besoin et renvoie le store
+func NewGormStore(db *gorm.DB) (*GormStore, error) {
+	if err := db.AutoMigrate(&RateLimitEntry{}); err != nil {
+		return nil, err
+	}
+	return &GormStore{db: db}, nil
+}
+
+// update charge l'entrée key verrouillée (en la créant si besoin), applique fn puis l'enregistre
+func (s *GormStore) update(key string, init RateLimitEntry, fn func(e *RateLimitEntry)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		init.BucketKey = key
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&init).Error; err != nil {
+			return err
+		}
+		var e RateLimitEntry
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).First(&e).Error; err != nil {
+			return err
+		}
+		fn(&e)
+		return tx.Save(&e).Error
+	})
+}
+
+// Take implémente Store
+func (s *GormStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	var res Result
+	err := s.update(key, RateLimitEntry{Tokens: float64(limit.Burst), Last: now}, func(e *RateLimitEntry) {
+		res = bucket(&e.Tokens, &e.Last, limit, now)
+		e.ExpiresAt = now.Add(res.Reset)
+	})
+	s.purge(now)
+	return res, err
+}
+
+// Incr implémente Store
+func (s *GormStore) Incr(key string, ttl time.Duration, now time.Time) (int, error) {
+	var count int
+	err := s.update(key, RateLimitEntry{Last: now, ExpiresAt: now.Add(ttl)}, func(e *RateLimitEntry) {
+		if now.After(e.ExpiresAt) {
+			e.Count = 0
+		}
+		e.Count++
+		e.Last = now
+		e.ExpiresAt = now.Add(ttl)
+		count = e.Count
+	})
+	return count, err
+}
+
+// Count implémente Store
+func (s *GormStore) Count(key string, ttl time.Duration, now time.Time) (int, time.Time, error) {
+	var e RateLimitEntry
+	err := s.db.Where("bucket_key = ?", key).Limit(1).Find(&e).Error
+	if err != nil || e.BucketKey == "" || now.After(e.Last.Add(ttl)) {
+		return 0, time.Time{}, err
+	}
+	return e.Count, e.Last, nil
+}
+
+// Reset implémente Store
+func (s *GormStore) Reset(key string) error {
+	return s.db.Where("bucket_key = ?", key).Delete(&RateLimitEntry{}).Error
+}
+
+// purge supprime de temps en temps les entrées expirées
+func (s *GormStore) purge(now time.Time) {
+	if s.ops.Add(1)%1000 != 0 {
+		return
+	}
+	s.db.Where("expires_at < ?", now).Delete(&RateLimitEntry{})
+}
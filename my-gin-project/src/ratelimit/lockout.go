@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Lockout verrouille un identifiant (nom d'utilisateur) après des échecs répétés.
+// Au-delà de Threshold échecs, chaque nouvel échec double la durée du verrouillage,
+// de Base jusqu'à Max. Les échecs sont oubliés après Window sans nouvelle tentative ratée.
+type Lockout struct {
+	Store     Store
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+	// Now renvoie l'heure courante (remplaçable dans les tests)
+	Now func() time.Time
+}
+
+// NewLockout crée un verrouillage avec les valeurs par défaut : 5 échecs tolérés,
+// puis 1 minute de verrouillage doublée à chaque échec, 1 heure au maximum
+func NewLockout(store Store) *Lockout {
+	return &Lockout{
+		Store:     store,
+		Threshold: 5,
+		Base:      time.Minute,
+		Max:       time.Hour,
+		Window:    24 * time.Hour,
+		Now:       time.Now,
+	}
+}
+
+func lockoutKey(id string) string {
+	return "lockout:" + id
+}
+
+// lockDuration renvoie la durée de verrouillage correspondant à un nombre d'échecs
+func (l *Lockout) lockDuration(failures int) time.Duration {
+	if failures < l.Threshold {
+		return 0
+	}
+	d := l.Base
+	for i := l.Threshold; i < failures && d < l.Max; i++ {
+		d *= 2
+	}
+	return min(d, l.Max)
+}
+
+// Locked renvoie le temps restant avant que id puisse de nouveau essayer (0 s'il n'est pas verrouillé)
+func (l *Lockout) Locked(id string) (time.Duration, error) {
+	now := l.Now()
+	failures, last, err := l.Store.Count(lockoutKey(id), l.Window, now)
+	if err != nil {
+		return 0, err
+	}
+	remaining := last.Add(l.lockDuration(failures)).Sub(now)
+	if remaining <= 0 {
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// Fail enregistre un échec et renvoie la durée de verrouillage qui en résulte
+func (l *Lockout) Fail(id string) (time.Duration, error) {
+	failures, err := l.Store.Incr(lockoutKey(id), l.Window, l.Now())
+	if err != nil {
+		return 0, err
+	}
+	return l.lockDuration(failures), nil
+}
+
+// Succeed remet à zéro les échecs de id
+func (l *Lockout) Succeed(id string) error {
+	return l.Store.Reset(lockoutKey(id))
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore conserve les seaux en mémoire ; adapté à une instance unique
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	ops     int
+}
+
+type memoryEntry struct {
+	tokens  float64
+	count   int
+	last    time.Time
+	expires time.Time
+}
+
+// NewMemoryStore crée un store en mémoire
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+// Take implémente Store
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memoryEntry{tokens: float64(limit.Burst), last: now}
+		s.entries[key] = e
+	}
+	res := bucket(&e.tokens, &e.last, limit, now)
+	e.expires = now.Add(res.Reset)
+	return res, nil
+}
+
+// Incr implémente Store
+func (s *MemoryStore) Incr(key string, ttl time.Duration, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok || now.After(e.expires) {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.count++
+	e.last = now
+	e.expires = now.Add(ttl)
+	return e.count, nil
+}
+
+// Count implémente Store
+func (s *MemoryStore) Count(key string, ttl time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || now.After(e.last.Add(ttl)) {
+		return 0, time.Time{}, nil
+	}
+	return e.count, e.last, nil
+}
+
+// Reset implémente Store
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep supprime périodiquement les entrées expirées pour borner la mémoire
+func (s *MemoryStore) sweep(now time.Time) {
+	s.ops++
+	if s.ops%1000 != 0 {
+		return
+	}
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
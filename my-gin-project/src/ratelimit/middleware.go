@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc renvoie la clé de limitation d'une requête
+type KeyFunc func(ctx *gin.Context) string
+
+// ByIP limite par adresse IP du client
+func ByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// ByUser limite par utilisateur authentifié (clé "username" du contexte), ou par IP à défaut
+func ByUser(ctx *gin.Context) string {
+	if username := ctx.GetString("username"); username != "" {
+		return "user:" + username
+	}
+	return ByIP(ctx)
+}
+
+// ByAPIKey limite par clé d'API (en-tête X-API-Key), ou par utilisateur à défaut
+func ByAPIKey(ctx *gin.Context) string {
+	if key := ctx.GetHeader("X-API-Key"); key != "" {
+		// Seul le préfixe de la clé sert d'identifiant, le secret n'est pas conservé
+		if len(key) > 16 {
+			key = key[:16]
+		}
+		return "apikey:" + key
+	}
+	return ByUser(ctx)
+}
+
+// KeyFuncByName renvoie la KeyFunc correspondant à "ip", "user" ou "api_key"
+func KeyFuncByName(name string) (KeyFunc, error) {
+	switch name {
+	case "ip":
+		return ByIP, nil
+	case "user":
+		return ByUser, nil
+	case "api_key":
+		return ByAPIKey, nil
+	}
+	return nil, fmt.Errorf("unknown rate limit key %q", name)
+}
+
+// Middleware limite le débit des requêtes d'un groupe de routes.
+// name distingue les seaux de groupes différents pour une même clé.
+// Les en-têtes RateLimit-Limit, RateLimit-Remaining et RateLimit-Reset sont ajoutés
+// à chaque réponse, et Retry-After aux réponses 429.
+func Middleware(store Store, name string, limit Limit, key KeyFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := store.Take("rl:"+name+":"+key(ctx), limit, time.Now())
+		if err != nil {
+			// En cas de panne du store, on laisse passer plutôt que de bloquer l'API
+			fmt.Println("[ERROR] Rate limit store:", err)
+			ctx.Next()
+			return
+		}
+
+		SetHeaders(ctx, res)
+		if !res.Allowed {
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// SetHeaders écrit les en-têtes RateLimit-* et, si la requête est refusée, Retry-After
+func SetHeaders(ctx *gin.Context, res Result) {
+	ctx.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		SetRetryAfter(ctx, res.RetryAfter)
+	}
+}
+
+// SetRetryAfter écrit l'en-tête Retry-After en secondes entières
+func SetRetryAfter(ctx *gin.Context, d time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(d))))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
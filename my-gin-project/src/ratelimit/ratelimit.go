@@ -0,0 +1,110 @@
+// Package ratelimit limite le débit des requêtes (token bucket) et verrouille
+// progressivement les comptes après des échecs de connexion répétés.
+//
+// L'état est conservé dans un Store : MemoryStore pour une instance unique,
+// GormStore pour partager les compteurs entre plusieurs instances via la base.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit décrit un seau de jetons : Burst requêtes d'affilée, rechargé de Rate jetons par seconde
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Per construit une limite de n requêtes par période, avec une rafale de n
+func Per(n int, period time.Duration) Limit {
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}
+}
+
+// ParseLimit lit une limite au format "n/période" : "10/m", "100/h", "5/30s".
+// Une rafale différente peut être précisée après une virgule : "10/m,20".
+func ParseLimit(s string) (Limit, error) {
+	spec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(s), ",")
+	count, periodSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+
+	var period time.Duration
+	switch p := strings.TrimSpace(periodSpec); p {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	case "d":
+		period = 24 * time.Hour
+	default:
+		if period, err = time.ParseDuration(p); err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit period %q", s)
+		}
+	}
+
+	limit := Per(n, period)
+	if hasBurst {
+		burst, err := strconv.Atoi(strings.TrimSpace(burstSpec))
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit burst %q", s)
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
+// Result est le résultat d'une tentative de consommation d'un jeton
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset est le délai avant que le seau soit de nouveau plein
+	Reset time.Duration
+	// RetryAfter est le délai avant le prochain jeton disponible (si Allowed est faux)
+	RetryAfter time.Duration
+}
+
+// Store conserve l'état des seaux et des compteurs
+type Store interface {
+	// Take consomme un jeton du seau key
+	Take(key string, limit Limit, now time.Time) (Result, error)
+	// Incr incrémente le compteur key, remis à zéro s'il n'a pas bougé depuis ttl, et renvoie sa valeur
+	Incr(key string, ttl time.Duration, now time.Time) (int, error)
+	// Count renvoie la valeur du compteur key et la date de sa dernière incrémentation
+	Count(key string, ttl time.Duration, now time.Time) (int, time.Time, error)
+	// Reset supprime le seau ou le compteur key
+	Reset(key string) error
+}
+
+// bucket applique l'algorithme du token bucket ; tokens et last sont mis à jour
+func bucket(tokens *float64, last *time.Time, limit Limit, now time.Time) Result {
+	if elapsed := now.Sub(*last).Seconds(); elapsed > 0 {
+		*tokens = min(float64(limit.Burst), *tokens+elapsed*limit.Rate)
+	}
+	*last = now
+
+	res := Result{Limit: limit.Burst}
+	if *tokens >= 1 {
+		*tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - *tokens) / limit.Rate)
+	}
+	res.Remaining = int(*tokens)
+	res.Reset = seconds((float64(limit.Burst) - *tokens) / limit.Rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("10/m,20")
+	if err != nil || l.Burst != 20 || l.Rate != 10.0/60 {
+		t.Errorf("Unexpected limit %+v (%v)", l, err)
+	}
+	if l, err = ParseLimit("5/30s"); err != nil || l.Burst != 5 || l.Rate != 5.0/30 {
+		t.Errorf("Unexpected limit %+v (%v)", l, err)
+	}
+	if _, err := ParseLimit("beaucoup"); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func testStores(t *testing.T) map[string]Store {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	gormStore, err := NewGormStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "gorm": gormStore}
+}
+
+func TestTokenBucket(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			limit := Per(2, time.Second)
+
+			for i := 0; i < 2; i++ {
+				if res, _ := store.Take("k", limit, now); !res.Allowed {
+					t.Fatalf("Request %d should be allowed", i)
+				}
+			}
+			res, _ := store.Take("k", limit, now)
+			if res.Allowed || res.Remaining != 0 || res.RetryAfter != 500*time.Millisecond {
+				t.Errorf("Expected third request to be limited, got %+v", res)
+			}
+
+			// Un jeton est rechargé toutes les 500ms
+			res, _ = store.Take("k", limit, now.Add(500*time.Millisecond))
+			if !res.Allowed {
+				t.Errorf("Expected a refilled token, got %+v", res)
+			}
+
+			// Les clés sont indépendantes
+			if res, _ := store.Take("other", limit, now); !res.Allowed || res.Remaining != 1 {
+				t.Errorf("Unexpected result for another key: %+v", res)
+			}
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			l := NewLockout(store)
+			l.Threshold = 3
+			l.Now = func() time.Time { return now }
+
+			for i := 0; i < 2; i++ {
+				if d, _ := l.Fail("bob"); d != 0 {
+					t.Fatalf("Unexpected lock after %d failures", i+1)
+				}
+			}
+			if d, _ := l.Fail("bob"); d != time.Minute {
+				t.Errorf("Expected 1 minute lock, got %v", d)
+			}
+			if d, _ := l.Locked("bob"); d != time.Minute {
+				t.Errorf("Expected bob to be locked, got %v", d)
+			}
+
+			// Chaque nouvel échec double le verrouillage
+			now = now.Add(time.Minute)
+			if d, _ := l.Locked("bob"); d != 0 {
+				t.Errorf("Expected lock to be over, got %v", d)
+			}
+			if d, _ := l.Fail("bob"); d != 2*time.Minute {
+				t.Errorf("Expected 2 minutes lock, got %v", d)
+			}
+
+			l.Succeed("bob")
+			if d, _ := l.Locked("bob"); d != 0 {
+				t.Errorf("Expected no lock after success, got %v", d)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Middleware(NewMemoryStore(), "test", Per(1, time.Minute), ByIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusOK || resp.Header().Get("RateLimit-Limit") != "1" || resp.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected first response: %d %v", resp.Code, resp.Header())
+	}
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") != "60" {
+		t.Errorf("Unexpected second response: %d %v", resp.Code, resp.Header())
+	}
+}
+
+func TestAnonymousFromEnv(t *testing.T) {
+	if _, _, err := AnonymousFromEnv("auth", Per(10, time.Minute)); err != nil {
+		t.Errorf("Expected the ip key by default, got %v", err)
+	}
+	// Sans authentification, les clés user et api_key retomberaient sur l'IP : elles sont refusées
+	for _, key := range []string{"user", "api_key"} {
+		t.Setenv("RATE_LIMIT_AUTH_KEY", key)
+		if _, _, err := AnonymousFromEnv("auth", Per(10, time.Minute)); err == nil {
+			t.Errorf("Expected RATE_LIMIT_AUTH_KEY=%s to be refused", key)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func() *gin.Engine {
+		r := gin.New()
+		if err := r.SetTrustedProxies(TrustedProxiesFromEnv()); err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/", Middleware(NewMemoryStore(), "test", Per(1, time.Minute), ByIP), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return r
+	}
+	send := func(r *gin.Engine, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Sans proxy de confiance, changer d'en-tête ne donne pas un nouveau seau
+	r := newRouter()
+	send(r, "203.0.113.1")
+	if code := send(r, "203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected X-Forwarded-For to be ignored, got %d", code)
+	}
+
+	// Derrière un proxy de confiance, chaque client a son seau
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.0/24, 10.0.0.1")
+	r = newRouter()
+	send(r, "203.0.113.1")
+	if code := send(r, "203.0.113.2"); code != http.StatusOK {
+		t.Errorf("Expected the client address from the trusted proxy, got %d", code)
+	}
+}
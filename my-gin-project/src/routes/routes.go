@@ -1,7 +1,12 @@
 package routes
 
 import (
+	"log"
+	"time"
+
 	"my-gin-project/src/controllers"
+	"my-gin-project/src/models"
+	"my-gin-project/src/ratelimit"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,24 +17,132 @@ import (
 )
 
 func SetupRoutes(router *gin.Engine, ctrl *controllers.Controller) {
+	router.Use(controllers.RequestID())
+
+	// Les limites sont placées après l'authentification, qui renseigne l'utilisateur ou la clé d'API servant de clé ;
+	// les routes de connexion sont anonymes et ne sont limitées que par IP
+	authLimit := anonymousRateLimit(ctrl, "auth", ratelimit.Per(10, time.Minute))
+	chatLimit := rateLimit(ctrl, "chat", ratelimit.Per(10, time.Minute), "ip")
+	apiLimit := rateLimit(ctrl, "api", ratelimit.Per(300, time.Minute), "api_key")
 
 	// Routes publiques
-	router.POST("/register", ctrl.Register)
-	router.POST("/login", ctrl.Login)
+	router.POST("/register", authLimit, ctrl.Register)
+	router.POST("/login", authLimit, ctrl.Login)
+	router.POST("/login/mfa", authLimit, ctrl.LoginMFA)
+	router.POST("/email/verify", authLimit, ctrl.VerifyEmail)
+	router.POST("/password/forgot", authLimit, ctrl.ForgotPassword)
+	router.POST("/password/reset", authLimit, ctrl.ResetPassword)
+	router.GET("/auth/providers", ctrl.GetSSOProviders)
+	router.GET("/auth/:provider/login", authLimit, ctrl.SSOLogin)
+	router.GET("/auth/:provider/callback", authLimit, ctrl.SSOCallback)
 
 	// Ajout des chatbot
-	router.POST("/chat", ctrl.Chat)
-	router.POST("/chat-ai", ctrl.ChatAI)
+	router.POST("/chat", chatLimit, ctrl.Chat)
+	router.POST("/chat-ai", controllers.OptionalAuth(), chatLimit, ctrl.ChatAI)
 
-	// Routes protégées
+	// Routes protégées (JWT ou clé d'API limitée par ses portées)
+	itemsRead := controllers.RequireScope(models.ScopeItemsRead)
+	itemsWrite := controllers.RequireScope(models.ScopeItemsWrite)
 	authorized := router.Group("/")
-	authorized.Use(controllers.AuthMiddleware())
+	authorized.Use(controllers.AuthMiddleware(), apiLimit)
+	{
+		authorized.GET("/items", itemsRead, ctrl.GetItems)
+		authorized.GET("/items/export", itemsRead, ctrl.ExportItems)
+		authorized.GET("/items/:id", itemsRead, ctrl.GetItemByID)
+		authorized.POST("/items", itemsWrite, ctrl.CreateItem)
+		authorized.POST("/items/bulk", itemsWrite, ctrl.BulkItems)
+		authorized.POST("/items/import", itemsWrite, ctrl.ImportItems)
+		authorized.PUT("/items/:id", itemsWrite, ctrl.UpdateItem)
+		authorized.PATCH("/items/:id", itemsWrite, ctrl.PatchItem)
+		authorized.DELETE("/items/:id", itemsWrite, ctrl.DeleteItem)
+
+		authorized.GET("/destinations", controllers.RequireScope(models.ScopeDestinationsRead), ctrl.GetDestinations)
+		authorized.POST("/destinations", controllers.RequireScope(models.ScopeDestinationsWrite), ctrl.CreateDestination)
+
+		authorized.GET("/search", controllers.RequireScope(models.ScopeSearch), ctrl.Search)
+	}
+
+	// Compte de l'utilisateur connecté, inaccessible avec une clé d'API
+	account := authorized.Group("/me", controllers.RequireUserSession())
 	{
-		authorized.GET("/items", ctrl.GetItems)
-		authorized.GET("/items/:id", ctrl.GetItemByID)
-		authorized.POST("/items", ctrl.CreateItem)
-		authorized.PUT("/items/:id", ctrl.UpdateItem)
-		authorized.DELETE("/items/:id", ctrl.DeleteItem)
+		account.GET("", ctrl.GetMe)
+		account.PUT("", ctrl.UpdateMe)
+		account.POST("/email/verification", ctrl.ResendVerificationEmail)
+		account.PUT("/password", ctrl.ChangePassword)
+		account.POST("/deactivate", ctrl.DeactivateAccount)
+		account.DELETE("", ctrl.DeleteAccount)
+		account.GET("/usage", ctrl.GetMyUsage)
+		account.POST("/2fa/totp", ctrl.EnrollTOTP)
+		account.POST("/2fa/totp/confirm", ctrl.ConfirmTOTP)
+		account.DELETE("/2fa/totp", ctrl.DisableTOTP)
+		account.POST("/2fa/recovery-codes", ctrl.RegenerateRecoveryCodes)
+	}
+
+	// Historique et branches des conversations avec l'assistant IA, inaccessibles avec une clé d'API
+	conversations := authorized.Group("/conversations", controllers.RequireUserSession())
+	{
+		conversations.GET("/history", ctrl.GetHistory)
+		conversations.GET("/history/export", ctrl.ExportHistory)
+		conversations.DELETE("/history", ctrl.DeleteHistory)
+		conversations.DELETE("/history/:id", ctrl.DeleteHistoryMessage)
+		conversations.POST("/regenerate", chatLimit, ctrl.RegenerateReply)
+		conversations.POST("/history/:id/edit", chatLimit, ctrl.EditMessage)
+		conversations.POST("/history/:id/activate", ctrl.ActivateBranch)
+		conversations.PUT("/history/:id/feedback", ctrl.PutFeedback)
+		conversations.DELETE("/history/:id/feedback", ctrl.DeleteFeedback)
+	}
+
+	// Routes d'administration
+	admin := router.Group("/")
+	admin.Use(controllers.AuthMiddleware(), apiLimit, controllers.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/audit", controllers.RequireScope(models.ScopeAuditRead), ctrl.GetAuditLog)
+
+		// Une clé d'API ne peut pas gérer les clés d'API
+		apiKeys := admin.Group("/admin/api-keys", controllers.RequireUserSession())
+		apiKeys.GET("", ctrl.GetAPIKeys)
+		apiKeys.POST("", ctrl.CreateAPIKey)
+		apiKeys.DELETE("/:id", ctrl.RevokeAPIKey)
+
+		// Gestion des comptes, également réservée aux administrateurs connectés
+		users := admin.Group("/admin/users", controllers.RequireUserSession())
+		users.GET("", ctrl.GetUsers)
+		users.GET("/:id", ctrl.GetUser)
+		users.GET("/:id/sessions", ctrl.GetUserSessions)
+		users.DELETE("/:id/sessions", ctrl.RevokeUserSessions)
+		users.GET("/:id/activity", ctrl.GetUserActivity)
+		users.GET("/:id/conversations", ctrl.GetUserConversations)
+		users.POST("/:id/disable", ctrl.DisableUser)
+		users.POST("/:id/enable", ctrl.EnableUser)
+		users.POST("/:id/password-reset", ctrl.AdminResetPassword)
+		users.PUT("/:id/role", ctrl.SetUserRole)
+		users.PUT("/:id/quota", ctrl.SetUserQuota)
+
+		// Prompts système et personas de l'assistant IA
+		prompts := admin.Group("/admin/prompts", controllers.RequireUserSession())
+		prompts.GET("", ctrl.GetPersonas)
+		prompts.POST("/preview", ctrl.PreviewPrompt)
+		prompts.GET("/:persona", ctrl.GetPromptVersions)
+		prompts.POST("/:persona", ctrl.CreatePromptVersion)
+
+		// Base de connaissances de l'assistant IA (guides et FAQ internes)
+		documents := admin.Group("/admin/documents", controllers.RequireUserSession())
+		documents.GET("", ctrl.GetDocuments)
+		documents.POST("", ctrl.CreateDocument)
+		documents.POST("/search", ctrl.SearchDocuments)
+		documents.GET("/:id", ctrl.GetDocument)
+		documents.DELETE("/:id", ctrl.DeleteDocument)
+
+		// Avis des utilisateurs sur les réponses de l'assistant IA
+		feedback := admin.Group("/admin/feedback", controllers.RequireUserSession())
+		feedback.GET("/report", ctrl.GetQualityReport)
+
+		// Messages signalés par la modération de l'assistant IA
+		moderation := admin.Group("/admin/moderation", controllers.RequireUserSession())
+		moderation.GET("/flags", ctrl.GetModerationFlags)
+
+		// Consommation de tokens de l'assistant IA
+		admin.GET("/admin/usage", controllers.RequireUserSession(), ctrl.GetUsageReport)
 	}
 
 	// Route Swagger
@@ -38,3 +151,29 @@ func SetupRoutes(router *gin.Engine, ctrl *controllers.Controller) {
 		c.Redirect(302, "/swagger/index.html")
 	})
 }
+
+// rateLimit renvoie le middleware de limitation du groupe de routes name.
+// La limite et la clé par défaut peuvent être remplacées par RATE_LIMIT_<NAME> et RATE_LIMIT_<NAME>_KEY.
+func rateLimit(ctrl *controllers.Controller, name string, def ratelimit.Limit, key string) gin.HandlerFunc {
+	if ctrl.RateLimitStore == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limit, keyFunc, err := ratelimit.FromEnv(name, def, key)
+	if err != nil {
+		log.Fatal("Invalid rate limit configuration:", err)
+	}
+	return ratelimit.Middleware(ctrl.RateLimitStore, name, limit, keyFunc)
+}
+
+// anonymousRateLimit renvoie le middleware de limitation d'un groupe de routes appelées sans authentification,
+// dont la clé RATE_LIMIT_<NAME>_KEY ne peut être que ip
+func anonymousRateLimit(ctrl *controllers.Controller, name string, def ratelimit.Limit) gin.HandlerFunc {
+	if ctrl.RateLimitStore == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limit, keyFunc, err := ratelimit.AnonymousFromEnv(name, def)
+	if err != nil {
+		log.Fatal("Invalid rate limit configuration:", err)
+	}
+	return ratelimit.Middleware(ctrl.RateLimitStore, name, limit, keyFunc)
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryIndex est un index inversé en mémoire, utilisé quand la base n'a pas de FULLTEXT (SQLite).
+// Il est reconstruit paresseusement quand la version des données indexées a changé depuis
+// la dernière construction.
+type MemoryIndex struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	loaded   bool
+	version  int64
+	docs     []document
+	postings map[string][]posting
+}
+
+// SearchIndexVersion compte les modifications des items et des destinations. Le compteur est
+// incrémenté dans la transaction de la modification : l'index ne le voit changer qu'une fois
+// la modification validée, qu'elle vienne de cette instance de l'API ou d'une autre.
+type SearchIndexVersion struct {
+	ID      uint `gorm:"primaryKey"`
+	Version int64
+}
+
+type posting struct {
+	doc   int
+	field int
+	tf    int
+}
+
+func newMemoryIndex(db *gorm.DB) *MemoryIndex {
+	idx := &MemoryIndex{db: db}
+	if err := db.AutoMigrate(&SearchIndexVersion{}); err != nil {
+		fmt.Println("[ERROR] Impossible de créer la table search_index_versions:", err)
+	} else if err := db.FirstOrCreate(&SearchIndexVersion{ID: 1}).Error; err != nil {
+		fmt.Println("[ERROR] Impossible d'initialiser la version de l'index de recherche:", err)
+	}
+
+	bump := func(tx *gorm.DB) {
+		if tx.Statement == nil || tx.Error != nil {
+			return
+		}
+		switch tx.Statement.Table {
+		case "items", "destinations":
+			// Même connexion que la modification, donc même transaction
+			err := tx.Session(&gorm.Session{NewDB: true}).
+				Exec("UPDATE search_index_versions SET version = version + 1 WHERE id = ?", 1).Error
+			if err != nil {
+				tx.AddError(err)
+			}
+		}
+	}
+	db.Callback().Create().After("gorm:create").Register("search:bump_version", bump)
+	db.Callback().Update().After("gorm:update").Register("search:bump_version", bump)
+	db.Callback().Delete().After("gorm:delete").Register("search:bump_version", bump)
+	return idx
+}
+
+// load reconstruit l'index si la version a changé depuis la dernière construction. La version est lue
+// avant les données : une modification validée entre les deux sera reconstruite à la recherche suivante.
+func (idx *MemoryIndex) load() error {
+	var current SearchIndexVersion
+	if err := idx.db.Limit(1).Find(&current, 1).Error; err != nil {
+		return err
+	}
+	if idx.loaded && current.Version == idx.version {
+		return nil
+	}
+	if err := idx.rebuild(); err != nil {
+		return err
+	}
+	idx.version, idx.loaded = current.Version, true
+	return nil
+}
+
+func (idx *MemoryIndex) rebuild() error {
+	var docs []document
+	var items []models.Item
+	err := idx.db.FindInBatches(&items, 500, func(tx *gorm.DB, batch int) error {
+		for _, item := range items {
+			docs = append(docs, itemDocument(item))
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	var destinations []models.Destination
+	err = idx.db.FindInBatches(&destinations, 500, func(tx *gorm.DB, batch int) error {
+		for _, d := range destinations {
+			docs = append(docs, destinationDocument(d))
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	postings := map[string][]posting{}
+	for d, doc := range docs {
+		for f, fl := range doc.Fields {
+			counts := map[string]int{}
+			for _, word := range Tokenize(Normalize(fl.Text)) {
+				counts[word]++
+			}
+			for word, tf := range counts {
+				postings[word] = append(postings[word], posting{doc: d, field: f, tf: tf})
+			}
+		}
+	}
+
+	idx.docs, idx.postings = docs, postings
+	return nil
+}
+
+// Search implémente Engine. Chaque mot de la requête est comparé au vocabulaire de l'index
+// (mot exact, préfixe ou faute de frappe) ; le score combine la rareté du mot, le champ
+// et la proportion de mots de la requête trouvés dans le document.
+func (idx *MemoryIndex) Search(query string, types []string, limit int) ([]Result, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return []Result{}, nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+
+	scores := map[int]float64{}
+	matched := map[int]int{}
+	n := float64(len(idx.docs))
+	for _, term := range terms {
+		best := map[int]float64{}
+		for word, list := range idx.postings {
+			weight := matchWeight(term, word)
+			if weight == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(len(list))+0.5)/(float64(len(list))+0.5))
+			for _, p := range list {
+				doc := idx.docs[p.doc]
+				if !wantType(types, doc.Type) {
+					continue
+				}
+				tf := float64(p.tf)
+				s := weight * idf * doc.Fields[p.field].Boost * tf / (tf + 1.2)
+				if s > best[p.doc] {
+					best[p.doc] = s
+				}
+			}
+		}
+		for d, s := range best {
+			scores[d] += s
+			matched[d]++
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for d, s := range scores {
+		doc := idx.docs[d]
+		results = append(results, Result{
+			Type:       doc.Type,
+			ID:         doc.ID,
+			Title:      doc.Title,
+			Score:      math.Round(s*float64(matched[d])/float64(len(terms))*1000) / 1000,
+			Highlights: highlight(doc, terms),
+		})
+	}
+	return sortAndLimit(results, limit), nil
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"math"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// MySQLEngine s'appuie sur les index FULLTEXT (parser ngram) créés par models.InitDB.
+// Les n-grammes rendent la recherche tolérante aux fautes de frappe et la collation
+// utf8mb4_0900_ai_ci ignore accents et casse.
+type MySQLEngine struct {
+	db *gorm.DB
+}
+
+type mysqlHit struct {
+	ID    int
+	Score float64
+}
+
+// Search implémente Engine
+func (e *MySQLEngine) Search(query string, types []string, limit int) ([]Result, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return []Result{}, nil
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var results []Result
+	if wantType(types, TypeItem) {
+		var items []models.Item
+		scores, err := e.match(&items, "items", "name, description", query, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			results = append(results, e.result(itemDocument(item), scores, terms))
+		}
+	}
+	if wantType(types, TypeDestination) {
+		var destinations []models.Destination
+		scores, err := e.match(&destinations, "destinations", "name, country, description", query, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range destinations {
+			results = append(results, e.result(destinationDocument(d), scores, terms))
+		}
+	}
+	return sortAndLimit(results, limit), nil
+}
+
+// match exécute la recherche FULLTEXT sur une table, charge les lignes trouvées dans dest
+// et renvoie leur score par ID
+func (e *MySQLEngine) match(dest interface{}, table, columns, query string, limit int) (map[int]float64, error) {
+	against := "MATCH(" + columns + ") AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+	var hits []mysqlHit
+	err := e.db.Table(table).
+		Select("id, "+against+" AS score", query).
+		Where(against, query).
+		Order("score DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	scores := map[int]float64{}
+	ids := make([]int, 0, len(hits))
+	for _, h := range hits {
+		scores[h.ID] = h.Score
+		ids = append(ids, h.ID)
+	}
+	if len(ids) > 0 {
+		if err := e.db.Table(table).Where("id IN ?", ids).Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return scores, nil
+}
+
+func (e *MySQLEngine) result(doc document, scores map[int]float64, terms []string) Result {
+	return Result{
+		Type:       doc.Type,
+		ID:         doc.ID,
+		Title:      doc.Title,
+		Score:      math.Round(scores[doc.ID]*1000) / 1000,
+		Highlights: highlight(doc, terms),
+	}
+}
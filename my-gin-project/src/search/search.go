@@ -0,0 +1,128 @@
+// Package search fournit la recherche plein texte sur les items et les destinations.
+//
+// En production (MySQL) la recherche s'appuie sur les index FULLTEXT ; avec les autres
+// bases (SQLite dans les tests) un index inversé en mémoire est utilisé.
+package search
+
+import (
+	"sort"
+	"sync"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Types de documents indexés
+const (
+	TypeItem        = "item"
+	TypeDestination = "destination"
+)
+
+// Result est un document trouvé par la recherche
+type Result struct {
+	Type  string  `json:"type" example:"item"`
+	ID    int     `json:"id" example:"1"`
+	Title string  `json:"title" example:"Hôtel du lac"`
+	Score float64 `json:"score" example:"1.42"`
+	// Highlights contient, par champ, l'extrait avec les mots trouvés entourés de <mark>
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Engine recherche des documents par pertinence
+type Engine interface {
+	// Search renvoie au plus limit résultats des types demandés (tous si types est vide), par score décroissant
+	Search(query string, types []string, limit int) ([]Result, error)
+}
+
+// document est la représentation indexée d'un item ou d'une destination
+type document struct {
+	Type   string
+	ID     int
+	Title  string
+	Fields []field
+}
+
+type field struct {
+	Name  string
+	Text  string
+	Boost float64
+}
+
+func itemDocument(item models.Item) document {
+	return document{Type: TypeItem, ID: item.ID, Title: item.Name, Fields: []field{
+		{"name", item.Name, 2},
+		{"description", item.Description, 1},
+	}}
+}
+
+func destinationDocument(d models.Destination) document {
+	return document{Type: TypeDestination, ID: d.ID, Title: d.Name, Fields: []field{
+		{"name", d.Name, 2},
+		{"country", d.Country, 1.5},
+		{"description", d.Description, 1},
+	}}
+}
+
+var (
+	enginesMu sync.Mutex
+	engines   = map[*gorm.DB]Engine{}
+)
+
+// New renvoie le moteur de recherche adapté à la base : FULLTEXT pour MySQL,
+// index en mémoire sinon. Le moteur est partagé pour une même connexion.
+func New(db *gorm.DB) Engine {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	if e, ok := engines[db]; ok {
+		return e
+	}
+	var e Engine
+	if db.Dialector.Name() == "mysql" {
+		e = &MySQLEngine{db: db}
+	} else {
+		e = newMemoryIndex(db)
+	}
+	engines[db] = e
+	return e
+}
+
+func wantType(types []string, t string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, w := range types {
+		if w == t {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight renseigne les extraits surlignés de chaque champ d'un document
+func highlight(doc document, terms []string) map[string]string {
+	highlights := map[string]string{}
+	for _, f := range doc.Fields {
+		if h := Highlight(f.Text, terms); h != "" {
+			highlights[f.Name] = h
+		}
+	}
+	return highlights
+}
+
+func sortAndLimit(results []Result, limit int) []Result {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Type != results[j].Type {
+			return results[i].Type < results[j].Type
+		}
+		return results[i].ID < results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"errors"
+	"testing"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize("Séjour à Évian-les-Bains"); got != "sejour a evian-les-bains" {
+		t.Errorf("Unexpected normalization: %q", got)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"annecy", "annecy", 0},
+		{"anecy", "annecy", 1},
+		{"anency", "annecy", 1},
+		{"chateau", "chapeau", 1},
+		{"marseille", "marsielle", 1},
+	}
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("Croisière sur le lac d'Annecy", queryTerms("croisiere anecy"))
+	want := "<mark>Croisière</mark> sur le lac d&#39;<mark>Annecy</mark>"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if Highlight("Randonnée", []string{"plage"}) != "" {
+		t.Errorf("Expected no highlight")
+	}
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Item{}, &models.Destination{})
+	engine := New(db)
+
+	db.Create(&[]models.Item{
+		{Name: "Hôtel du Lac", Description: "Chambres avec vue sur le lac d'Annecy", Price: 120},
+		{Name: "Vol Paris-Nice", Description: "Aller simple", Price: 89},
+	})
+	db.Create(&models.Destination{Name: "Annecy", Country: "France", Description: "La Venise des Alpes"})
+
+	results, err := engine.Search("anecy", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+	// Le titre pèse plus que la description
+	if results[0].Type != TypeDestination || results[1].Title != "Hôtel du Lac" {
+		t.Errorf("Unexpected ranking: %+v", results)
+	}
+
+	// L'index suit les modifications
+	db.Create(&models.Item{Name: "Hotel Annecy Centre", Price: 95})
+	results, _ = engine.Search("hotel", []string{TypeItem}, 10)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 hotels, got %+v", results)
+	}
+	if results[0].Highlights["name"] == "" {
+		t.Errorf("Expected highlighted name, got %+v", results[0])
+	}
+}
+
+func TestMemoryIndexVersion(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Item{}, &models.Destination{})
+	engine := New(db)
+	version := func() int64 {
+		var v SearchIndexVersion
+		db.First(&v, 1)
+		return v.Version
+	}
+
+	item := models.Item{Name: "Gîte Annecy", Price: 75}
+	db.Create(&item)
+	if results, _ := engine.Search("gite", nil, 10); len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %+v", results)
+	}
+
+	// Une modification annulée ne change pas la version
+	before := version()
+	db.Transaction(func(tx *gorm.DB) error {
+		tx.Model(&item).Update("name", "Chalet Annecy")
+		return errors.New("rollback")
+	})
+	if version() != before {
+		t.Errorf("Expected a rolled back change to keep version %d, got %d", before, version())
+	}
+
+	// Une modification validée est vue à la recherche suivante
+	db.Model(&item).Update("name", "Chalet Annecy")
+	if version() == before {
+		t.Error("Expected a committed change to bump the version")
+	}
+	if results, _ := engine.Search("chalet", nil, 10); len(results) != 1 {
+		t.Errorf("Expected the renamed item, got %+v", results)
+	}
+	if results, _ := engine.Search("gite", nil, 10); len(results) != 0 {
+		t.Errorf("Expected the old name to be gone, got %+v", results)
+	}
+}
@@ -0,0 +1,159 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize met le texte en minuscules et retire les accents ("Édimbourg" -> "edimbourg")
+func Normalize(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		out = s
+	}
+	return strings.ToLower(out)
+}
+
+// Tokenize découpe un texte normalisé en mots
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// queryTerms renvoie les mots distincts d'une requête
+func queryTerms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range Tokenize(Normalize(query)) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// maxEdits renvoie le nombre de fautes de frappe tolérées pour un mot de la requête
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// matchWeight indique à quel point word correspond au terme de requête term :
+// 1 pour un mot identique, 0.8 pour un préfixe, 0.6 pour une faute de frappe, 0 sinon
+func matchWeight(term, word string) float64 {
+	switch {
+	case word == term:
+		return 1
+	case len(term) >= 3 && strings.HasPrefix(word, term):
+		return 0.8
+	case maxEdits(term) > 0 && distance(term, word) <= maxEdits(term):
+		return 0.6
+	}
+	return 0
+}
+
+// distance calcule la distance de Damerau-Levenshtein (transpositions adjacentes comprises)
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > 2 || d < -2 {
+		return 3
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+const snippetRadius = 80
+
+// Highlight entoure de <mark> les mots de text qui correspondent à la requête.
+// Le texte est échappé pour HTML ; les textes longs sont réduits à un extrait autour de la première correspondance.
+// Renvoie une chaîne vide si aucun mot ne correspond.
+func Highlight(text string, terms []string) string {
+	runesText := []rune(text)
+	var out strings.Builder
+	first, last, pos := -1, 0, 0
+
+	type span struct{ start, end int }
+	var marks []span
+	for pos < len(runesText) {
+		if !unicode.IsLetter(runesText[pos]) && !unicode.IsDigit(runesText[pos]) {
+			pos++
+			continue
+		}
+		start := pos
+		for pos < len(runesText) && (unicode.IsLetter(runesText[pos]) || unicode.IsDigit(runesText[pos])) {
+			pos++
+		}
+		word := Normalize(string(runesText[start:pos]))
+		for _, term := range terms {
+			if matchWeight(term, word) > 0 {
+				marks = append(marks, span{start, pos})
+				if first < 0 {
+					first = start
+				}
+				break
+			}
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	from, to := 0, len(runesText)
+	if len(runesText) > 2*snippetRadius {
+		from = max(0, first-snippetRadius/2)
+		to = min(len(runesText), from+2*snippetRadius)
+	}
+	if from > 0 {
+		out.WriteString("…")
+	}
+	last = from
+	for _, m := range marks {
+		if m.start < from || m.end > to {
+			continue
+		}
+		out.WriteString(html.EscapeString(string(runesText[last:m.start])))
+		out.WriteString("<mark>")
+		out.WriteString(html.EscapeString(string(runesText[m.start:m.end])))
+		out.WriteString("</mark>")
+		last = m.end
+	}
+	out.WriteString(html.EscapeString(string(runesText[last:to])))
+	if to < len(runesText) {
+		out.WriteString("…")
+	}
+	return out.String()
+}
@@ -0,0 +1,161 @@
+// Package sso implémente la connexion via des fournisseurs OpenID Connect externes
+// (Google, annuaire d'entreprise...) : flux authorization code avec PKCE, document de
+// découverte et vérification de l'ID token avec les clés (JWKS) du fournisseur.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"my-gin-project/src/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrUnknownProvider est renvoyée pour un fournisseur non configuré
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// Claims sont les informations d'identité extraites d'un ID token vérifié
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Provider est un fournisseur OpenID Connect.
+// Le document de découverte est chargé à la première utilisation.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// discover charge le document de découverte du fournisseur ; réessayé tant qu'il échoue
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery for %s: %w", p.Name, err)
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// AuthCodeURL renvoie l'URL d'autorisation du fournisseur.
+// state et nonce protègent contre la falsification et le rejeu ; verifier est le secret PKCE.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	cfg, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return cfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange échange le code d'autorisation contre un ID token, le vérifie et renvoie ses claims
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	var claims Claims
+	cfg, idVerifier, err := p.discover(ctx)
+	if err != nil {
+		return claims, err
+	}
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return claims, fmt.Errorf("token exchange: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return claims, errors.New("no id_token in token response")
+	}
+	idToken, err := idVerifier.Verify(ctx, raw)
+	if err != nil {
+		return claims, fmt.Errorf("id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return claims, errors.New("id token: nonce mismatch")
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return claims, err
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("id token: missing subject")
+	}
+	return claims, nil
+}
+
+// Providers sont les fournisseurs configurés, indexés par nom
+type Providers map[string]*Provider
+
+// Get renvoie le fournisseur name
+func (ps Providers) Get(name string) (*Provider, error) {
+	if p, ok := ps[name]; ok {
+		return p, nil
+	}
+	return nil, ErrUnknownProvider
+}
+
+// Names renvoie les noms des fournisseurs, triés
+func (ps Providers) Names() []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProvidersFromEnv lit les fournisseurs listés dans OIDC_PROVIDERS (ex: "google,corp").
+// Chaque fournisseur NAME est configuré par OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, et éventuellement OIDC_<NAME>_REDIRECT_URL et OIDC_<NAME>_SCOPES.
+func ProvidersFromEnv() (Providers, error) {
+	providers := Providers{}
+	for _, name := range strings.Split(config.String("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := &Provider{
+			Name:         name,
+			Issuer:       config.String(prefix+"ISSUER", ""),
+			ClientID:     config.String(prefix+"CLIENT_ID", ""),
+			ClientSecret: config.String(prefix+"CLIENT_SECRET", ""),
+			RedirectURL: config.String(prefix+"REDIRECT_URL",
+				strings.TrimRight(config.String("APP_URL", "http://localhost:8080"), "/")+"/auth/"+name+"/callback"),
+			Scopes: strings.Fields(config.String(prefix+"SCOPES", "openid email profile")),
+		}
+		if !slices.Contains(p.Scopes, oidc.ScopeOpenID) {
+			p.Scopes = append([]string{oidc.ScopeOpenID}, p.Scopes...)
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		providers[name] = p
+	}
+	return providers, nil
+}
@@ -0,0 +1,227 @@
+// Package usage comptabilise les tokens consommés par l'assistant IA et applique les quotas
+// journaliers et mensuels des utilisateurs, et ceux de chaque adresse IP pour les appels anonymes.
+// Les périodes suivent le calendrier UTC.
+package usage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-gin-project/src/config"
+	"my-gin-project/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Périodes des quotas
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Limits sont les quotas de tokens (prompt et réponse) d'un utilisateur ; 0 : pas de limite
+type Limits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Price est le coût de 1000 tokens de prompt et de 1000 tokens de réponse
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Policy fixe les quotas de chaque rôle et le prix des tokens de chaque modèle
+type Policy struct {
+	// Roles sont les quotas par rôle ; un rôle absent n'est pas limité
+	Roles map[string]Limits
+	// Anonymous sont les quotas des appels sans compte, partagés par adresse IP
+	Anonymous Limits
+	// Prices sont les prix par modèle ; "*" s'applique aux modèles absents (gratuits sans "*")
+	Prices map[string]Price
+}
+
+// Totals est la consommation cumulée sur une période
+type Totals struct {
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+// Tokens est le nombre de tokens décompté des quotas
+func (t Totals) Tokens() int64 {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+// ExceededError indique qu'un utilisateur a atteint un quota
+type ExceededError struct {
+	Period  string
+	Limit   int64
+	Used    int64
+	ResetAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s token quota exceeded (%d/%d)", e.Period, e.Used, e.Limit)
+}
+
+// Default renvoie les quotas par défaut : 100 000 tokens par jour et 2 000 000 par mois pour
+// les utilisateurs, sans limite pour les administrateurs, 20 000 par jour et 200 000 par mois
+// par adresse IP pour les appels anonymes, et des tokens gratuits
+func Default() *Policy {
+	return &Policy{
+		Roles: map[string]Limits{
+			models.RoleUser: {Daily: 100000, Monthly: 2000000},
+		},
+		Anonymous: Limits{Daily: 20000, Monthly: 200000},
+		Prices:    map[string]Price{},
+	}
+}
+
+// FromEnv lit les quotas de chaque rôle dans USAGE_<ROLE>_DAILY_TOKENS et USAGE_<ROLE>_MONTHLY_TOKENS,
+// ceux des appels anonymes dans USAGE_ANONYMOUS_DAILY_TOKENS et USAGE_ANONYMOUS_MONTHLY_TOKENS
+// (0 : pas de limite) et les prix dans USAGE_PRICES, par exemple "mistral=0.02/0.06,*=0.01/0.03"
+// (prix de 1000 tokens de prompt / de réponse)
+func FromEnv() (*Policy, error) {
+	p := Default()
+	for _, role := range models.Roles {
+		limits := p.Roles[role]
+		prefix := "USAGE_" + strings.ToUpper(role) + "_"
+		limits.Daily = int64(config.Int(prefix+"DAILY_TOKENS", int(limits.Daily)))
+		limits.Monthly = int64(config.Int(prefix+"MONTHLY_TOKENS", int(limits.Monthly)))
+		if limits.Daily < 0 || limits.Monthly < 0 {
+			return nil, fmt.Errorf("invalid %s quotas: must be positive or 0", role)
+		}
+		p.Roles[role] = limits
+	}
+	p.Anonymous.Daily = int64(config.Int("USAGE_ANONYMOUS_DAILY_TOKENS", int(p.Anonymous.Daily)))
+	p.Anonymous.Monthly = int64(config.Int("USAGE_ANONYMOUS_MONTHLY_TOKENS", int(p.Anonymous.Monthly)))
+	if p.Anonymous.Daily < 0 || p.Anonymous.Monthly < 0 {
+		return nil, fmt.Errorf("invalid anonymous quotas: must be positive or 0")
+	}
+	prices, err := ParsePrices(config.String("USAGE_PRICES", ""))
+	if err != nil {
+		return nil, err
+	}
+	p.Prices = prices
+	return p, nil
+}
+
+// ParsePrices lit une liste "modèle=prompt/réponse" séparée par des virgules
+func ParsePrices(s string) (map[string]Price, error) {
+	prices := map[string]Price{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		model, values, ok := strings.Cut(entry, "=")
+		prompt, completion, ok2 := strings.Cut(values, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("invalid USAGE_PRICES entry %q (model=prompt/completion)", entry)
+		}
+		var price Price
+		var err error
+		if price.Prompt, err = strconv.ParseFloat(strings.TrimSpace(prompt), 64); err == nil {
+			price.Completion, err = strconv.ParseFloat(strings.TrimSpace(completion), 64)
+		}
+		if err != nil || price.Prompt < 0 || price.Completion < 0 {
+			return nil, fmt.Errorf("invalid USAGE_PRICES entry %q (model=prompt/completion)", entry)
+		}
+		prices[strings.TrimSpace(model)] = price
+	}
+	return prices, nil
+}
+
+// Cost est le coût des tokens d'un appel à model
+func (p *Policy) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := p.Prices[model]
+	if !ok {
+		price = p.Prices["*"]
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1000
+}
+
+// LimitsFor renvoie les quotas de user : ceux de son compte, ou à défaut ceux de son rôle
+func (p *Policy) LimitsFor(user models.User) Limits {
+	limits := p.Roles[user.Role]
+	if user.DailyTokenQuota != nil {
+		limits.Daily = *user.DailyTokenQuota
+	}
+	if user.MonthlyTokenQuota != nil {
+		limits.Monthly = *user.MonthlyTokenQuota
+	}
+	return limits
+}
+
+// Window renvoie le début de la période qui contient now et le début de la suivante
+func Window(period string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	if period == Monthly {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Since cumule la consommation de userID depuis start
+func Since(db *gorm.DB, userID uint, start time.Time) (Totals, error) {
+	return sum(db.Where("user_id = ?", userID), start)
+}
+
+// SinceClient cumule la consommation anonyme de l'adresse ip depuis start
+func SinceClient(db *gorm.DB, ip string, start time.Time) (Totals, error) {
+	return sum(db.Where("user_id IS NULL AND client_ip = ?", ip), start)
+}
+
+func sum(query *gorm.DB, start time.Time) (Totals, error) {
+	var t Totals
+	err := query.Model(&models.AIUsage{}).
+		Select("COUNT(*) AS requests, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where("created_at >= ?", start).Scan(&t).Error
+	return t, err
+}
+
+// Check renvoie une *ExceededError si user a atteint son quota du jour ou du mois. Le contrôle a lieu
+// avant l'appel au modèle : la génération qui franchit le quota est menée à son terme. Rien n'est réservé,
+// si bien que des requêtes simultanées passent toutes le contrôle : le dépassement est borné par le nombre
+// de générations en cours (limité par la limitation de débit des routes de l'assistant) multiplié par la
+// consommation d'une génération, prompt et MaxTokens de chaque tour d'outils et du classificateur compris.
+func (p *Policy) Check(db *gorm.DB, user models.User, now time.Time) error {
+	return check(p.LimitsFor(user), now, func(start time.Time) (Totals, error) {
+		return Since(db, user.ID, start)
+	})
+}
+
+// CheckClient renvoie une *ExceededError si les appels anonymes de l'adresse ip ont atteint le quota
+// du jour ou du mois, quel que soit le nom d'utilisateur qu'ils indiquent
+func (p *Policy) CheckClient(db *gorm.DB, ip string, now time.Time) error {
+	return check(p.Anonymous, now, func(start time.Time) (Totals, error) {
+		return SinceClient(db, ip, start)
+	})
+}
+
+func check(limits Limits, now time.Time, since func(time.Time) (Totals, error)) error {
+	for _, period := range []string{Daily, Monthly} {
+		limit := limits.Daily
+		if period == Monthly {
+			limit = limits.Monthly
+		}
+		if limit == 0 {
+			continue
+		}
+		start, end := Window(period, now)
+		totals, err := since(start)
+		if err != nil {
+			return err
+		}
+		if totals.Tokens() >= limit {
+			return &ExceededError{Period: period, Limit: limit, Used: totals.Tokens(), ResetAt: end}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package usage
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"my-gin-project/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("USAGE_USER_DAILY_TOKENS", "5000")
+	t.Setenv("USAGE_ADMIN_MONTHLY_TOKENS", "900000")
+	t.Setenv("USAGE_ANONYMOUS_DAILY_TOKENS", "0")
+	t.Setenv("USAGE_PRICES", "mistral=0.02/0.06, *=0.01/0.03")
+	p, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Roles[models.RoleUser] != (Limits{Daily: 5000, Monthly: 2000000}) || p.Roles[models.RoleAdmin] != (Limits{Monthly: 900000}) {
+		t.Errorf("Unexpected quotas: %+v", p.Roles)
+	}
+	if p.Anonymous != (Limits{Monthly: 200000}) {
+		t.Errorf("Unexpected anonymous quotas: %+v", p.Anonymous)
+	}
+	if cost := p.Cost("mistral", 1000, 500); math.Abs(cost-0.05) > 1e-9 {
+		t.Errorf("Expected the mistral price, got %v", cost)
+	}
+	if cost := p.Cost("llama3", 2000, 0); math.Abs(cost-0.02) > 1e-9 {
+		t.Errorf("Expected the default price, got %v", cost)
+	}
+
+	for _, prices := range []string{"mistral", "mistral=0.02", "=0.1/0.2", "mistral=a/0.1", "mistral=-1/0"} {
+		if _, err := ParsePrices(prices); err == nil {
+			t.Errorf("Expected an error for %q", prices)
+		}
+	}
+	t.Setenv("USAGE_USER_MONTHLY_TOKENS", "-1")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an error for a negative quota")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Date(2026, 10, 19, 23, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	start, end := Window(Daily, now)
+	if !start.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected day: %v - %v", start, end)
+	}
+	start, end = Window(Monthly, time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC))
+	if !start.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected month: %v - %v", start, end)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.AIUsage{})
+	now := time.Now().UTC()
+	monthStart, _ := Window(Monthly, now)
+	dayStart, _ := Window(Daily, now)
+	alice, bob := uint(1), uint(2)
+	db.Create(&[]models.AIUsage{
+		{UserID: &alice, PromptTokens: 700, CompletionTokens: 100, CreatedAt: monthStart.Add(-time.Hour)},
+		{UserID: &alice, PromptTokens: 300, CompletionTokens: 100, CreatedAt: monthStart},
+		{UserID: &alice, PromptTokens: 400, CompletionTokens: 200, CreatedAt: dayStart},
+		{UserID: &bob, PromptTokens: 5000, CreatedAt: dayStart},
+		{ClientIP: "203.0.113.7", PromptTokens: 900, CompletionTokens: 100, CreatedAt: dayStart},
+	})
+
+	p := &Policy{Roles: map[string]Limits{models.RoleUser: {Daily: 2000, Monthly: 1000}}, Anonymous: Limits{Daily: 1000}}
+	user := models.User{ID: 1, Role: models.RoleUser}
+	err := p.Check(db, user, now)
+	var exceeded *ExceededError
+	// Le mois précédent n'est pas décompté
+	if !errors.As(err, &exceeded) || exceeded.Period != Monthly || exceeded.Used != 1000 {
+		t.Fatalf("Expected the monthly quota to be exceeded, got %v", err)
+	}
+	if _, end := Window(Monthly, now); !exceeded.ResetAt.Equal(end) {
+		t.Errorf("Expected a reset at the next month, got %v", exceeded.ResetAt)
+	}
+
+	unlimited := int64(0)
+	user.MonthlyTokenQuota = &unlimited
+	if err := p.Check(db, user, now); err != nil {
+		t.Errorf("Expected the account quota to replace the role quota, got %v", err)
+	}
+	if err := p.Check(db, models.User{ID: 2, Role: models.RoleAdmin}, now); err != nil {
+		t.Errorf("Expected no limit for a role without quota, got %v", err)
+	}
+
+	// Les appels anonymes sont décomptés de leur adresse IP, sans compter ceux des comptes
+	if err := p.CheckClient(db, "203.0.113.7", now); !errors.As(err, &exceeded) || exceeded.Period != Daily || exceeded.Used != 1000 {
+		t.Errorf("Expected the anonymous daily quota to be exceeded, got %v", err)
+	}
+	if err := p.CheckClient(db, "203.0.113.8", now); err != nil {
+		t.Errorf("Expected another address to have its own quota, got %v", err)
+	}
+}